@@ -9,12 +9,16 @@ import (
 	"github.com/briandowns/spinner"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
 	"github.com/schollz/progressbar/v3"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
 	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
+// backupDir is the local directory backups are downloaded to.
+const backupDir = "backups"
+
 var backupCmd = &cobra.Command{
 	Use:   "backup",
 	Short: "🛡️  Backup remote repository",
@@ -22,6 +26,10 @@ var backupCmd = &cobra.Command{
 	Run:   runBackup,
 }
 
+func init() {
+	backupCmd.Flags().BoolVar(&keepArtifacts, "keep-artifacts", false, "Leave the server's backup bundle and a failed backup's download in place for debugging")
+}
+
 func runBackup(cmd *cobra.Command, args []string) {
 	printBanner()
 	ui.Green.Println("\n🛡️  Backing up Remote Repository")
@@ -29,7 +37,7 @@ func runBackup(cmd *cobra.Command, args []string) {
 	cfg, err := config.Load()
 	if err != nil {
 		ui.Red.Printf("❌ Error loading config: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
@@ -40,7 +48,7 @@ func runBackup(cmd *cobra.Command, args []string) {
 	if err != nil {
 		s.Stop()
 		ui.Red.Printf("❌ Connection failed: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer client.Close()
 
@@ -54,20 +62,22 @@ func runBackup(cmd *cobra.Command, args []string) {
 	backupName := fmt.Sprintf("%s-backup-%s.bundle", cfg.Project.Name, timestamp)
 	remoteRepoPath := filepath.Join(cfg.Server.RemotePath, cfg.Project.Name)
 	remoteBackupPath := filepath.Join(cfg.Server.RemotePath, backupName)
+	trackArtifacts()
+	artifacts.Remote(client, remoteBackupPath)
 
 	_, err = client.Run(cmd.Context(), fmt.Sprintf("cd %s && git bundle create %s --all", remoteRepoPath, remoteBackupPath))
 	s.Stop()
 
 	if err != nil {
 		ui.Red.Printf("❌ Remote backup failed: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	ui.Green.Println("✅ Backup bundle created on server")
 
-	backupDir := "backups"
 	os.MkdirAll(backupDir, 0755)
 	localBackupPath := filepath.Join(backupDir, backupName)
+	artifacts.Output(localBackupPath)
 
 	bar := progressbar.DefaultBytes(
 		-1,
@@ -83,12 +93,36 @@ func runBackup(cmd *cobra.Command, args []string) {
 
 	if err != nil {
 		ui.Red.Printf("❌ Download failed: %v\n", err)
-		os.Exit(1)
+		exit(1)
+	}
+
+	manifest, err := newSyncManifest(cmd.Context(), bundle.NewRepo("."), cfg, localBackupPath, bundle.DirectionBackup)
+	if err != nil {
+		ui.Red.Printf("\n❌ Error reading backup: %v\n", err)
+		exit(1)
+	}
+
+	if cfg.Bundle.Encryption.Enabled() {
+		localBackupPath, err = bundle.Encrypt(localBackupPath, cfg.Bundle.Encryption.Recipients)
+		if err != nil {
+			ui.Red.Printf("\n❌ Error encrypting backup: %v\n", err)
+			exit(1)
+		}
+	}
+
+	manifest.Encrypted = bundle.IsEncrypted(localBackupPath)
+	if err := manifest.SetArtifact(localBackupPath); err != nil {
+		ui.Yellow.Printf("\n⚠️  %v\n", err)
+	}
+	if _, err := manifest.Write(localBackupPath); err != nil {
+		ui.Yellow.Printf("\n⚠️  %v\n", err)
 	}
 
 	info, _ := os.Stat(localBackupPath)
 	ui.Green.Printf("\n✅ Backup saved: %s (%s)\n", localBackupPath, utils.FormatBytes(info.Size()))
 
 	// Cleanup remote
-	client.Run(cmd.Context(), fmt.Sprintf("rm -f %s", remoteBackupPath))
+	finishArtifacts(true)
+
+	autoPrune(cfg, nil, backupDir)
 }
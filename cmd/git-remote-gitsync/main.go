@@ -0,0 +1,71 @@
+// Command git-remote-gitsync is a git remote helper for gitsync:// URLs. It lets plain
+// git commands sync with a gitsync server:
+//
+//	git remote add lab gitsync://lab/myproject
+//	git push lab main
+//	git fetch lab
+//
+// The server settings come from the profile ~/.config/gitsync/profiles/lab.yaml, a
+// regular .gitsync.yaml, and the repository is myproject under its remote_path.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/helper"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: gitsync: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	// Git passes the remote name and its URL
+	if len(os.Args) < 3 {
+		return fmt.Errorf("usage: git-remote-gitsync <remote> <url>")
+	}
+	url, err := helper.ParseURL(os.Args[2])
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadProfile(url.Profile)
+	if err != nil {
+		return err
+	}
+
+	client, err := ssh.NewClient(cfg.Server)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", cfg.Server.Host, err)
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	h := &helper.Helper{
+		Repo:      bundle.NewRepo("."),
+		Transport: client,
+		RepoPath:  filepath.Join(cfg.Server.RemotePath, url.Project),
+		BundleDir: cfg.Server.RemotePath,
+		Name:      url.Project,
+		Log:       os.Stderr,
+	}
+	switch {
+	case cfg.Bundle.Signing.Strict:
+		h.PushRefusal = "the profile requires signed bundles, push with gitsync push"
+	case cfg.Bundle.Encryption.Enabled():
+		h.PushRefusal = "the profile encrypts bundles, push with gitsync push"
+	}
+	return h.Serve(ctx, os.Stdin, os.Stdout)
+}
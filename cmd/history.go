@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
 	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
@@ -51,18 +53,49 @@ func runHistory(cmd *cobra.Command, args []string) {
 		return files[i].Name() > files[j].Name()
 	})
 
-	fmt.Printf("%-35s %-12s %-20s\n", "BUNDLE NAME", "SIZE", "CREATED")
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-40s %-7s %-8s %-10s %-20s\n", "BUNDLE NAME", "DIR", "COMMITS", "SIZE", "CREATED")
+	fmt.Println(strings.Repeat("-", 90))
 
 	for _, f := range files {
-		if f.IsDir() || filepath.Ext(f.Name()) != ".bundle" {
+		name := strings.TrimSuffix(f.Name(), bundle.EncryptedExt)
+		if ext := filepath.Ext(name); f.IsDir() || (ext != ".bundle" && ext != bundle.PatchExt) {
 			continue
 		}
 
 		info, _ := f.Info()
-		fmt.Printf("%-35s %-12s %-20s\n", 
-			f.Name(), 
-			utils.FormatBytes(info.Size()), 
-			info.ModTime().Format("2006-01-02 15:04:05"))
+		direction, commits, created := "-", "-", info.ModTime()
+
+		if m, err := bundle.LoadManifest(filepath.Join(cfg.Bundle.Directory, f.Name())); err == nil {
+			direction = m.Direction
+			commits = fmt.Sprintf("%d", m.CommitCount)
+			created = m.CreatedAt
+		}
+
+		fmt.Printf("%-40s %-7s %-8s %-10s %-20s\n",
+			f.Name(),
+			direction,
+			commits,
+			utils.FormatBytes(info.Size()),
+			created.Format("2006-01-02 15:04:05"))
 	}
 }
+
+// newSyncManifest builds the manifest of a freshly created plaintext bundle and fills in
+// the project, server and tool details from the configuration.
+func newSyncManifest(ctx context.Context, repo *bundle.Repo, cfg *config.Config, bundlePath, direction string) (*bundle.Manifest, error) {
+	m, err := repo.NewManifest(ctx, bundlePath, direction)
+	if err != nil {
+		return nil, err
+	}
+	describeManifest(m, cfg)
+	return m, nil
+}
+
+// describeManifest fills in the project, server and tool details of a manifest from the
+// configuration.
+func describeManifest(m *bundle.Manifest, cfg *config.Config) {
+	m.Project = cfg.Project.Name
+	m.Server = fmt.Sprintf("%s@%s:%s", cfg.Server.User, cfg.Server.Host, cfg.Server.RemotePath)
+	m.Version = version
+	m.Compressed = cfg.Bundle.Compress
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
+	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneDryRun bool
+	pruneLocal  bool
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "🧹 Remove old bundles",
+	Long: `Remove bundles that fall outside the retention limits (bundle.max_history,
+bundle.max_age and bundle.max_size) from the local bundle directory, the
+backups directory and the server's remote path. Only the project's own
+bundles are considered, matched by their exact generated names. A bundle's signature,
+manifest, volumes, submodule bundles and LFS archive are removed with it.
+
+Push, pull and backup prune automatically once they succeed.
+
+Examples:
+  gitsync prune            # Prune locally and on the server
+  gitsync prune --dry-run  # Show what would be removed
+  gitsync prune --local    # Do not connect to the server`,
+	Run: runPrune,
+}
+
+func init() {
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Show what would be removed without deleting anything")
+	pruneCmd.Flags().BoolVar(&pruneLocal, "local", false, "Only prune local directories")
+}
+
+func runPrune(cmd *cobra.Command, args []string) {
+	printBanner()
+	ui.Green.Println("\n🧹 Pruning Old Bundles")
+
+	cfg, err := config.Load()
+	if err != nil {
+		ui.Red.Printf("❌ Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	retention, err := retentionPolicy(cfg)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	var pruned []bundle.Artifact
+	for _, dir := range []string{cfg.Bundle.Directory, backupDir} {
+		expired, err := pruneLocalDir(dir, cfg.Project.Name, retention, pruneDryRun)
+		if err != nil {
+			ui.Red.Printf("❌ Failed to prune %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+		printPruned(dir, expired)
+		pruned = append(pruned, expired...)
+	}
+
+	if !pruneLocal {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Suffix = " Connecting to server..."
+		s.Start()
+
+		client, err := ssh.NewClient(cfg.Server)
+		s.Stop()
+		if err != nil {
+			ui.Red.Printf("❌ Connection failed: %v\n", err)
+			ui.Yellow.Println("💡 Use --local to prune only local directories")
+			os.Exit(1)
+		}
+		defer client.Close()
+
+		expired, err := pruneRemoteDir(client, cfg, retention, pruneDryRun)
+		if err != nil {
+			ui.Red.Printf("❌ Failed to prune %s on the server: %v\n", cfg.Server.RemotePath, err)
+			os.Exit(1)
+		}
+		printPruned(fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.RemotePath), expired)
+		pruned = append(pruned, expired...)
+	}
+
+	var freed int64
+	for _, a := range pruned {
+		freed += a.Size
+	}
+
+	switch {
+	case len(pruned) == 0:
+		ui.Green.Println("\n✅ Nothing to prune")
+	case pruneDryRun:
+		ui.Yellow.Printf("\n🔍 Dry run: %d bundle(s) would be removed, freeing %s\n", len(pruned), utils.FormatBytes(freed))
+	default:
+		ui.Green.Printf("\n✅ Removed %d bundle(s), freed %s\n", len(pruned), utils.FormatBytes(freed))
+	}
+}
+
+// retentionPolicy builds the retention limits from the bundle settings. A negative
+// max_history keeps any number of bundles.
+func retentionPolicy(cfg *config.Config) (bundle.Retention, error) {
+	retention := bundle.Retention{MaxCount: cfg.Bundle.MaxHistory}
+	if retention.MaxCount < 0 {
+		retention.MaxCount = 0
+	}
+
+	var err error
+	if cfg.Bundle.MaxAge != "" {
+		if retention.MaxAge, err = utils.ParseDuration(cfg.Bundle.MaxAge); err != nil {
+			return retention, fmt.Errorf("invalid bundle.max_age: %w", err)
+		}
+	}
+	if cfg.Bundle.MaxSize != "" {
+		if retention.MaxSize, err = utils.ParseBytes(cfg.Bundle.MaxSize); err != nil {
+			return retention, fmt.Errorf("invalid bundle.max_size: %w", err)
+		}
+	}
+	return retention, nil
+}
+
+// pruneLocalDir removes the project's artifacts in dir that fall outside the retention
+// limits and returns them. Nothing is removed on a dry run.
+func pruneLocalDir(dir, project string, retention bundle.Retention, dryRun bool) ([]bundle.Artifact, error) {
+	artifacts, err := bundle.LocalArtifacts(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := retention.Expired(bundle.ProjectArtifacts(artifacts, project), time.Now())
+	if dryRun {
+		return expired, nil
+	}
+	for i, a := range expired {
+		if err := bundle.RemoveArtifact(dir, a); err != nil {
+			return expired[:i], err
+		}
+	}
+	return expired, nil
+}
+
+// pruneRemoteDir removes the project's artifacts in the server's remote path that fall
+// outside the retention limits. Bundles of other projects sharing the path are left alone.
+func pruneRemoteDir(client *ssh.Client, cfg *config.Config, retention bundle.Retention, dryRun bool) ([]bundle.Artifact, error) {
+	entries, err := client.List(cfg.Server.RemotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := bundle.ProjectArtifacts(bundle.GroupArtifacts(entries), cfg.Project.Name)
+	expired := retention.Expired(artifacts, time.Now())
+	if dryRun {
+		return expired, nil
+	}
+	for i, a := range expired {
+		for _, f := range a.Files {
+			if err := client.Remove(filepath.Join(cfg.Server.RemotePath, f)); err != nil {
+				return expired[:i], err
+			}
+		}
+	}
+	return expired, nil
+}
+
+// autoPrune applies the retention limits after a successful sync. The remote path is
+// only pruned when client is set. Failures are reported as warnings.
+func autoPrune(cfg *config.Config, client *ssh.Client, dirs ...string) {
+	retention, err := retentionPolicy(cfg)
+	if err != nil {
+		ui.Yellow.Printf("⚠️  Skipping bundle pruning: %v\n", err)
+		return
+	}
+
+	var pruned []bundle.Artifact
+	for _, dir := range dirs {
+		expired, err := pruneLocalDir(dir, cfg.Project.Name, retention, false)
+		if err != nil {
+			ui.Yellow.Printf("⚠️  Failed to prune %s: %v\n", dir, err)
+		}
+		pruned = append(pruned, expired...)
+	}
+	if client != nil {
+		expired, err := pruneRemoteDir(client, cfg, retention, false)
+		if err != nil {
+			ui.Yellow.Printf("⚠️  Failed to prune old bundles on the server: %v\n", err)
+		}
+		pruned = append(pruned, expired...)
+	}
+
+	if len(pruned) > 0 {
+		var freed int64
+		for _, a := range pruned {
+			freed += a.Size
+		}
+		ui.Cyan.Printf("🧹 Pruned %d old bundle(s), freed %s\n", len(pruned), utils.FormatBytes(freed))
+	}
+}
+
+func printPruned(location string, artifacts []bundle.Artifact) {
+	if len(artifacts) == 0 {
+		return
+	}
+
+	ui.Cyan.Printf("\n📂 %s\n", location)
+	for _, a := range artifacts {
+		fmt.Printf("   • %-40s %-10s %s\n", a.Name, utils.FormatBytes(a.Size), a.ModTime.Format("2006-01-02 15:04:05"))
+	}
+}
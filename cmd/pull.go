@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +16,7 @@ import (
 	"github.com/schollz/progressbar/v3"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/remote"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
 	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
@@ -18,7 +24,13 @@ import (
 )
 
 var (
-	autoPush bool
+	autoPush        bool
+	abortOnConflict bool
+	jsonOutput      bool
+	fetchOnly       bool
+	pullBranches    []string
+	allBranches     bool
+	pullDryRun      bool
 )
 
 var pullCmd = &cobra.Command{
@@ -28,29 +40,77 @@ var pullCmd = &cobra.Command{
 	
 Examples:
   gitsync pull           # Pull changes from server
-  gitsync pull --push    # Pull and automatically push to GitHub`,
+  gitsync pull --push    # Pull and automatically push to GitHub
+  gitsync pull --fetch   # Only fetch server branches into refs/remotes/<server.name>/*
+  gitsync pull --wip     # Also bring back uncommitted changes made on the server
+  gitsync pull --branch 'feature/*'  # Also create or fast-forward matching branches
+  gitsync pull --all-branches        # Also create or fast-forward every server branch
+  gitsync pull --dry-run             # Show what a pull would do without doing it`,
 	Run: runPull,
 }
 
 func init() {
 	pullCmd.Flags().BoolVarP(&autoPush, "push", "p", false, "Automatically push to origin after pulling")
+	pullCmd.Flags().StringVar(&volumeSizeFlag, "volume-size", "", "Split the server bundle into volumes of this size (e.g. 500M)")
+	pullCmd.Flags().BoolVar(&abortOnConflict, "abort-on-conflict", false, "Abort a conflicted merge and restore the pre-pull state")
+	pullCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print merge conflicts as JSON")
+	pullCmd.Flags().StringVar(&strategyFlag, "strategy", "", "How to integrate server changes: merge, rebase, ff-only or fetch-only")
+	pullCmd.Flags().BoolVar(&fetchOnly, "fetch", false, "Only fetch server branches into refs/remotes/<server.name>/*, same as --strategy fetch-only")
+	pullCmd.Flags().BoolVar(&wipFlag, "wip", false, "Also bring back the server's uncommitted changes and apply them to the working tree without committing them")
+	pullCmd.Flags().BoolVar(&wipUntracked, "untracked", false, "With --wip, include untracked files that are not ignored")
+	pullCmd.Flags().StringSliceVar(&pullBranches, "branch", nil, "Also create or fast-forward these server branches locally (names or globs, repeatable)")
+	pullCmd.Flags().BoolVar(&allBranches, "all-branches", false, "Also create or fast-forward every server branch locally")
+	pullCmd.Flags().BoolVar(&keepArtifacts, "keep-artifacts", false, "Leave the server bundle and a failed pull's downloads in place for debugging")
+	pullCmd.Flags().BoolVar(&pullDryRun, "dry-run", false, "Show the commits, refs, bundle size and merge outcome of a pull without creating, transferring or changing anything")
 }
 
 func runPull(cmd *cobra.Command, args []string) {
 	printBanner()
 	ui.Green.Println("\n📥 Pulling from Remote Server")
 
-	// Run pre-pull hook
-	if err := executeHook("pre-pull"); err != nil {
-		ui.Red.Printf("❌ pre-pull hook failed: %v\n", err)
-		os.Exit(1)
+	// Run pre-pull hook; a dry run changes nothing for it to guard
+	if !pullDryRun {
+		if err := executeHook("pre-pull"); err != nil {
+			ui.Red.Printf("❌ pre-pull hook failed: %v\n", err)
+			exit(1)
+		}
 	}
 
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
 		ui.Red.Printf("❌ Error loading config: %v\n", err)
-		os.Exit(1)
+		exit(1)
+	}
+
+	volumeSize, err := resolveVolumeSize(cfg)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+
+	repo := bundle.NewRepo(".")
+
+	if fetchOnly {
+		if strategyFlag != "" && strategyFlag != string(bundle.StrategyFetchOnly) {
+			ui.Red.Println("❌ --fetch cannot be combined with --strategy " + strategyFlag)
+			exit(1)
+		}
+		strategyFlag = string(bundle.StrategyFetchOnly)
+	}
+	if allBranches && len(pullBranches) > 0 {
+		ui.Red.Println("❌ --branch and --all-branches cannot be used together")
+		exit(1)
+	}
+
+	strategy, err := resolveStrategy(cfg)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+	if strategy == bundle.StrategyFetchOnly && (allBranches || len(pullBranches) > 0) {
+		ui.Red.Println("❌ --branch and --all-branches change local branches and cannot be combined with fetch-only")
+		exit(1)
 	}
 
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
@@ -63,13 +123,20 @@ func runPull(cmd *cobra.Command, args []string) {
 	if err != nil {
 		s.Stop()
 		ui.Red.Printf("❌ SSH connection failed: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer client.Close()
 
 	s.Stop()
 	ui.Green.Println("✅ Connected to server")
 
+	if pullDryRun {
+		dryRunPull(cmd.Context(), repo, client, cfg, strategy)
+		return
+	}
+
+	checkDivergence(cmd.Context(), repo, client, cfg)
+
 	// Step 2: Create bundle on server
 	s.Suffix = " Creating bundle on server..."
 	s.Start()
@@ -78,20 +145,30 @@ func runPull(cmd *cobra.Command, args []string) {
 	remoteBundleName := fmt.Sprintf("%s-server-%s.bundle", cfg.Project.Name, timestamp)
 	remoteRepoPath := filepath.Join(cfg.Server.RemotePath, cfg.Project.Name)
 	remoteBundlePath := filepath.Join(cfg.Server.RemotePath, remoteBundleName)
+	trackArtifacts()
+	artifacts.Remote(client, remoteBundlePath)
 
-	createBundleScript := fmt.Sprintf(`
-		cd "%s" || exit 1
-		
-		# Check for uncommitted changes
-		if ! git diff --quiet HEAD 2>/dev/null; then
-			echo "UNCOMMITTED_CHANGES"
-		fi
-		
-		# Create bundle with all refs
-		git bundle create "%s" --all
-		
-		echo "BUNDLE_CREATED"
-	`, remoteRepoPath, remoteBundlePath)
+	// Bundles left on the server are encrypted there like the local copies
+	var recipients []string
+	if cfg.Bundle.Encryption.Enabled() {
+		if recipients, err = bundle.ServerRecipients(cfg.Bundle.Encryption.Recipients); err != nil {
+			s.Stop()
+			ui.Red.Printf("❌ Error reading encryption recipients: %v\n", err)
+			exit(1)
+		}
+	}
+
+	createBundleScript := remote.PullScript(remote.PullOptions{
+		RepoPath:     remoteRepoPath,
+		Branch:       cfg.Project.Branch,
+		BundlePath:   remoteBundlePath,
+		Haves:        localHaves(cmd.Context(), repo),
+		WIP:          wipFlag,
+		WIPUntracked: wipUntracked,
+		SigningKey:   cfg.Bundle.Signing.RemoteKey,
+		VolumeSize:   volumeSize,
+		Recipients:   recipients,
+	})
 
 		output, err := client.Run(cmd.Context(), createBundleScript)
 
@@ -99,11 +176,15 @@ func runPull(cmd *cobra.Command, args []string) {
 
 	
 
-		if strings.Contains(output, "UNCOMMITTED_CHANGES") {
+		wip := remoteValue(output, "WIP")
+		if wip != "" {
+			ui.Cyan.Printf("🚧 Server's uncommitted changes included as work in progress (%s)\n", shortSHA(wip))
+		} else if strings.Contains(output, "UNCOMMITTED_CHANGES") {
 
 			ui.Yellow.Println("⚠️  Warning: Uncommitted changes exist on the remote server.")
 
 			ui.Yellow.Println("   These changes will NOT be included in the sync until you commit them on the server.")
+			ui.Yellow.Println("💡 Pull with --wip to bring them back without committing them")
 
 		}
 
@@ -111,7 +192,11 @@ func runPull(cmd *cobra.Command, args []string) {
 
 		if err != nil || !strings.Contains(output, "BUNDLE_CREATED") {
 
-			ui.Red.Printf("❌ Failed to create bundle on server: %v\n", err)
+			if reason := remoteValue(output, "BUNDLE_ERROR"); reason != "" {
+				ui.Red.Printf("❌ Failed to create bundle on server: %s\n", reason)
+			} else {
+				ui.Red.Printf("❌ Failed to create bundle on server: %v\n", err)
+			}
 
 			if verbose {
 
@@ -119,106 +204,213 @@ func runPull(cmd *cobra.Command, args []string) {
 
 			}
 
-			os.Exit(1)
+			exit(1)
 
 		}
 
 	
 
-		ui.Green.Println("✅ Bundle created on server")
+		if bases, _ := strconv.Atoi(remoteValue(output, "BUNDLE_BASES")); bases > 0 {
+			ui.Green.Printf("✅ Bundle created on server with only what is new, based on %d local commit(s)\n", bases)
+		} else {
+			ui.Green.Println("✅ Bundle created on server with the complete history, no common base found")
+		}
 
 	
 
-		// Step 3: Download bundle
+		// Step 3: Download bundle, as the server encrypted it
 
-		localBundlePath := filepath.Join(cfg.Bundle.Directory, remoteBundleName)
+		transferName := remoteBundleName
+		if strings.Contains(output, "BUNDLE_ENCRYPTED") {
+			transferName += bundle.EncryptedExt
+		}
+		transferPath := filepath.Join(cfg.Server.RemotePath, transferName)
+		localBundlePath := filepath.Join(cfg.Bundle.Directory, transferName)
+		artifacts.Output(localBundlePath)
 
-	
+		if volumes := parseVolumeOutput(transferName, output); volumes != nil {
+			err = downloadVolumes(client, cfg.Server.RemotePath, localBundlePath, volumes)
+		} else {
+			err = downloadWithProgress(client, transferPath, localBundlePath, "🚀 Downloading bundle")
+		}
 
-		bar := progressbar.DefaultBytes(
+		if err != nil {
 
-			-1, // We'll set the total once the transfer starts and we have the size
+			ui.Red.Printf("❌ Download failed: %v\n", err)
 
-			"🚀 Downloading bundle",
+			exit(1)
 
-		)
+		}
 
 	
 
-		err = client.Download(remoteBundlePath, localBundlePath, func(current, total int64) {
+		info, _ := os.Stat(localBundlePath)
 
-			if bar.GetMax() == -1 && total > 0 {
+		ui.Green.Printf("\n✅ Downloaded: %s (%s)\n", transferName, utils.FormatBytes(info.Size()))
 
-				bar.ChangeMax64(total)
+	
 
+		if strings.Contains(output, "BUNDLE_SIGNED") {
+			if err := client.Download(transferPath+bundle.SignatureExt, localBundlePath+bundle.SignatureExt, nil); err != nil {
+				ui.Red.Printf("❌ Signature download failed: %v\n", err)
+				exit(1)
 			}
+		}
 
-			bar.Set64(current)
-
-		})
-
-	
+		if err := verifyPulledBundle(cfg, localBundlePath); err != nil {
+			ui.Red.Printf("❌ Refusing to merge bundle: %v\n", err)
+			exit(1)
+		}
 
+		// The server's manifest describes the bundle as it was sent
+		manifestPath := bundle.ManifestPath(localBundlePath)
+		artifacts.Output(manifestPath)
+		if err := client.Download(bundle.ManifestPath(remoteBundlePath), manifestPath, nil); err != nil {
+			ui.Red.Printf("❌ Manifest download failed: %v\n", err)
+			exit(1)
+		}
+		sent, err := bundle.LoadManifest(localBundlePath)
+		if err == nil {
+			err = sent.Verify(localBundlePath)
+		}
 		if err != nil {
+			ui.Red.Printf("❌ Downloaded bundle was corrupted in transfer: %v\n", err)
+			exit(1)
+		}
 
-			ui.Red.Printf("❌ Download failed: %v\n", err)
-
-			os.Exit(1)
+		plainBundlePath, _, err := bundle.Open(localBundlePath, cfg.Bundle.Encryption.Identities)
+		if plainBundlePath != localBundlePath {
+			// Tracked on its own so the encrypted bundle named after it is kept
+			artifacts.TemporaryFile(plainBundlePath)
+		}
+		if err != nil {
+			ui.Red.Printf("❌ Cannot read bundle: %v\n", err)
+			if errors.Is(err, bundle.ErrMissingKey) {
+				ui.Yellow.Println("💡 Add the matching age identity or SSH key to bundle.encryption.identities")
+			}
+			exit(1)
+		}
 
+		submodules := parseSubmoduleOutput(output)
+		if err := downloadSubmodules(client, cfg, submodules, strings.Contains(output, "BUNDLE_SIGNED")); err != nil {
+			ui.Red.Printf("❌ Submodule bundle rejected: %v\n", err)
+			exit(1)
 		}
 
-	
+		lfsObjects, _ := strconv.Atoi(remoteValue(output, "LFS_OBJECTS"))
+		if lfsObjects > 0 {
+			lfsName := remoteBundleName + bundle.LFSExt
+			if strings.Contains(output, "BUNDLE_ENCRYPTED") {
+				lfsName += bundle.EncryptedExt
+			}
+			if err := installPulledLFS(cmd.Context(), repo, client, cfg, lfsName, strings.Contains(output, "BUNDLE_SIGNED")); err != nil {
+				ui.Red.Printf("❌ LFS objects rejected: %v\n", err)
+				exit(1)
+			}
+		}
 
-		info, _ := os.Stat(localBundlePath)
+		manifest, err := newSyncManifest(cmd.Context(), repo, cfg, plainBundlePath, bundle.DirectionPull)
+		if err != nil {
+			ui.Red.Printf("❌ Error reading bundle: %v\n", err)
+			exit(1)
+		}
+		if err := manifest.SetArtifact(localBundlePath); err != nil {
+			ui.Red.Printf("❌ %v\n", err)
+			exit(1)
+		}
+		if manifest.CommitCount == 0 {
+			manifest.CommitCount = sent.CommitCount
+		}
+		ui.Cyan.Printf("📋 Bundle carries %d commits on %d refs\n", manifest.CommitCount, len(manifest.Refs))
 
-		ui.Green.Printf("\n✅ Downloaded: %s (%s)\n", remoteBundleName, utils.FormatBytes(info.Size()))
+		if bundle.IsEncrypted(localBundlePath) {
+			ui.Green.Println("🔒 Bundle encrypted:", filepath.Base(localBundlePath))
+		}
 
-	
+		manifest.Encrypted = bundle.IsEncrypted(localBundlePath)
+		manifest.Signed = strings.Contains(output, "BUNDLE_SIGNED")
+		manifest.Submodules = submodules
+		manifest.LFSObjects = lfsObjects
+		if _, err := manifest.Write(localBundlePath); err != nil {
+			ui.Yellow.Printf("⚠️  %v\n", err)
+		}
 
 		// Step 4: Merge bundle into local repo
 
 		s.Suffix = " Merging changes..."
+		if strategy == bundle.StrategyFetchOnly {
+			s.Suffix = " Fetching server branches..."
+		}
 
 		s.Start()
 
 	
 
-		if err := bundle.Merge(localBundlePath, cfg.Project.Branch); err != nil {
-
+		if strategy == bundle.StrategyFetchOnly {
+			// Server branches are mirrored for inspection; nothing local is integrated
+			updates, err := repo.FetchRemote(cmd.Context(), plainBundlePath, cfg.Server.Name)
 			s.Stop()
+			if err != nil {
+				ui.Red.Printf("❌ Fetch failed: %v\n", err)
+				exit(1)
+			}
+			printRefUpdates(cfg.Server.Name, updates)
+			if wip != "" {
+				receivePulledWIP(cmd.Context(), repo, plainBundlePath, false)
+			}
+		} else {
+			// Work in progress applied by an earlier pull would be in the way of the merge
+			if dropped, err := repo.DropWIP(cmd.Context()); err != nil {
+				s.Stop()
+				ui.Red.Printf("❌ Failed to drop the previous work in progress: %v\n", err)
+				exit(1)
+			} else if dropped {
+				ui.Cyan.Println("🧹 Dropped the unchanged work in progress of the previous pull")
+			}
 
-			ui.Red.Printf("❌ Merge failed: %v\n", err)
+			mergeOpts := bundle.MergeOptions{Strategy: strategy, AbortOnConflict: abortOnConflict, Remote: cfg.Server.Name}
+			if err := repo.Merge(cmd.Context(), plainBundlePath, cfg.Project.Branch, mergeOpts); err != nil {
+				s.Stop()
 
-			ui.Yellow.Println("💡 You may need to resolve conflicts manually")
+				var conflict *bundle.ConflictError
+				if errors.As(err, &conflict) {
+					printConflict(conflict)
+					exit(1)
+				}
 
-			os.Exit(1)
+				ui.Red.Printf("❌ Merge failed: %v\n", err)
+				exit(1)
+			}
+			s.Stop()
+			ui.Green.Println("✅ Changes merged successfully!")
 
+			if err := repo.ApplySubmodules(cmd.Context(), cfg.Bundle.Directory, submodules); err != nil {
+				ui.Red.Printf("❌ Submodule update failed: %v\n", err)
+				exit(1)
+			}
+			if len(submodules) > 0 {
+				ui.Green.Printf("📦 Updated %d submodule(s)\n", len(submodules))
+			}
+			if allBranches || len(pullBranches) > 0 {
+				updateServerBranches(cmd.Context(), repo, cfg, plainBundlePath)
+			}
+			if wip != "" {
+				receivePulledWIP(cmd.Context(), repo, plainBundlePath, true)
+			}
 		}
 
 	
 
-		s.Stop()
-
-		ui.Green.Println("✅ Changes merged successfully!")
-
-	
-
-		// Step 5: Cleanup remote bundle
-
-		s.Suffix = " Cleaning up..."
+		// Step 5: Cleanup the server bundle and its sidecars, keeping the local copy
 
-		s.Start()
-
-		client.Run(cmd.Context(), fmt.Sprintf("rm -f '%s'", remoteBundlePath))
-
-		s.Stop()
+		finishArtifacts(true)
 
 	// Step 6: Auto-push to origin (if requested)
 	if autoPush {
 		s.Suffix = " Pushing to origin..."
 		s.Start()
 
-		if err := bundle.PushToOrigin(cfg.Project.Branch); err != nil {
+		if err := repo.PushToOrigin(cmd.Context(), cfg.Project.Branch); err != nil {
 			s.Stop()
 			ui.Yellow.Printf("⚠️  Push to origin failed: %v\n", err)
 			ui.Yellow.Println("💡 Run 'git push origin " + cfg.Project.Branch + "' manually")
@@ -229,19 +421,464 @@ func runPull(cmd *cobra.Command, args []string) {
 	}
 
 	// Success!
-	printPullSuccess(cfg, autoPush)
+	printPullSuccess(cmd.Context(), repo, cfg, autoPush)
+	autoPrune(cfg, client, cfg.Bundle.Directory)
 
 	// Run post-pull hook
 	_ = executeHook("post-pull")
 }
 
-func printPullSuccess(cfg *config.Config, pushed bool) {
+// updateServerBranches creates or fast-forwards the local branches selected with
+// --branch or --all-branches to their tips in the pulled bundle, and reports what
+// happened to each. The configured branch was already integrated with the strategy.
+func updateServerBranches(ctx context.Context, repo *bundle.Repo, cfg *config.Config, bundlePath string) {
+	branches, err := bundle.BundleBranches(bundlePath)
+	if err != nil {
+		ui.Red.Printf("❌ Cannot read the server branches: %v\n", err)
+		exit(1)
+	}
+
+	selected := make(map[string]string)
+	if allBranches {
+		selected = branches
+	} else {
+		matched, unmatched, err := bundle.MatchBranches(branches, pullBranches)
+		if err != nil {
+			ui.Red.Printf("❌ %v\n", err)
+			exit(1)
+		}
+		for _, pattern := range unmatched {
+			ui.Yellow.Printf("⚠️  No server branch matches %s\n", pattern)
+		}
+		for _, name := range matched {
+			selected[name] = branches[name]
+		}
+	}
+	delete(selected, cfg.Project.Branch)
+	if len(selected) == 0 {
+		return
+	}
+
+	updates, err := repo.UpdateBranches(ctx, selected)
+	ui.Green.Println("🌿 Server branches:")
+	printBranchUpdates(updates)
+	if err != nil {
+		ui.Red.Printf("❌ Failed to update local branches: %v\n", err)
+		exit(1)
+	}
+}
+
+// printBranchUpdates lists the new, updated and skipped local branches of a pull.
+func printBranchUpdates(updates []bundle.BranchUpdate) {
+	upToDate := 0
+	for _, u := range updates {
+		switch u.Result {
+		case bundle.BranchCreated:
+			fmt.Printf("   🆕 %-30s %s\n", u.Branch, shortSHA(u.New))
+		case bundle.BranchUpdated:
+			fmt.Printf("   🔄 %-30s %s..%s\n", u.Branch, shortSHA(u.Old), shortSHA(u.New))
+		case bundle.BranchSkipped:
+			ui.Yellow.Printf("   ⏭️  %-30s skipped: %s\n", u.Branch, u.Reason)
+		default:
+			upToDate++
+		}
+	}
+	if upToDate > 0 {
+		fmt.Printf("   ✅ %d branch(es) already up to date\n", upToDate)
+	}
+}
+
+// dryRunPull shows what a pull would download and do to the local repository, without
+// creating, transferring or changing anything.
+func dryRunPull(ctx context.Context, repo *bundle.Repo, client *ssh.Client, cfg *config.Config, strategy bundle.Strategy) {
+	branch := cfg.Project.Branch
+	ui.Cyan.Println("🔍 Dry run: nothing will be created, transferred or changed")
+
+	d, tip, err := serverTip(ctx, repo, client, cfg)
+	if err != nil {
+		ui.Red.Printf("❌ Could not compare with the server: %v\n", err)
+		exit(1)
+	}
+	if tip.Tip == "" {
+		ui.Red.Printf("❌ The server has no %s branch to pull\n", branch)
+		exit(1)
+	}
+	requireStrategy(cfg, d)
+
+	repoPath := filepath.Join(cfg.Server.RemotePath, cfg.Project.Name)
+	output, err := client.Run(ctx, remote.EstimateScript(repoPath, localHaves(ctx, repo), dryRunCommits))
+	if err != nil {
+		ui.Red.Printf("❌ Could not inspect the server repository: %v\n", err)
+		exit(1)
+	}
+	estimate, err := remote.ParseEstimate(output)
+	if err != nil || estimate == nil {
+		ui.Red.Printf("❌ Could not estimate the server bundle: %v\n", err)
+		exit(1)
+	}
+	printPlannedCommits("received", estimate.Commits, estimate.Count)
+	ui.Cyan.Printf("📦 Estimated bundle size: %s\n", utils.FormatBytes(estimate.Size))
+
+	output, err = client.Run(ctx, remote.ListScript(repoPath))
+	if err != nil {
+		ui.Red.Printf("❌ Could not list the server refs: %v\n", err)
+		exit(1)
+	}
+	printPlannedRefs(ctx, repo, cfg, remote.ParseRefs(output))
+	if len(pullBranches) > 0 || allBranches {
+		ui.Cyan.Println("🌿 Matching local branches that are behind would be fast-forwarded, others left alone")
+	}
+	if wipFlag {
+		ui.Cyan.Println("🚧 The server's uncommitted changes, if any, would be applied to the working tree")
+	}
+
+	// The server branch is integrated locally, so the local tip is ours
+	state, conflicts, err := predictOutcome(ctx, repo, strategy, d.Local, tip.Tip, d.Behind, d.Ahead)
+	printPlannedOutcome("locally", state, conflicts, err)
+}
+
+// printPlannedRefs prints the local refs a pull would create or move to the server's
+// branches and tags. Branches land in the server.name namespace.
+func printPlannedRefs(ctx context.Context, repo *bundle.Repo, cfg *config.Config, refs []remote.RemoteRef) {
+	prefix := bundle.RemotePrefix(cfg.Server.Name)
+	local := repo.RefTips(ctx, "refs/")
+
+	var moves []string
+	for _, ref := range refs {
+		if ref.Oid == "" {
+			continue
+		}
+		name := ref.Name
+		if branch, ok := strings.CutPrefix(name, "refs/heads/"); ok {
+			name = prefix + branch
+		}
+		switch old := local[name]; old {
+		case ref.Oid:
+		case "":
+			moves = append(moves, fmt.Sprintf("%s (new at %s)", name, shortSHA(ref.Oid)))
+		default:
+			moves = append(moves, fmt.Sprintf("%s: %s → %s", name, shortSHA(old), shortSHA(ref.Oid)))
+		}
+	}
+	if len(moves) == 0 {
+		ui.Green.Println("✅ No refs would move")
+		return
+	}
+	ui.Cyan.Printf("🏷️  %d ref(s) would move:\n", len(moves))
+	for _, move := range moves {
+		fmt.Printf("   • %s\n", move)
+	}
+}
+
+// localHaves lists the commits at the tips of local refs, so the server can leave
+// everything they contain out of the pulled bundle.
+func localHaves(ctx context.Context, repo *bundle.Repo) []string {
+	seen := make(map[string]bool)
+	var haves []string
+	for _, tip := range repo.RefTips(ctx, "refs/") {
+		if !seen[tip] {
+			seen[tip] = true
+			haves = append(haves, tip)
+		}
+	}
+	sort.Strings(haves)
+	return haves
+}
+
+// receivePulledWIP stores the server's work in progress from the pulled bundle under
+// bundle.ReceivedWIPRef and, with apply, restores it into the working tree.
+func receivePulledWIP(ctx context.Context, repo *bundle.Repo, bundlePath string, apply bool) {
+	wip, err := repo.ReceiveWIP(ctx, bundlePath)
+	if err == nil && wip == "" {
+		err = fmt.Errorf("the bundle does not carry %s", bundle.WIPRef)
+	}
+	if err != nil {
+		ui.Yellow.Printf("⚠️  Failed to read the server's work in progress: %v\n", err)
+		return
+	}
+
+	applied := false
+	if apply {
+		if applied, err = repo.ApplyWIP(ctx, wip); err != nil {
+			ui.Yellow.Printf("⚠️  Failed to apply the server's work in progress: %v\n", err)
+		}
+	}
+	if applied {
+		ui.Green.Println("🚧 Server's work in progress applied to the working tree")
+		return
+	}
+	ui.Yellow.Printf("🚧 Server's work in progress stored in %s, but not applied\n", bundle.ReceivedWIPRef)
+	if apply {
+		ui.Yellow.Println("   your branch is at a different commit or has uncommitted changes")
+	}
+	fmt.Printf("   Apply it with: git stash apply --index %s\n", bundle.ReceivedWIPRef)
+}
+
+// printRefUpdates lists the server branches changed by a fetch-only pull.
+func printRefUpdates(name string, updates []bundle.RefUpdate) {
+	prefix := bundle.RemotePrefix(name)
+	if len(updates) == 0 {
+		ui.Green.Printf("✅ %s* is already up to date\n", prefix)
+		return
+	}
+
+	ui.Green.Printf("✅ Server branches fetched into %s*\n", prefix)
+	for _, u := range updates {
+		ref := strings.TrimPrefix(u.Ref, "refs/remotes/")
+		switch {
+		case u.Old == "":
+			fmt.Printf("   🆕 %-30s %s\n", ref, shortSHA(u.New))
+		case u.New == "":
+			fmt.Printf("   🗑️  %-30s deleted on the server\n", ref)
+		default:
+			fmt.Printf("   🔄 %-30s %s..%s\n", ref, shortSHA(u.Old), shortSHA(u.New))
+		}
+	}
+	ui.Cyan.Printf("💡 Inspect with 'git log --all --graph' or 'git log HEAD..%s/<branch>'\n", name)
+}
+
+// printConflict prints an actionable summary of a conflicted merge, or the conflict
+// as JSON when --json is set.
+func printConflict(conflict *bundle.ConflictError) {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(conflict)
+		return
+	}
+
+	ui.Red.Printf("\n❌ %s of %s stopped on conflicts\n", conflict.Strategy, conflict.Branch)
+	fmt.Printf("   Local:  %s\n", shortSHA(conflict.Ours))
+	fmt.Printf("   Server: %s\n", shortSHA(conflict.Theirs))
+
+	ui.Yellow.Printf("\n📝 Conflicted files (%d):\n", len(conflict.Paths))
+	for _, path := range conflict.Paths {
+		fmt.Println("   •", path)
+	}
+
+	if len(conflict.OursCommits) > 0 || len(conflict.TheirsCommits) > 0 {
+		ui.Cyan.Println("\n🔀 Commits involved:")
+		for _, c := range conflict.OursCommits {
+			fmt.Println("   local  ", c)
+		}
+		for _, c := range conflict.TheirsCommits {
+			fmt.Println("   server ", c)
+		}
+	}
+
+	fmt.Println()
+	if conflict.Aborted {
+		ui.Green.Println("↩️  Merge aborted, your working tree is back to its pre-pull state")
+		ui.Yellow.Println("💡 Try 'gitsync pull --strategy rebase' or resolve on the server first")
+		return
+	}
+
+	ui.Yellow.Println("💡 Run 'gitsync resolve' to walk through the conflicts, or resolve them yourself:")
+	if conflict.Strategy == bundle.StrategyRebase {
+		fmt.Println("   git add <files> && git rebase --continue")
+		fmt.Println("   # or undo with: git rebase --abort")
+	} else {
+		fmt.Println("   git add <files> && git commit --no-edit")
+		fmt.Println("   # or undo with: git merge --abort")
+	}
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// remoteValue returns the value of the first "KEY:value" line in the output of a remote script.
+func remoteValue(output, key string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), key+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// downloadWithProgress downloads a single remote file with a progress bar.
+func downloadWithProgress(client *ssh.Client, remotePath, localPath, label string) error {
+	bar := progressbar.DefaultBytes(
+		-1, // We'll set the total once the transfer starts and we have the size
+		label,
+	)
+
+	return client.Download(remotePath, localPath, func(current, total int64) {
+		if bar.GetMax() == -1 && total > 0 {
+			bar.ChangeMax64(total)
+		}
+		bar.Set64(current)
+	})
+}
+
+// parseVolumeOutput builds a volume manifest from the VOLUME lines printed by the
+// server after splitting a bundle. It returns nil if the bundle was not split.
+func parseVolumeOutput(bundleName, output string) *bundle.VolumeManifest {
+	manifest := &bundle.VolumeManifest{Bundle: bundleName, SHA256: remoteValue(output, "BUNDLE_SHA256")}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Split(strings.TrimPrefix(line, "VOLUME:"), ":")
+		if !strings.HasPrefix(line, "VOLUME:") || len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		manifest.Volumes = append(manifest.Volumes, bundle.Volume{Name: fields[0], Size: size, SHA256: fields[2]})
+		manifest.Size += size
+	}
+
+	if len(manifest.Volumes) == 0 {
+		return nil
+	}
+	return manifest
+}
+
+// parseSubmoduleOutput reads the "SUBMODULE:parent|name|path|file" lines printed by the
+// server bundle script.
+func parseSubmoduleOutput(output string) []bundle.Submodule {
+	var subs []bundle.Submodule
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Split(strings.TrimPrefix(line, "SUBMODULE:"), "|")
+		if !strings.HasPrefix(line, "SUBMODULE:") || len(fields) != 4 {
+			continue
+		}
+		subs = append(subs, bundle.Submodule{Parent: fields[0], Name: fields[1], Path: fields[2], Bundle: fields[3]})
+	}
+	return subs
+}
+
+// downloadSubmodules downloads the submodule bundles next to the main bundle and checks
+// their signatures like the main bundle's.
+func downloadSubmodules(client *ssh.Client, cfg *config.Config, submodules []bundle.Submodule, signed bool) error {
+	for i, sub := range submodules {
+		remotePath := filepath.Join(cfg.Server.RemotePath, sub.Bundle)
+		localPath := filepath.Join(cfg.Bundle.Directory, sub.Bundle)
+		// Submodules are applied from the bundle or its plaintext and removed once the
+		// pull ends, along with their signatures
+		artifacts.Temporary(strings.TrimSuffix(localPath, bundle.EncryptedExt))
+
+		if err := client.Download(remotePath, localPath, nil); err != nil {
+			return fmt.Errorf("%s: %w", sub.FullPath(), err)
+		}
+		if signed {
+			if err := client.Download(remotePath+bundle.SignatureExt, localPath+bundle.SignatureExt, nil); err != nil {
+				return fmt.Errorf("%s: %w", sub.FullPath(), err)
+			}
+		}
+		if err := verifyPulledBundle(cfg, localPath); err != nil {
+			return fmt.Errorf("%s: %w", sub.FullPath(), err)
+		}
+
+		if bundle.IsEncrypted(localPath) {
+			plainPath := strings.TrimSuffix(localPath, bundle.EncryptedExt)
+			err := bundle.Decrypt(localPath, plainPath, cfg.Bundle.Encryption.Identities)
+			os.Remove(localPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", sub.FullPath(), err)
+			}
+			submodules[i].Bundle = filepath.Base(plainPath)
+		}
+	}
+	return nil
+}
+
+// installPulledLFS downloads the server's LFS object archive, checks its signature like
+// the bundle's, decrypts it if the server encrypted it, and installs the objects into the
+// local LFS store before merging, so that checking out LFS files does not need the LFS
+// endpoint.
+func installPulledLFS(ctx context.Context, repo *bundle.Repo, client *ssh.Client, cfg *config.Config, name string, signed bool) error {
+	remotePath := filepath.Join(cfg.Server.RemotePath, name)
+	localPath := filepath.Join(cfg.Bundle.Directory, name)
+	defer os.Remove(localPath)
+
+	if err := downloadWithProgress(client, remotePath, localPath, "🗃️  Downloading LFS objects"); err != nil {
+		return err
+	}
+	if signed {
+		if err := client.Download(remotePath+bundle.SignatureExt, localPath+bundle.SignatureExt, nil); err != nil {
+			return err
+		}
+		defer os.Remove(localPath + bundle.SignatureExt)
+	}
+	if err := verifyPulledBundle(cfg, localPath); err != nil {
+		return err
+	}
+
+	plainPath, cleanupPlain, err := bundle.Open(localPath, cfg.Bundle.Encryption.Identities)
+	if err != nil {
+		return err
+	}
+	defer cleanupPlain()
+
+	n, err := repo.InstallLFS(ctx, plainPath)
+	if err != nil {
+		return err
+	}
+	ui.Green.Printf("\n🗃️  Installed %d LFS object(s)\n", n)
+	return nil
+}
+
+// downloadVolumes downloads every part of a split bundle and reassembles it at
+// localBundlePath, refusing missing or corrupt parts.
+func downloadVolumes(client *ssh.Client, remoteDir, localBundlePath string, manifest *bundle.VolumeManifest) error {
+	localDir := filepath.Dir(localBundlePath)
+	for i, vol := range manifest.Volumes {
+		label := fmt.Sprintf("🚀 Downloading volume %d/%d", i+1, len(manifest.Volumes))
+		if err := downloadWithProgress(client, filepath.Join(remoteDir, vol.Name), filepath.Join(localDir, vol.Name), label); err != nil {
+			return fmt.Errorf("volume %s: %w", vol.Name, err)
+		}
+	}
+
+	manifestPath := localBundlePath + bundle.VolumeManifestExt
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal volume manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write volume manifest: %w", err)
+	}
+
+	if err := bundle.Join(manifestPath, localBundlePath); err != nil {
+		return err
+	}
+	return bundle.RemoveVolumes(manifestPath)
+}
+
+// verifyPulledBundle checks the signature of a downloaded bundle against the configured
+// allowed signers. Unsigned bundles are only accepted outside strict mode.
+func verifyPulledBundle(cfg *config.Config, bundlePath string) error {
+	signing := cfg.Bundle.Signing
+	if signing.AllowedSigners == "" {
+		if signing.Strict {
+			return fmt.Errorf("strict signing requires bundle.signing.allowed_signers")
+		}
+		return nil
+	}
+
+	principal, err := bundle.Verify(bundlePath, signing.AllowedSigners)
+	if errors.Is(err, bundle.ErrUnsigned) && !signing.Strict {
+		ui.Yellow.Println("⚠️  Bundle is not signed, skipping verification")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.Green.Println("🔏 Signature verified:", principal)
+	return nil
+}
+
+func printPullSuccess(ctx context.Context, repo *bundle.Repo, cfg *config.Config, pushed bool) {
 	ui.Green.Println("\n" + strings.Repeat("═", 50))
 	ui.Green.Println("          🎉 PULL SUCCESSFUL! 🎉")
 	ui.Green.Println(strings.Repeat("═", 50))
 
 	ui.Cyan.Println("\n📊 Latest commits:")
-	bundle.ShowRecentCommits(5)
+	repo.ShowRecentCommits(ctx, 5)
 
 	if !pushed {
 		ui.Yellow.Println("\n💡 Don't forget to push to GitHub:")
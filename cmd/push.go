@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"github.com/schollz/progressbar/v3"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/remote"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
 	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
@@ -18,8 +20,17 @@ import (
 )
 
 var (
-	fullPush   bool
-	includeAll bool
+	fullPush       bool
+	includeAll     bool
+	volumeSizeFlag string
+	strategyFlag   string
+	pushDepth      int
+	pushSince      string
+	pushFilter     string
+	wipFlag        bool
+	wipUntracked   bool
+	pushFormat     string
+	pushDryRun     bool
 )
 
 var pushCmd = &cobra.Command{
@@ -30,23 +41,42 @@ var pushCmd = &cobra.Command{
 Examples:
   gitsync push           # Push new commits only
   gitsync push --full    # Push entire repository
-  gitsync push --all     # Include all branches`,
+  gitsync push --all     # Include all branches
+  gitsync push --depth 50          # First push with the last 50 commits only
+  gitsync push --since 2024-01-01  # First push with history since a date
+  gitsync push --filter blob:none  # First push without old file contents
+  gitsync push --wip               # Also send uncommitted changes
+  gitsync push --format patch      # Send new commits as a patch series for git am (push only)
+  gitsync push --volume-size 500M  # Split into 500 MB volumes
+  gitsync push --dry-run           # Show what a push would do without doing it`,
 	Run: runPush,
 }
 
 func init() {
 	pushCmd.Flags().BoolVarP(&fullPush, "full", "f", false, "Push entire repository (not just new commits)")
 	pushCmd.Flags().BoolVarP(&includeAll, "all", "a", false, "Include all branches")
+	pushCmd.Flags().StringVar(&volumeSizeFlag, "volume-size", "", "Split the bundle into volumes of this size (e.g. 500M)")
+	pushCmd.Flags().StringVar(&strategyFlag, "strategy", "", "How the server integrates the bundle: merge, rebase, ff-only or fetch-only")
+	pushCmd.Flags().IntVar(&pushDepth, "depth", 0, "Push only the last N commits of each branch, leaving a shallow server repository")
+	pushCmd.Flags().StringVar(&pushSince, "since", "", "Push only history since a date (e.g. 2024-01-01 or '6 months ago')")
+	pushCmd.Flags().StringVar(&pushFilter, "filter", "", "Leave objects out of a full push (e.g. blob:none or blob:limit=1m), leaving a partial server repository")
+	pushCmd.Flags().BoolVar(&wipFlag, "wip", false, "Also send uncommitted changes and apply them to the server's working tree without committing them")
+	pushCmd.Flags().BoolVar(&wipUntracked, "untracked", false, "With --wip, include untracked files that are not ignored")
+	pushCmd.Flags().StringVar(&pushFormat, "format", "", "How commits are sent: bundle or patch (a patch series applied with git am to the checked-out branch; pull always uses bundles)")
+	pushCmd.Flags().BoolVar(&keepArtifacts, "keep-artifacts", false, "Leave the bundle and its sidecars in place locally and on the server, even after a failed push, for debugging")
+	pushCmd.Flags().BoolVar(&pushDryRun, "dry-run", false, "Show the commits, bundle size and server outcome of a push without creating, transferring or changing anything")
 }
 
 func runPush(cmd *cobra.Command, args []string) {
 	printBanner()
 	ui.Green.Println("\n📤 Pushing to Remote Server")
 
-	// Run pre-push hook
-	if err := executeHook("pre-push"); err != nil {
-		ui.Red.Printf("❌ pre-push hook failed: %v\n", err)
-		os.Exit(1)
+	// Run pre-push hook; a dry run changes nothing for it to guard
+	if !pushDryRun {
+		if err := executeHook("pre-push"); err != nil {
+			ui.Red.Printf("❌ pre-push hook failed: %v\n", err)
+			exit(1)
+		}
 	}
 
 	// Load config
@@ -54,7 +84,89 @@ func runPush(cmd *cobra.Command, args []string) {
 	if err != nil {
 		ui.Red.Printf("❌ Error loading config: %v\n", err)
 		ui.Yellow.Println("💡 Run 'gitsync init' first!")
-		os.Exit(1)
+		exit(1)
+	}
+
+	if cfg.Bundle.Encryption.Enabled() && cfg.Bundle.Encryption.RemoteIdentity == "" {
+		ui.Red.Println("❌ Bundle encryption is enabled but bundle.encryption.remote_identity is not set")
+		ui.Yellow.Println("💡 The server needs an age identity to decrypt pushed bundles")
+		exit(1)
+	}
+
+	if cfg.Bundle.Signing.Strict && cfg.Bundle.Signing.Key == "" {
+		ui.Red.Println("❌ Strict signing is enabled but bundle.signing.key is not set")
+		exit(1)
+	}
+
+	volumeSize, err := resolveVolumeSize(cfg)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+
+	shallowOpts := bundle.ShallowOptions{Depth: pushDepth, Since: pushSince}
+	if pushDepth > 0 && pushSince != "" {
+		ui.Red.Println("❌ --depth and --since cannot be used together")
+		exit(1)
+	}
+	if pushFilter != "" && shallowOpts.Enabled() {
+		ui.Red.Println("❌ --filter cannot be combined with --depth or --since")
+		exit(1)
+	}
+	if wipFlag && (pushFilter != "" || shallowOpts.Enabled()) {
+		ui.Red.Println("❌ --wip cannot be combined with --filter, --depth or --since")
+		exit(1)
+	}
+
+	strategy, err := resolveStrategy(cfg)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+
+	format, err := resolveFormat(cfg)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+
+	if err := remote.ValidateLayout(cfg.Server.Layout); err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+	if format == bundle.FormatPatch {
+		if fullPush || volumeSizeFlag != "" || shallowOpts.Enabled() || pushFilter != "" || wipFlag {
+			ui.Red.Println("❌ --format patch cannot be combined with --full, --volume-size, --depth, --since, --filter or --wip")
+			exit(1)
+		}
+		if cfg.Bundle.Encryption.Enabled() {
+			ui.Red.Println("❌ Patch series cannot be encrypted; push a bundle or disable bundle encryption")
+			exit(1)
+		}
+	}
+	if pushDryRun {
+		dryRunPush(cmd, cfg, strategy, format)
+		return
+	}
+
+	ctx := cmd.Context()
+	repo := bundle.NewRepo(".")
+
+	// Compare with the server before anything is created, so a push that cannot go
+	// ahead leaves nothing behind
+	client, err := ssh.NewClient(cfg.Server)
+	if err != nil {
+		ui.Red.Printf("❌ SSH connection failed: %v\n", err)
+		exit(1)
+	}
+	defer client.Close()
+
+	if d := checkDivergence(ctx, repo, client, cfg); d != nil && d.State == bundle.SyncBehind {
+		ui.Yellow.Println("💡 The server has commits you do not; run 'gitsync pull' to get them")
+	}
+	if format == bundle.FormatPatch {
+		pushPatches(ctx, repo, client, cfg)
+		return
 	}
 
 	// Start spinner
@@ -67,33 +179,166 @@ func runPush(cmd *cobra.Command, args []string) {
 	timestamp := time.Now().Format("20060102-150405")
 	bundleName := fmt.Sprintf("%s-%s.bundle", cfg.Project.Name, timestamp)
 	bundlePath := filepath.Join(cfg.Bundle.Directory, bundleName)
+	trackArtifacts()
+	artifacts.Output(bundlePath)
+
+	wip := ""
+	if wipFlag {
+		if wip, err = repo.CaptureWIP(ctx, wipUntracked); err != nil {
+			s.Stop()
+			ui.Red.Printf("❌ Error capturing uncommitted changes: %v\n", err)
+			exit(1)
+		}
+	}
 
 	var bundleErr error
-	if fullPush {
-		bundleErr = bundle.CreateFull(bundlePath)
+	var shallow []string
+	if wip != "" {
+		bundleErr = repo.CreateWIP(ctx, bundlePath, cfg.Project.Branch, wip, fullPush)
+	} else if shallowOpts.Enabled() {
+		shallow, bundleErr = repo.CreateShallow(ctx, bundlePath, shallowOpts)
+		// The boundary is sent in the setup script, the file next to the bundle is only read locally
+		artifacts.Temporary(bundlePath + bundle.ShallowExt)
+	} else if pushFilter != "" {
+		// The files of the pushed branch are always sent so the server can check it out
+		bundleErr = repo.CreateFiltered(ctx, bundlePath, bundle.FilterOptions{
+			Spec:     pushFilter,
+			Checkout: []string{cfg.Project.Branch},
+		})
+	} else if fullPush {
+		bundleErr = repo.CreateFull(ctx, bundlePath)
 	} else {
-		bundleErr = bundle.CreateIncremental(bundlePath, cfg.Project.Branch)
+		bundleErr = repo.CreateIncremental(ctx, bundlePath, cfg.Project.Branch)
 	}
 
 	s.Stop()
 
 	if bundleErr != nil {
 		// If incremental fails, try full
-		if !fullPush {
+		if !fullPush && !shallowOpts.Enabled() && pushFilter == "" && wip == "" {
 			ui.Yellow.Println("⚠️  Incremental push failed. Attempting full bundle...")
 			s.Suffix = " Creating full bundle..."
 			s.Start()
-			bundleErr = bundle.CreateFull(bundlePath)
+			bundleErr = repo.CreateFull(ctx, bundlePath)
 			s.Stop()
 		}
 
 		if bundleErr != nil {
 			ui.Red.Printf("❌ Error creating bundle: %v\n", bundleErr)
-			os.Exit(1)
+			exit(1)
 		}
 	}
 
 	ui.Green.Println("✅ Bundle created:", bundleName)
+	if len(shallow) > 0 {
+		ui.Cyan.Printf("✂️  Shallow history: %d boundary commit(s), older history stays local\n", len(shallow))
+	}
+	if pushFilter != "" {
+		ui.Cyan.Printf("🧩 Objects filtered with %s, the server becomes a partial clone\n", pushFilter)
+	}
+	if wip != "" {
+		ui.Cyan.Printf("🚧 Uncommitted changes included as work in progress (%s)\n", shortSHA(wip))
+	} else if wipFlag {
+		ui.Yellow.Println("⚠️  No uncommitted changes to send as work in progress")
+	}
+
+	submodules, err := repo.CreateSubmoduleBundles(ctx, bundlePath)
+	if err != nil {
+		ui.Red.Printf("❌ Error bundling submodules: %v\n", err)
+		exit(1)
+	}
+	if len(submodules) > 0 {
+		ui.Green.Printf("📦 Bundled %d submodule(s)\n", len(submodules))
+	}
+
+	lfs, err := repo.PackLFS(ctx, bundlePath)
+	if err != nil {
+		ui.Red.Printf("❌ Error packing LFS objects: %v\n", err)
+		exit(1)
+	}
+	lfsArchive := ""
+	if lfs != nil {
+		if len(lfs.Missing) > 0 {
+			ui.Yellow.Printf("⚠️  %d LFS object(s) are not in the local store and will not be sent\n", len(lfs.Missing))
+			ui.Yellow.Println("💡 Run 'git lfs fetch' to download them first")
+		}
+		if lfs.Path != "" {
+			lfsArchive = lfs.Path
+			ui.Green.Printf("🗃️  Packed %d LFS object(s)\n", len(lfs.Objects))
+		}
+	}
+
+	manifest, err := newSyncManifest(ctx, repo, cfg, bundlePath, bundle.DirectionPush)
+	if err != nil {
+		ui.Red.Printf("❌ Error reading bundle: %v\n", err)
+		exit(1)
+	}
+
+	if cfg.Bundle.Encryption.Enabled() {
+		bundlePath, err = bundle.Encrypt(bundlePath, cfg.Bundle.Encryption.Recipients)
+		if err != nil {
+			ui.Red.Printf("❌ Error encrypting bundle: %v\n", err)
+			exit(1)
+		}
+		bundleName = filepath.Base(bundlePath)
+		ui.Green.Println("🔒 Bundle encrypted:", bundleName)
+	}
+
+	// Submodule bundles and LFS objects are shipped like the main bundle: encrypted, then signed
+	for i, sub := range submodules {
+		subPath, err := protectSidecar(cfg, filepath.Join(cfg.Bundle.Directory, sub.Bundle))
+		if err != nil {
+			ui.Red.Printf("❌ Error protecting submodule %s: %v\n", sub.FullPath(), err)
+			exit(1)
+		}
+		submodules[i].Bundle = filepath.Base(subPath)
+	}
+	if lfsArchive != "" {
+		if lfsArchive, err = protectSidecar(cfg, lfsArchive); err != nil {
+			ui.Red.Printf("❌ Error protecting LFS objects: %v\n", err)
+			exit(1)
+		}
+	}
+
+	sigPath := ""
+	if cfg.Bundle.Signing.Key != "" {
+		sigPath, err = bundle.Sign(bundlePath, cfg.Bundle.Signing.Key)
+		if err != nil {
+			ui.Red.Printf("❌ Error signing bundle: %v\n", err)
+			exit(1)
+		}
+		ui.Green.Println("🔏 Bundle signed:", filepath.Base(sigPath))
+	}
+
+	var volumes *bundle.VolumeManifest
+	var volumeManifestPath string
+	if volumeSize > 0 {
+		volumes, volumeManifestPath, err = bundle.Split(bundlePath, volumeSize)
+		if err != nil {
+			ui.Red.Printf("❌ Error splitting bundle: %v\n", err)
+			exit(1)
+		}
+		ui.Green.Printf("✂️  Bundle split into %d volumes of up to %s\n", len(volumes.Volumes), utils.FormatBytes(volumeSize))
+	}
+
+	manifest.Encrypted = bundle.IsEncrypted(bundlePath)
+	manifest.Signed = sigPath != ""
+	if err := manifest.SetArtifact(bundlePath); err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+	if volumes != nil {
+		manifest.Volumes = len(volumes.Volumes)
+	}
+	manifest.Submodules = submodules
+	if lfsArchive != "" {
+		manifest.LFSObjects = len(lfs.Objects)
+	}
+	manifestPath, err := manifest.Write(bundlePath)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
 
 	// Get bundle size
 	info, _ := os.Stat(bundlePath)
@@ -103,28 +348,61 @@ func runPush(cmd *cobra.Command, args []string) {
 	s.Suffix = fmt.Sprintf(" Transferring to %s@%s...", cfg.Server.User, cfg.Server.Host)
 	s.Start()
 
-	client, err := ssh.NewClient(cfg.Server)
-	if err != nil {
-		s.Stop()
-		ui.Red.Printf("❌ SSH connection failed: %v\n", err)
-		os.Exit(1)
-	}
-	defer client.Close()
-
 	remoteBundlePath := filepath.Join(cfg.Server.RemotePath, bundleName)
-	
-	bar := progressbar.DefaultBytes(
-		info.Size(),
-		"🚀 Uploading bundle",
-	)
+	// Volumes and sidecars are named after the bundle before encryption
+	artifacts.Remote(client, strings.TrimSuffix(remoteBundlePath, bundle.EncryptedExt))
 
-	err = client.Upload(bundlePath, remoteBundlePath, func(current, total int64) {
-		bar.Set64(current)
-	})
+	if volumes != nil {
+		err = uploadVolumes(client, bundlePath, cfg.Server.RemotePath, volumes)
+		if err == nil {
+			err = client.Upload(volumeManifestPath, remoteBundlePath+bundle.VolumeManifestExt, nil)
+		}
+	} else {
+		bar := progressbar.DefaultBytes(
+			info.Size(),
+			"🚀 Uploading bundle",
+		)
+
+		err = client.Upload(bundlePath, remoteBundlePath, func(current, total int64) {
+			bar.Set64(current)
+		})
+	}
 
 	if err != nil {
 		ui.Red.Printf("❌ Upload failed: %v\n", err)
-		os.Exit(1)
+		exit(1)
+	}
+
+	if volumes != nil {
+		_ = bundle.RemoveVolumes(volumeManifestPath)
+	}
+
+	if err := client.Upload(manifestPath, bundle.ManifestPath(remoteBundlePath), nil); err != nil {
+		ui.Red.Printf("\n❌ Manifest upload failed: %v\n", err)
+		exit(1)
+	}
+
+	if sigPath != "" {
+		if err := client.Upload(sigPath, remoteBundlePath+bundle.SignatureExt, nil); err != nil {
+			ui.Red.Printf("\n❌ Signature upload failed: %v\n", err)
+			exit(1)
+		}
+	}
+
+	for _, sub := range submodules {
+		if err := uploadSidecar(client, cfg, sub.Bundle); err != nil {
+			ui.Red.Printf("\n❌ Submodule upload failed: %s: %v\n", sub.FullPath(), err)
+			exit(1)
+		}
+	}
+
+	remoteLFSArchive := ""
+	if lfsArchive != "" {
+		if err := uploadSidecar(client, cfg, filepath.Base(lfsArchive)); err != nil {
+			ui.Red.Printf("\n❌ LFS object upload failed: %v\n", err)
+			exit(1)
+		}
+		remoteLFSArchive = filepath.Join(cfg.Server.RemotePath, filepath.Base(lfsArchive))
 	}
 
 	ui.Green.Println("\n✅ Bundle transferred successfully!")
@@ -134,57 +412,449 @@ func runPush(cmd *cobra.Command, args []string) {
 	s.Start()
 
 	remoteRepoPath := filepath.Join(cfg.Server.RemotePath, cfg.Project.Name)
-	setupScript := generateSetupScript(remoteBundlePath, remoteRepoPath, cfg.Project.Branch)
+	setupScript := remote.SetupScript(remote.SetupOptions{
+		BundlePath:     remoteBundlePath,
+		RepoPath:       remoteRepoPath,
+		Branch:         cfg.Project.Branch,
+		Identity:       cfg.Bundle.Encryption.RemoteIdentity,
+		AllowedSigners: cfg.Bundle.Signing.RemoteAllowedSigners,
+		Strict:         cfg.Bundle.Signing.Strict,
+		Volumes:        volumes,
+		Strategy:       strategy,
+		Submodules:     submodules,
+		LFSArchive:     remoteLFSArchive,
+		Shallow:        shallow,
+		Filter:         pushFilter,
+		WIP:            wip,
+		Bare:           cfg.Server.Layout == remote.LayoutBare,
+		Worktrees:      serverWorktrees(cfg),
+		Remote:         cfg.Server.Name,
+	})
 
 	output, err := client.Run(cmd.Context(), setupScript)
 	s.Stop()
 
-	if err != nil {
+	outcome, parseErr := remote.ParseOutcome(output)
+	if parseErr == nil && outcome.Failed() {
+		printRemoteFailure(cfg, outcome, nil)
+		exit(1)
+	}
+
+	if err != nil || parseErr != nil {
+		if err == nil {
+			err = parseErr
+		}
 		ui.Red.Printf("❌ Remote setup failed: %v\n", err)
 		if verbose {
 			fmt.Println("Output:", output)
 		}
-		os.Exit(1)
+		exit(1)
+	}
+
+	// Remember the server's shallow boundary so later incremental bundles stay within it
+	if shallowOpts.Enabled() {
+		err = repo.SaveShallow(ctx, shallow)
+	} else if outcome.State == remote.StateCloned {
+		err = repo.SaveShallow(ctx, nil)
+	}
+	if err != nil {
+		ui.Yellow.Printf("⚠️  Failed to record the shallow boundary: %v\n", err)
 	}
 
 	// Success!
-	printPushSuccess(cfg, bundleName)
+	printWIPOutcome(outcome.WIP)
+	printPushSuccess(cfg, bundleName, outcome)
+	finishArtifacts(true)
+	autoPrune(cfg, client, cfg.Bundle.Directory)
 
 	// Run post-push hook
 	_ = executeHook("post-push")
 }
 
-func generateSetupScript(bundlePath, repoPath, branch string) string {
-	return fmt.Sprintf(`
-		set -e
-		
-		BUNDLE_PATH="%s"
-		REPO_PATH="%s"
-		BRANCH="%s"
-		
-		if [ ! -d "$REPO_PATH/.git" ]; then
-			echo "📂 Cloning from bundle..."
-			git clone "$BUNDLE_PATH" "$REPO_PATH"
-			cd "$REPO_PATH"
-			git checkout "$BRANCH" 2>/dev/null || git checkout -b "$BRANCH"
-		else
-			echo "🔄 Updating existing repository..."
-			cd "$REPO_PATH"
-			
-			# Add bundle as remote temporarily
-			git remote add bundle "$BUNDLE_PATH" 2>/dev/null || git remote set-url bundle "$BUNDLE_PATH"
-			
-			# Fetch and merge
-			git fetch bundle
-			git merge bundle/"$BRANCH" --no-edit 2>/dev/null || git merge bundle/master --no-edit 2>/dev/null || true
-			
-			# Cleanup
-			git remote remove bundle 2>/dev/null || true
-		fi
-	`, bundlePath, repoPath, branch)
-}
-
-func printPushSuccess(cfg *config.Config, bundleName string) {
+// pushPatches sends the new commits of the branch as a patch series made with git
+// format-patch, which the server applies with git am, instead of a bundle.
+func pushPatches(ctx context.Context, repo *bundle.Repo, client *ssh.Client, cfg *config.Config) {
+	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+	s.Suffix = " Creating patch series..."
+	s.Start()
+
+	timestamp := time.Now().Format("20060102-150405")
+	patchName := fmt.Sprintf("%s-%s%s", cfg.Project.Name, timestamp, bundle.PatchExt)
+	patchPath := filepath.Join(cfg.Bundle.Directory, patchName)
+	trackArtifacts()
+	artifacts.Output(patchPath)
+	tip := repo.Tip(ctx, cfg.Project.Branch)
+	patches, err := repo.CreatePatches(ctx, patchPath, cfg.Project.Branch, cfg.Server.Name)
+	s.Stop()
+	if err != nil {
+		ui.Red.Printf("❌ Error creating patch series: %v\n", err)
+		exit(1)
+	}
+	ui.Green.Printf("✅ Patch series created: %s (%d patch(es))\n", patchName, len(patches))
+
+	manifest, err := repo.NewPatchManifest(ctx, patchPath, bundle.DirectionPush, cfg.Project.Branch, patches)
+	if err != nil {
+		ui.Red.Printf("❌ Error reading patch series: %v\n", err)
+		exit(1)
+	}
+	describeManifest(manifest, cfg)
+	manifest.Compressed = false
+
+	sigPath := ""
+	if cfg.Bundle.Signing.Key != "" {
+		sigPath, err = bundle.Sign(patchPath, cfg.Bundle.Signing.Key)
+		if err != nil {
+			ui.Red.Printf("❌ Error signing patch series: %v\n", err)
+			exit(1)
+		}
+		ui.Green.Println("🔏 Patch series signed:", filepath.Base(sigPath))
+	}
+	manifest.Signed = sigPath != ""
+	manifestPath, err := manifest.Write(patchPath)
+	if err != nil {
+		ui.Red.Printf("❌ %v\n", err)
+		exit(1)
+	}
+
+	s.Suffix = fmt.Sprintf(" Transferring to %s@%s...", cfg.Server.User, cfg.Server.Host)
+	s.Start()
+
+	remotePatchPath := filepath.Join(cfg.Server.RemotePath, patchName)
+	artifacts.Remote(client, remotePatchPath)
+	uploads := [][2]string{
+		{patchPath, remotePatchPath},
+		{manifestPath, bundle.ManifestPath(remotePatchPath)},
+	}
+	if sigPath != "" {
+		uploads = append(uploads, [2]string{sigPath, remotePatchPath + bundle.SignatureExt})
+	}
+	for _, u := range uploads {
+		if err := client.Upload(u[0], u[1], nil); err != nil {
+			s.Stop()
+			ui.Red.Printf("❌ Upload failed: %v\n", err)
+			exit(1)
+		}
+	}
+	s.Stop()
+	ui.Green.Println("✅ Patch series transferred successfully!")
+
+	s.Suffix = " Applying patches on server..."
+	s.Start()
+	setupScript := remote.SetupScript(remote.SetupOptions{
+		BundlePath:     remotePatchPath,
+		RepoPath:       filepath.Join(cfg.Server.RemotePath, cfg.Project.Name),
+		Branch:         cfg.Project.Branch,
+		AllowedSigners: cfg.Bundle.Signing.RemoteAllowedSigners,
+		Strict:         cfg.Bundle.Signing.Strict,
+		Patch:          true,
+		Bare:           cfg.Server.Layout == remote.LayoutBare,
+		Worktrees:      serverWorktrees(cfg),
+		Remote:         cfg.Server.Name,
+	})
+	output, err := client.Run(ctx, setupScript)
+	s.Stop()
+
+	outcome, parseErr := remote.ParseOutcome(output)
+	if parseErr == nil && outcome.Failed() {
+		printRemoteFailure(cfg, outcome, patches)
+		exit(1)
+	}
+
+	if err != nil || parseErr != nil {
+		if err == nil {
+			err = parseErr
+		}
+		ui.Red.Printf("❌ Remote setup failed: %v\n", err)
+		if verbose {
+			fmt.Println("Output:", output)
+		}
+		exit(1)
+	}
+
+	// The server's copies of the commits have new ids; remember what it has
+	if err := repo.MarkPatched(ctx, cfg.Project.Branch, tip); err != nil {
+		ui.Yellow.Printf("⚠️  Failed to record the patched commits: %v\n", err)
+	}
+
+	printPatches(patches, outcome)
+	printPushSuccess(cfg, patchName, outcome)
+	ui.Yellow.Println("💡 The server committed the patches under new ids; pull with --strategy rebase to pick them up")
+	finishArtifacts(true)
+	autoPrune(cfg, client, cfg.Bundle.Directory)
+
+	_ = executeHook("post-push")
+}
+
+// dryRunPush connects to the server and shows what a push would send and what the
+// server would make of it, without creating, transferring or changing anything.
+func dryRunPush(cmd *cobra.Command, cfg *config.Config, strategy bundle.Strategy, format string) {
+	ctx := cmd.Context()
+	repo := bundle.NewRepo(".")
+	branch := cfg.Project.Branch
+	ui.Cyan.Println("🔍 Dry run: nothing will be created, transferred or changed")
+
+	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+	s.Suffix = fmt.Sprintf(" Connecting to %s...", cfg.Server.Host)
+	s.Start()
+	client, err := ssh.NewClient(cfg.Server)
+	s.Stop()
+	if err != nil {
+		ui.Red.Printf("❌ SSH connection failed: %v\n", err)
+		exit(1)
+	}
+	defer client.Close()
+	ui.Green.Println("✅ Connected to server")
+
+	d, tip, err := serverTip(ctx, repo, client, cfg)
+	if err != nil {
+		ui.Red.Printf("❌ Could not compare with the server: %v\n", err)
+		exit(1)
+	}
+	requireStrategy(cfg, d)
+
+	// The same commits the bundle or patch series would contain
+	tips := []string{"refs/heads/" + branch}
+	exclude := []string{"refs/remotes/origin/" + branch}
+	switch {
+	case format == bundle.FormatPatch:
+		exclude = append(exclude, bundle.RemotePrefix(cfg.Server.Name)+branch, bundle.PatchedPrefix+branch)
+	case fullPush || repo.Resolve(ctx, exclude[0]) == "":
+		tips, exclude = []string{"--all"}, nil
+	default:
+		exclude = append(exclude, repo.ShallowBoundary(ctx)...)
+	}
+	commits, count := repo.Commits(ctx, tips, exclude, dryRunCommits)
+	printPlannedCommits("sent", commits, count)
+
+	if format == bundle.FormatBundle {
+		size, err := repo.EstimateSize(ctx, tips, exclude)
+		if err != nil {
+			ui.Yellow.Printf("⚠️  Could not estimate the bundle size: %v\n", err)
+		} else {
+			ui.Cyan.Printf("📦 Estimated bundle size: %s\n", utils.FormatBytes(size))
+		}
+		if pushDepth > 0 || pushSince != "" || pushFilter != "" {
+			ui.Yellow.Println("   The estimate is for the whole history; --depth, --since and --filter send less")
+		}
+	}
+	if wipFlag {
+		if has, err := repo.HasWIP(ctx, wipUntracked); err != nil {
+			ui.Yellow.Printf("⚠️  Could not read uncommitted changes: %v\n", err)
+		} else if has {
+			ui.Cyan.Println("🚧 Uncommitted changes would be sent as work in progress")
+		} else {
+			ui.Yellow.Println("⚠️  No uncommitted changes to send as work in progress")
+		}
+	}
+
+	if tip.Tip == "" {
+		ui.Cyan.Printf("🔀 Outcome on server: %s would be created at %s\n", branch, shortSHA(d.Local))
+		return
+	}
+	ui.Cyan.Printf("🏷️  Server %s: %s → %s\n", branch, shortSHA(tip.Tip), shortSHA(d.Local))
+	if len(tip.Dirty) > 0 && cfg.Server.Layout == remote.LayoutBare && format == bundle.FormatBundle {
+		ui.Yellow.Printf("🔀 Outcome on server: %s, the worktree has uncommitted changes in %d file(s) and is left alone:\n", remote.StateReceived, len(tip.Dirty))
+		for _, path := range tip.Dirty {
+			fmt.Printf("   • %s\n", path)
+		}
+		return
+	}
+	if len(tip.Dirty) > 0 && (strategy != bundle.StrategyFetchOnly || format == bundle.FormatPatch) {
+		ui.Red.Printf("🔀 Outcome on server: %s, uncommitted changes in %d file(s):\n", remote.StateDirtyTreeBlocked, len(tip.Dirty))
+		for _, path := range tip.Dirty {
+			fmt.Printf("   • %s\n", path)
+		}
+		return
+	}
+	if format == bundle.FormatPatch {
+		// git am applies the series on top of whatever the server has, like a rebase
+		state, conflicts, err := predictOutcome(ctx, repo, bundle.StrategyRebase, tip.Tip, d.Local, d.Ahead, d.Behind)
+		switch state {
+		case remote.StateConflicted:
+			state = remote.StatePatchFailed
+		case remote.StateFastForwarded, remote.StateRebased:
+			state = remote.StatePatched
+		}
+		printPlannedOutcome("on server", state, conflicts, err)
+		return
+	}
+	state, conflicts, err := predictOutcome(ctx, repo, strategy, tip.Tip, d.Local, d.Ahead, d.Behind)
+	printPlannedOutcome("on server", state, conflicts, err)
+}
+
+// resolveFormat returns the transport format from --format or the bundle.format setting.
+func resolveFormat(cfg *config.Config) (string, error) {
+	format := pushFormat
+	if format == "" {
+		format = cfg.Bundle.Format
+	}
+	if format == "" {
+		return bundle.FormatBundle, nil
+	}
+	return format, bundle.ValidateFormat(format)
+}
+
+// resolveStrategy returns the merge strategy from --strategy or the project.strategy setting.
+func resolveStrategy(cfg *config.Config) (bundle.Strategy, error) {
+	if strategyFlag != "" {
+		return bundle.ParseStrategy(strategyFlag)
+	}
+	return bundle.ParseStrategy(cfg.Project.Strategy)
+}
+
+// resolveVolumeSize returns the volume size in bytes from --volume-size or the
+// bundle.volume_size setting, or 0 if bundles should not be split.
+func resolveVolumeSize(cfg *config.Config) (int64, error) {
+	size := volumeSizeFlag
+	if size == "" {
+		size = cfg.Bundle.VolumeSize
+	}
+	if size == "" {
+		return 0, nil
+	}
+
+	n, err := utils.ParseBytes(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid volume size: %w", err)
+	}
+	return n, nil
+}
+
+// protectSidecar encrypts and signs a file shipped next to the bundle, such as a
+// submodule bundle or LFS archive, as configured for the bundle itself. It returns the
+// path of the file to upload.
+func protectSidecar(cfg *config.Config, path string) (string, error) {
+	var err error
+	if cfg.Bundle.Encryption.Enabled() {
+		if path, err = bundle.Encrypt(path, cfg.Bundle.Encryption.Recipients); err != nil {
+			return "", err
+		}
+	}
+	if cfg.Bundle.Signing.Key != "" {
+		if _, err := bundle.Sign(path, cfg.Bundle.Signing.Key); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// uploadSidecar uploads a file from the bundle directory and its signature next to the
+// main bundle, removing the local copies once they are on the server.
+func uploadSidecar(client *ssh.Client, cfg *config.Config, name string) error {
+	localPath := filepath.Join(cfg.Bundle.Directory, name)
+	remotePath := filepath.Join(cfg.Server.RemotePath, name)
+
+	files := []string{localPath}
+	if utils.FileExists(localPath + bundle.SignatureExt) {
+		files = append(files, localPath+bundle.SignatureExt)
+	}
+	for _, file := range files {
+		if err := client.Upload(file, remotePath+strings.TrimPrefix(file, localPath), nil); err != nil {
+			return err
+		}
+		os.Remove(file)
+	}
+	return nil
+}
+
+// uploadVolumes uploads every part of a split bundle to remoteDir.
+func uploadVolumes(client *ssh.Client, bundlePath, remoteDir string, manifest *bundle.VolumeManifest) error {
+	localDir := filepath.Dir(bundlePath)
+	for i, vol := range manifest.Volumes {
+		bar := progressbar.DefaultBytes(
+			vol.Size,
+			fmt.Sprintf("🚀 Uploading volume %d/%d", i+1, len(manifest.Volumes)),
+		)
+		err := client.Upload(filepath.Join(localDir, vol.Name), filepath.Join(remoteDir, vol.Name), func(current, total int64) {
+			bar.Set64(current)
+		})
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", vol.Name, err)
+		}
+	}
+	return nil
+}
+
+// printRemoteFailure explains why the server left the pushed bundle unapplied. patches
+// lists the pushed patch series, nil for a bundle.
+func printRemoteFailure(cfg *config.Config, outcome *remote.Outcome, patches []bundle.Patch) {
+	remoteRepoPath := serverWorkdir(cfg)
+
+	switch outcome.State {
+	case remote.StateConflicted:
+		ui.Red.Printf("❌ Push conflicted on the server in %d file(s); the merge was aborted:\n", len(outcome.Conflicts))
+		for _, path := range outcome.Conflicts {
+			fmt.Printf("   • %s\n", path)
+		}
+		ui.Yellow.Println("💡 Pull, resolve the conflicts locally and push again, or push with --strategy fetch-only")
+	case remote.StateDirtyTreeBlocked:
+		ui.Red.Printf("❌ The server repository has uncommitted changes in %d file(s):\n", len(outcome.Dirty))
+		for _, path := range outcome.Dirty {
+			fmt.Printf("   • %s\n", path)
+		}
+		ui.Yellow.Printf("💡 Commit or stash them in %s on the server and push again\n", remoteRepoPath)
+	case remote.StateDiverged:
+		ui.Red.Printf("❌ Not a fast-forward: the server branch has diverged from %s\n", cfg.Project.Branch)
+		ui.Yellow.Println("💡 Pull first, or push with --strategy merge or rebase")
+	case remote.StatePatchFailed:
+		ui.Red.Printf("❌ Patch %d of %d does not apply on the server; the series was rolled back:\n", outcome.Patches+1, len(patches))
+		printPatches(patches, outcome)
+		if len(outcome.Conflicts) > 0 {
+			ui.Red.Printf("   Conflicting file(s): %s\n", strings.Join(outcome.Conflicts, ", "))
+		}
+		ui.Yellow.Println("💡 Pull with --strategy rebase, resolve the conflicts locally and push again")
+	case remote.StateWrongBranch:
+		ui.Red.Printf("❌ The server repository does not have %s checked out; patches are only applied to it\n", cfg.Project.Branch)
+		ui.Yellow.Printf("💡 Check out %s in %s on the server and push again\n", cfg.Project.Branch, remoteRepoPath)
+	case remote.StateRejected:
+		ui.Red.Printf("❌ The server's %s hook rejected the push:\n", outcome.Hook)
+		for _, line := range outcome.HookOutput {
+			fmt.Printf("   %s\n", line)
+		}
+		ui.Yellow.Printf("💡 The hook is %s on the server\n", filepath.Join(cfg.Server.RemotePath, cfg.Project.Name, ".git", remote.HookDir, outcome.Hook))
+		if patches == nil {
+			ui.Cyan.Println("↩️  The server repository was rolled back")
+			return
+		}
+	}
+	if patches != nil {
+		ui.Cyan.Printf("📥 The server branch %s was left unchanged\n", cfg.Project.Branch)
+		return
+	}
+	ui.Cyan.Printf("📥 The bundle was fetched into %s%s on the server\n", bundle.RemotePrefix(cfg.Server.Name), cfg.Project.Branch)
+}
+
+// printPatches lists which patches of a series the server applied. Of a failed series,
+// the patches before the failing one applied but were rolled back with it.
+func printPatches(patches []bundle.Patch, outcome *remote.Outcome) {
+	failed := outcome.State == remote.StatePatchFailed
+	for i, p := range patches {
+		switch {
+		case i < outcome.Patches && !failed:
+			ui.Green.Printf("   ✅ %s %s\n", shortSHA(p.Commit), p.Subject)
+		case i < outcome.Patches:
+			ui.Yellow.Printf("   ↩️  %s %s (applied, rolled back)\n", shortSHA(p.Commit), p.Subject)
+		case i == outcome.Patches && failed:
+			ui.Red.Printf("   ❌ %s %s (failed)\n", shortSHA(p.Commit), p.Subject)
+		default:
+			fmt.Printf("   ⏭️  %s %s (not attempted)\n", shortSHA(p.Commit), p.Subject)
+		}
+	}
+}
+
+// printWIPOutcome reports what the server did with pushed work in progress.
+func printWIPOutcome(result string) {
+	switch result {
+	case remote.WIPApplied:
+		ui.Green.Println("🚧 Work in progress applied to the server's working tree")
+	case remote.WIPStored:
+		ui.Yellow.Printf("🚧 Work in progress stored in %s on the server, but not applied:\n", bundle.ReceivedWIPRef)
+		ui.Yellow.Println("   the server branch is at a different commit or has uncommitted changes")
+		fmt.Printf("   Apply it there with: git stash apply --index %s\n", bundle.ReceivedWIPRef)
+	}
+}
+
+func printPushSuccess(cfg *config.Config, bundleName string, outcome *remote.Outcome) {
 	ui.Green.Println("\n" + strings.Repeat("═", 50))
 	ui.Green.Println("          🎉 PUSH SUCCESSFUL! 🎉")
 	ui.Green.Println(strings.Repeat("═", 50))
@@ -193,11 +863,75 @@ func printPushSuccess(cfg *config.Config, bundleName string) {
 📦 Bundle:    %s
 🖥️  Server:    %s@%s
 📂 Path:      %s/%s
+🔀 Result:    %s
 
-`, bundleName, cfg.Server.User, cfg.Server.Host, cfg.Server.RemotePath, cfg.Project.Name)
+`, bundleName, cfg.Server.User, cfg.Server.Host, cfg.Server.RemotePath, cfg.Project.Name, outcome.State)
+
+	if outcome.State == remote.StateReceived {
+		ui.Yellow.Printf("⚠️  The %s worktree has uncommitted changes in %d file(s) and was left alone:\n", cfg.Project.Branch, len(outcome.Dirty))
+		for _, path := range outcome.Dirty {
+			fmt.Printf("   • %s\n", path)
+		}
+		ui.Yellow.Printf("💡 Commit or stash them there and merge %s%s to catch up\n\n", bundle.RemotePrefix(cfg.Server.Name), cfg.Project.Branch)
+	}
+	printWorktrees(outcome.Worktrees)
 
 	ui.Yellow.Println("🔜 Next steps on server:")
 	fmt.Printf("   ssh %s@%s\n", cfg.Server.User, cfg.Server.Host)
-	fmt.Printf("   cd %s/%s\n", cfg.Server.RemotePath, cfg.Project.Name)
+	fmt.Printf("   cd %s\n", serverWorkdir(cfg))
 	fmt.Println("   # Start coding! 🚀")
+}
+
+// printWorktrees reports what the server did to the worktrees of a bare repository
+// other than the pushed branch's.
+func printWorktrees(worktrees []remote.Worktree) {
+	if len(worktrees) == 0 {
+		return
+	}
+	ui.Cyan.Println("🌳 Worktrees:")
+	for _, wt := range worktrees {
+		switch wt.Status {
+		case remote.WorktreeCreated, remote.WorktreeUpdated:
+			ui.Green.Printf("   ✅ %s %s (%s)\n", wt.Branch, wt.Path, wt.Status)
+		default:
+			ui.Yellow.Printf("   ⚠️  %s %s (%s, left alone)\n", wt.Branch, wt.Path, wt.Status)
+		}
+	}
+	fmt.Println()
+}
+
+// serverWorktrees returns the worktrees to keep on the server in the bare layout: those
+// configured, or one for the project branch.
+func serverWorktrees(cfg *config.Config) []remote.Worktree {
+	if cfg.Server.Layout != remote.LayoutBare {
+		return nil
+	}
+	if len(cfg.Server.Worktrees) == 0 {
+		return []remote.Worktree{{Branch: cfg.Project.Branch}}
+	}
+	worktrees := make([]remote.Worktree, 0, len(cfg.Server.Worktrees))
+	for _, wt := range cfg.Server.Worktrees {
+		worktrees = append(worktrees, remote.Worktree{Branch: wt.Branch, Path: wt.Path})
+	}
+	return worktrees
+}
+
+// serverWorkdir returns the directory on the server people work on the project branch
+// in: the repository itself, or in the bare layout the branch's worktree.
+func serverWorkdir(cfg *config.Config) string {
+	repoPath := filepath.Join(cfg.Server.RemotePath, cfg.Project.Name)
+	for _, wt := range serverWorktrees(cfg) {
+		if wt.Branch != cfg.Project.Branch {
+			continue
+		}
+		path := wt.Path
+		if path == "" {
+			path = wt.Branch
+		}
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(repoPath, path)
+	}
+	return repoPath
 }
\ No newline at end of file
@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/resolve"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var noCommit bool
+
+// errResolveQuit stops the resolve session, keeping the choices made so far.
+var errResolveQuit = errors.New("resolve stopped")
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve",
+	Short: "🩹 Interactively resolve merge conflicts",
+	Long: `Walk through the conflicts left by a pull, pick a side for each hunk or edit it,
+then stage the files and complete the merge or rebase.
+
+Examples:
+  gitsync resolve              # Resolve and complete the merge
+  gitsync resolve --no-commit  # Resolve and stage, but do not commit`,
+	Run: runResolve,
+}
+
+func init() {
+	resolveCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Stage resolved files without completing the merge or rebase")
+}
+
+func runResolve(cmd *cobra.Command, args []string) {
+	printBanner()
+	ui.Green.Println("\n🩹 Resolving Conflicts")
+
+	cfg, err := config.Load()
+	if err != nil {
+		ui.Red.Printf("❌ Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := cmd.Context()
+	repo := bundle.NewRepo(".")
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		strategy := repo.InProgress(ctx)
+		if strategy == "" {
+			ui.Green.Println("✅ No merge or rebase in progress, nothing to resolve")
+			return
+		}
+
+		paths := repo.UnmergedPaths(ctx)
+		printSides(strategy)
+
+		for i, path := range paths {
+			ui.Magenta.Printf("\n📄 [%d/%d] %s\n", i+1, len(paths), path)
+			if err := resolvePath(reader, path); err != nil {
+				if errors.Is(err, errResolveQuit) {
+					ui.Yellow.Println("\n⏸️  Stopped. Run 'gitsync resolve' again to continue.")
+					os.Exit(1)
+				}
+				ui.Red.Printf("❌ %s: %v\n", path, err)
+			}
+		}
+
+		if remaining := repo.UnmergedPaths(ctx); len(remaining) > 0 {
+			ui.Yellow.Printf("\n⚠️  %d file(s) still have conflicts:\n", len(remaining))
+			for _, path := range remaining {
+				fmt.Println("   •", path)
+			}
+			ui.Yellow.Println("💡 Run 'gitsync resolve' again when you are ready")
+			os.Exit(1)
+		}
+
+		if noCommit {
+			ui.Green.Println("\n✅ All conflicts resolved and staged")
+			return
+		}
+
+		err := repo.Continue(ctx, cfg.Project.Branch)
+		var conflict *bundle.ConflictError
+		if errors.As(err, &conflict) {
+			ui.Yellow.Printf("\n🔁 The rebase stopped on the next commit with %d conflicted file(s)\n", len(conflict.Paths))
+			continue
+		}
+		if err != nil {
+			ui.Red.Printf("❌ Could not complete the %s: %v\n", strategy, err)
+			os.Exit(1)
+		}
+
+		ui.Green.Printf("\n✅ Conflicts resolved, %s completed!\n", strategy)
+		repo.ShowRecentCommits(ctx, 3)
+		return
+	}
+}
+
+// printSides explains which side of a conflict is which; a rebase swaps them.
+func printSides(strategy bundle.Strategy) {
+	if strategy == bundle.StrategyRebase {
+		ui.Cyan.Println("🔀 Rebase in progress: ours is the server, theirs is your commit being replayed")
+	} else {
+		ui.Cyan.Println("🔀 Merge in progress: ours is your local branch, theirs is the server")
+	}
+}
+
+// resolvePath resolves one conflicted file hunk by hunk, or as a whole when it has no
+// conflict markers (binary files, deletions), and stages it once nothing is left.
+func resolvePath(reader *bufio.Reader, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, parseErr := resolve.Parse(data)
+	if err != nil || parseErr != nil || len(file.Hunks()) == 0 {
+		return resolveWholeFile(reader, path)
+	}
+
+	// Keep the file's permissions, e.g. an executable script, whatever edits it
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	mode := info.Mode().Perm()
+
+	hunks := file.Hunks()
+	var stop error
+	for i, hunk := range hunks {
+		if err := resolveHunk(reader, path, hunk, i+1, len(hunks)); err != nil {
+			stop = err
+			break
+		}
+	}
+
+	if err := os.WriteFile(path, file.Bytes(), mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if file.Unresolved() == 0 {
+		if err := gitStage(path); err != nil {
+			return err
+		}
+		ui.Green.Println("   ✅ Resolved and staged")
+	}
+	return stop
+}
+
+// resolveHunk shows one hunk and applies the user's choice.
+func resolveHunk(reader *bufio.Reader, path string, hunk *resolve.Hunk, n, total int) error {
+	ui.Cyan.Printf("\n── Hunk %d/%d ──\n", n, total)
+	printHunkSide(ui.Green, "ours", hunk.OursLabel, hunk.Ours)
+	if hunk.HasBase {
+		printHunkSide(ui.Yellow, "base", hunk.BaseLabel, hunk.Base)
+	}
+	printHunkSide(ui.Cyan, "theirs", hunk.TheirsLabel, hunk.Theirs)
+
+	prompt := "   [o]urs, [t]heirs, [b]oth, "
+	if hunk.HasBase {
+		prompt += "b[a]se, "
+	}
+	prompt += "[e]dit, [s]kip, [q]uit: "
+
+	for {
+		ui.Yellow.Print(prompt)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return errResolveQuit
+		}
+
+		switch strings.TrimSpace(strings.ToLower(answer)) {
+		case "o":
+			hunk.Choose(resolve.ChooseOurs)
+		case "t":
+			hunk.Choose(resolve.ChooseTheirs)
+		case "b":
+			hunk.Choose(resolve.ChooseBoth)
+		case "a":
+			if !hunk.HasBase {
+				continue
+			}
+			hunk.Choose(resolve.ChooseBase)
+		case "e":
+			text, err := editText(path, hunk.Markers())
+			if err != nil {
+				ui.Red.Printf("   ❌ %v\n", err)
+				continue
+			}
+			if edited, err := resolve.Parse([]byte(text)); err != nil || len(edited.Hunks()) > 0 {
+				ui.Red.Println("   ❌ Conflict markers are still present, edit again or pick a side")
+				continue
+			}
+			hunk.SetResolution(text)
+		case "s":
+			return nil
+		case "q":
+			return errResolveQuit
+		default:
+			continue
+		}
+		return nil
+	}
+}
+
+func printHunkSide(c *color.Color, side, label string, lines []string) {
+	if label != "" {
+		side += " (" + label + ")"
+	}
+	c.Printf("   %s:\n", side)
+	if len(lines) == 0 {
+		fmt.Println("   │ (empty)")
+	}
+	for _, line := range lines {
+		fmt.Printf("   │ %s\n", strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// resolveWholeFile resolves a file without conflict markers by taking one side or
+// editing it in place.
+func resolveWholeFile(reader *bufio.Reader, path string) error {
+	ui.Yellow.Println("   This file has no conflict hunks (binary file or deleted on one side)")
+
+	for {
+		ui.Yellow.Print("   Keep [o]urs, [t]heirs, [e]dit, [s]kip, [q]uit: ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return errResolveQuit
+		}
+
+		switch strings.TrimSpace(strings.ToLower(answer)) {
+		case "o":
+			return takeSide(path, "--ours")
+		case "t":
+			return takeSide(path, "--theirs")
+		case "e":
+			if err := runEditor(path); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if file, err := resolve.Parse(data); err != nil || len(file.Hunks()) > 0 {
+				ui.Red.Println("   ❌ Conflict markers are still present")
+				continue
+			}
+			return gitStage(path)
+		case "s":
+			return nil
+		case "q":
+			return errResolveQuit
+		}
+	}
+}
+
+// takeSide checks out one side of a conflicted path, removing it if that side deleted it.
+func takeSide(path, side string) error {
+	if exec.Command("git", "checkout", side, "--", path).Run() != nil {
+		if output, err := exec.Command("git", "rm", "-q", "--", path).CombinedOutput(); err != nil {
+			return fmt.Errorf("git rm failed: %s", string(output))
+		}
+		return nil
+	}
+	return gitStage(path)
+}
+
+func gitStage(path string) error {
+	if output, err := exec.Command("git", "add", "--", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("git add failed: %s", string(output))
+	}
+	return nil
+}
+
+// editText opens text in the user's editor, using a temporary file with the same
+// extension as path so syntax highlighting still works, and returns the edited text.
+func editText(path, text string) (string, error) {
+	tmp, err := os.CreateTemp("", "gitsync-hunk-*"+filepath.Ext(path))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(text); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	tmp.Close()
+
+	if err := runEditor(tmp.Name()); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(tmp.Name())
+	return string(data), err
+}
+
+// runEditor opens path in Git's editor, which honours GIT_EDITOR, core.editor, VISUAL and EDITOR.
+func runEditor(path string) error {
+	editor, err := exec.Command("git", "var", "GIT_EDITOR").Output()
+	if err != nil {
+		return fmt.Errorf("no editor configured, set $EDITOR")
+	}
+
+	cmd := exec.Command("sh", "-c", strings.TrimSpace(string(editor))+` "$@"`, "editor", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+	return nil
+}
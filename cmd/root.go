@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/princetheprogrammerbtw/gitsynq/internal/cleanup"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -12,6 +18,11 @@ var (
 	version = "1.0.0" // default version, can be overridden by ldflags
 	cfgFile string
 	verbose bool
+
+	// keepArtifacts leaves the temporary files of a sync in place for debugging.
+	keepArtifacts bool
+	// artifacts tracks the temporary files of the running sync; see trackArtifacts.
+	artifacts = cleanup.NewTracker(false)
 )
 
 var rootCmd = &cobra.Command{
@@ -32,8 +43,50 @@ var rootCmd = &cobra.Command{
 	Version: version,
 }
 
+// Execute runs the root command. The first Ctrl+C cancels the command's context, which
+// stops running git and remote commands; a second one kills the process as usual.
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	finishArtifacts(err == nil)
+	return err
+}
+
+// trackArtifacts starts tracking the temporary files of a new sync, which are removed
+// when it ends, however it ends.
+func trackArtifacts() {
+	artifacts = cleanup.NewTracker(keepArtifacts)
+}
+
+// finishArtifacts removes the temporary files of the running sync, and on failure its
+// outputs too. It uses its own context: after Ctrl+C the command's is already canceled.
+func finishArtifacts(success bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	paths, err := artifacts.Finish(ctx, success)
+	if err != nil {
+		ui.Yellow.Printf("⚠️  Cleanup incomplete: %v\n", err)
+	}
+	if keepArtifacts && len(paths) > 0 {
+		ui.Cyan.Printf("🧰 Kept %d artifact(s) for debugging:\n", len(paths))
+		for _, path := range paths {
+			fmt.Printf("   • %s\n", path)
+		}
+	}
+}
+
+// exit cleans up after the running sync and ends the process with code. Syncs exit
+// through it rather than os.Exit, which would leave their temporary files behind.
+func exit(code int) {
+	finishArtifacts(code == 0)
+	os.Exit(code)
 }
 
 func init() {
@@ -54,6 +107,8 @@ func init() {
 	rootCmd.AddCommand(historyCmd)
 	rootCmd.AddCommand(backupCmd)
 	rootCmd.AddCommand(hooksCmd)
+	rootCmd.AddCommand(resolveCmd)
+	rootCmd.AddCommand(pruneCmd)
 }
 
 func initConfig() {
@@ -2,14 +2,18 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/config"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/remote"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
 	"github.com/princetheprogrammerbtw/gitsynq/internal/ui"
 	"github.com/spf13/cobra"
@@ -132,12 +136,161 @@ func printRemoteStatus(ctx context.Context, cfg *config.Config) {
 		} else {
 			ui.Yellow.Printf("⚠️  Uncommitted changes: %s files\n", info["CHANGES"])
 		}
+
+		if d, err := compareWithServer(ctx, bundle.NewRepo("."), client, cfg); err == nil {
+			printDivergence(cfg.Project.Branch, d)
+		}
 	} else {
 		ui.Yellow.Println("📭 Repository not found on server")
 		fmt.Println("💡 Run 'gitsync push --full' to initialize")
 	}
 }
 
+// compareWithServer classifies the local project branch against the server's.
+func compareWithServer(ctx context.Context, repo *bundle.Repo, client *ssh.Client, cfg *config.Config) (*bundle.Divergence, error) {
+	d, _, err := serverTip(ctx, repo, client, cfg)
+	return d, err
+}
+
+// serverTip fetches the server's tip of the project branch and classifies the local
+// branch against it.
+func serverTip(ctx context.Context, repo *bundle.Repo, client *ssh.Client, cfg *config.Config) (*bundle.Divergence, *remote.RemoteTip, error) {
+	local := repo.Tip(ctx, cfg.Project.Branch)
+	if local == "" {
+		return nil, nil, fmt.Errorf("local branch %s not found", cfg.Project.Branch)
+	}
+
+	repoPath := filepath.Join(cfg.Server.RemotePath, cfg.Project.Name)
+	output, err := client.Run(ctx, remote.TipScript(repoPath, cfg.Project.Branch, local))
+	if err != nil {
+		return nil, nil, err
+	}
+	tip, err := remote.ParseTip(output, local)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := tip.Compare(ctx, repo, local)
+	return d, tip, err
+}
+
+// checkDivergence compares the local branch with the server's before a sync and prints
+// the result. When both sides have new commits, the sync only goes ahead if a strategy
+// was chosen explicitly with --strategy or project.strategy.
+func checkDivergence(ctx context.Context, repo *bundle.Repo, client *ssh.Client, cfg *config.Config) *bundle.Divergence {
+	d, err := compareWithServer(ctx, repo, client, cfg)
+	if err != nil {
+		ui.Yellow.Printf("⚠️  Could not compare with the server: %v\n", err)
+		return nil
+	}
+	requireStrategy(cfg, d)
+	return d
+}
+
+// requireStrategy prints how the branches compare and exits if both sides have new
+// commits but no strategy was chosen to integrate them.
+func requireStrategy(cfg *config.Config, d *bundle.Divergence) {
+	printDivergence(cfg.Project.Branch, d)
+
+	if d.State == bundle.SyncDiverged && strategyFlag == "" && cfg.Project.Strategy == "" {
+		ui.Red.Println("❌ Both sides have new commits, choose how to integrate them")
+		ui.Yellow.Println("💡 Use --strategy merge, rebase, ff-only or fetch-only, or set project.strategy")
+		exit(1)
+	}
+}
+
+// predictOutcome works out what the receiving side of a sync would do with the other
+// side's branch under strategy, without changing anything. ours and theirs are the
+// receiving and the sending side's tips; incoming and kept count the commits only the
+// sending and only the receiving side have. Conflicts can only be worked out when the
+// local repository has both tips; otherwise a merge or rebase is assumed to succeed and
+// the error says why conflicts are unknown.
+func predictOutcome(ctx context.Context, repo *bundle.Repo, strategy bundle.Strategy, ours, theirs string, incoming, kept int) (remote.State, []string, error) {
+	switch {
+	case strategy == bundle.StrategyFetchOnly:
+		return remote.StateFetched, nil, nil
+	case incoming == 0:
+		return remote.StateUpToDate, nil, nil
+	case kept == 0:
+		return remote.StateFastForwarded, nil, nil
+	case strategy == bundle.StrategyFFOnly:
+		return remote.StateDiverged, nil, nil
+	}
+
+	state := remote.StateMerged
+	if strategy == bundle.StrategyRebase {
+		state = remote.StateRebased
+	}
+	conflicts, err := repo.MergeConflicts(ctx, ours, theirs)
+	if err != nil {
+		return state, nil, err
+	}
+	if len(conflicts) > 0 {
+		return remote.StateConflicted, conflicts, nil
+	}
+	return state, nil, nil
+}
+
+// dryRunCommits is how many of the commits a sync would move a dry run lists.
+const dryRunCommits = 20
+
+// printPlannedCommits prints the newest of the count commits a dry run found would be
+// moved, as one-line summaries.
+func printPlannedCommits(verb string, commits []string, count int) {
+	if count == 0 {
+		ui.Green.Printf("✅ No commits would be %s\n", verb)
+		return
+	}
+	ui.Cyan.Printf("📝 %d commit(s) would be %s:\n", count, verb)
+	for _, commit := range commits {
+		fmt.Printf("   • %s\n", commit)
+	}
+	if count > len(commits) {
+		fmt.Printf("   … and %d more\n", count-len(commits))
+	}
+}
+
+// printPlannedOutcome prints the outcome worked out by predictOutcome.
+func printPlannedOutcome(where string, state remote.State, conflicts []string, err error) {
+	switch state {
+	case remote.StateConflicted, remote.StatePatchFailed:
+		ui.Red.Printf("🔀 Outcome %s: %s, %d file(s) would conflict:\n", where, state, len(conflicts))
+		for _, path := range conflicts {
+			fmt.Printf("   • %s\n", path)
+		}
+	case remote.StateDiverged:
+		ui.Red.Printf("🔀 Outcome %s: diverged, ff-only would refuse the update\n", where)
+	default:
+		ui.Cyan.Printf("🔀 Outcome %s: %s\n", where, state)
+	}
+	switch {
+	case errors.Is(err, bundle.ErrUnknownCommit):
+		ui.Yellow.Println("   Conflicts cannot be predicted: neither side has both histories yet")
+	case err != nil:
+		ui.Yellow.Printf("   Conflicts cannot be predicted: %v\n", err)
+	}
+}
+
+func printDivergence(branch string, d *bundle.Divergence) {
+	switch d.State {
+	case bundle.SyncUpToDate:
+		ui.Green.Printf("✅ %s is the same locally and on the server\n", branch)
+	case bundle.SyncAhead:
+		if d.Remote == "" {
+			ui.Cyan.Printf("📤 %s does not exist on the server yet\n", branch)
+		} else {
+			ui.Cyan.Printf("📤 Local %s is %d commit(s) ahead of the server\n", branch, d.Ahead)
+		}
+	case bundle.SyncBehind:
+		ui.Cyan.Printf("📥 Server %s is %d commit(s) ahead of local\n", branch, d.Behind)
+	case bundle.SyncDiverged:
+		if d.Ahead < 0 {
+			ui.Yellow.Printf("🔀 %s has diverged: local and server both have commits the other lacks\n", branch)
+		} else {
+			ui.Yellow.Printf("🔀 %s has diverged: %d local and %d server commit(s) since %s\n", branch, d.Ahead, d.Behind, shortSHA(d.Base))
+		}
+	}
+}
+
 func printRecommendation(cfg *config.Config) {
 	ui.Yellow.Println("💡 Suggested actions:")
 	fmt.Println("   • Run 'gitsync push' if you have local changes to sync")
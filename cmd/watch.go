@@ -14,8 +14,16 @@ import (
 var watchCmd = &cobra.Command{
 	Use:   "watch",
 	Short: "👀 Watch for changes and auto-sync",
-	Long:  `Automatically run 'gitsync push' whenever files in the repository are changed.`, 
-	Run:   runWatch,
+	Long: `Automatically run 'gitsync push' whenever files in the repository are changed.
+
+With --wip, uncommitted changes are pushed as work in progress, so the server's
+working tree follows your edits without any commits.`,
+	Run: runWatch,
+}
+
+func init() {
+	watchCmd.Flags().BoolVar(&wipFlag, "wip", false, "Push uncommitted changes as work in progress on every change")
+	watchCmd.Flags().BoolVar(&wipUntracked, "untracked", false, "With --wip, include untracked files that are not ignored")
 }
 
 func runWatch(cmd *cobra.Command, args []string) {
@@ -48,8 +56,7 @@ func runWatch(cmd *cobra.Command, args []string) {
 					}
 					timer = time.AfterFunc(delay, func() {
 						ui.Cyan.Printf("\n🔄 Change detected in %s. Syncing...\n", event.Name)
-						// We need a way to auto-commit or just push if commits exist
-						// For now, let's just trigger a normal push
+						// Without --wip only committed changes are sent
 						runPush(cmd, args)
 						ui.Green.Println("\n👀 Still watching...")
 					})
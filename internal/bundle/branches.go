@@ -0,0 +1,126 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Results of UpdateBranches.
+const (
+	BranchCreated  = "new"
+	BranchUpdated  = "updated"
+	BranchUpToDate = "up-to-date"
+	BranchSkipped  = "skipped"
+)
+
+// BranchUpdate is what UpdateBranches did to one local branch. Old is empty for a new
+// branch; Reason says why a branch was skipped.
+type BranchUpdate struct {
+	Branch string `json:"branch"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new"`
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BundleBranches maps the branches in the header of the plaintext bundle at path to
+// their tips.
+func BundleBranches(path string) (map[string]string, error) {
+	header, err := ReadHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	branches := make(map[string]string)
+	for _, ref := range header.Refs {
+		if name, ok := strings.CutPrefix(ref.Name, "refs/heads/"); ok {
+			branches[name] = ref.Tip
+		}
+	}
+	return branches, nil
+}
+
+// MatchBranches returns the names in branches that match any of patterns, sorted.
+// Patterns are branch names or path.Match globs such as feature/*. Patterns that match
+// nothing are returned as unmatched.
+func MatchBranches(branches map[string]string, patterns []string) (matched, unmatched []string, err error) {
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		found := false
+		for name := range branches {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid branch pattern %q: %w", pattern, err)
+			}
+			if ok {
+				found = true
+				if !seen[name] {
+					seen[name] = true
+					matched = append(matched, name)
+				}
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	sort.Strings(matched)
+	return matched, unmatched, nil
+}
+
+// UpdateBranches creates or fast-forwards local branches to the tips in branches, whose
+// commits must be in the repository already, e.g. fetched from a bundle. Only new
+// branches and branches that are behind are changed. The checked-out branch is skipped,
+// since moving it would leave the working tree behind, and so are branches with local
+// commits that are not on the server. The results are sorted by branch name.
+func (r *Repo) UpdateBranches(ctx context.Context, branches map[string]string) ([]BranchUpdate, error) {
+	current := ""
+	if name := r.lines(ctx, "symbolic-ref", "-q", "--short", "HEAD"); len(name) == 1 {
+		current = name[0]
+	}
+
+	names := make([]string, 0, len(branches))
+	for name := range branches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var updates []BranchUpdate
+	for _, name := range names {
+		u := BranchUpdate{Branch: name, Old: r.Tip(ctx, name), New: branches[name]}
+		ref := "refs/heads/" + name
+
+		if u.Old == "" {
+			if err := r.run(ctx, "update-ref", ref, u.New, ""); err != nil {
+				return updates, err
+			}
+			u.Result = BranchCreated
+			updates = append(updates, u)
+			continue
+		}
+
+		d, err := r.Compare(ctx, u.Old, u.New)
+		if err != nil {
+			return updates, err
+		}
+		switch {
+		case d.State == SyncUpToDate:
+			u.Result = BranchUpToDate
+		case d.State == SyncAhead:
+			u.Result, u.Reason = BranchSkipped, fmt.Sprintf("%d local commit(s) not on the server", d.Ahead)
+		case d.State == SyncDiverged:
+			u.Result, u.Reason = BranchSkipped, "diverged from the server, merge it by hand"
+		case name == current:
+			u.Result, u.Reason = BranchSkipped, "checked out"
+		default:
+			if err := r.run(ctx, "update-ref", ref, u.New, u.Old); err != nil {
+				return updates, err
+			}
+			u.Result = BranchUpdated
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
@@ -0,0 +1,103 @@
+package bundle
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchBranches(t *testing.T) {
+	branches := map[string]string{"main": "a", "feature/x": "b", "feature/y": "c", "fix": "d"}
+
+	matched, unmatched, err := MatchBranches(branches, []string{"feature/*", "fix", "feature/x", "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"feature/x", "feature/y", "fix"}; !reflect.DeepEqual(matched, want) {
+		t.Errorf("Matched %v, expected %v", matched, want)
+	}
+	if want := []string{"gone"}; !reflect.DeepEqual(unmatched, want) {
+		t.Errorf("Unmatched %v, expected %v", unmatched, want)
+	}
+
+	if _, _, err := MatchBranches(branches, []string{"["}); err == nil {
+		t.Error("Expected an invalid pattern to fail")
+	}
+}
+
+func TestUpdateBranches(t *testing.T) {
+	serverDir := setupTestRepo(t)
+	current := git(t, serverDir, "symbolic-ref", "--short", "HEAD")
+	names := []string{"behind", "ahead", "diverged", "same"}
+	for _, name := range names {
+		git(t, serverDir, "branch", name)
+	}
+	laptopDir := t.TempDir()
+	git(t, laptopDir, "clone", "-q", serverDir, ".")
+	git(t, laptopDir, "config", "user.email", "test@example.com")
+	git(t, laptopDir, "config", "user.name", "Test User")
+	for _, name := range names {
+		git(t, laptopDir, "branch", name, "origin/"+name)
+	}
+
+	git(t, serverDir, "checkout", "-q", "-b", "new")
+	commitFile(t, serverDir, "new.txt", "new")
+	for _, name := range []string{"behind", "diverged", current} {
+		git(t, serverDir, "checkout", "-q", name)
+		commitFile(t, serverDir, name+".txt", "server")
+	}
+	for _, name := range []string{"ahead", "diverged"} {
+		git(t, laptopDir, "checkout", "-q", name)
+		commitFile(t, laptopDir, name+".txt", "laptop")
+	}
+	git(t, laptopDir, "checkout", "-q", current)
+
+	bundlePath := filepath.Join(t.TempDir(), "server.bundle")
+	git(t, serverDir, "bundle", "create", "-q", bundlePath, "--branches")
+	laptop := NewRepo(laptopDir)
+	ctx := t.Context()
+	if err := laptop.Merge(ctx, bundlePath, current, MergeOptions{Strategy: StrategyFetchOnly}); err != nil {
+		t.Fatal(err)
+	}
+
+	branches, err := BundleBranches(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 6 {
+		t.Fatalf("Expected 6 branches in the bundle, got %v", branches)
+	}
+	before := laptop.RefTips(ctx, "refs/heads/")
+	updates, err := laptop.UpdateBranches(ctx, branches)
+	if err != nil {
+		t.Fatalf("UpdateBranches failed: %v", err)
+	}
+
+	want := map[string]string{
+		"ahead":    BranchSkipped,
+		"behind":   BranchUpdated,
+		"diverged": BranchSkipped,
+		current:    BranchSkipped,
+		"new":      BranchCreated,
+		"same":     BranchUpToDate,
+	}
+	if len(updates) != len(want) {
+		t.Fatalf("Expected %d updates, got %+v", len(want), updates)
+	}
+	for _, u := range updates {
+		if u.Result != want[u.Branch] {
+			t.Errorf("%s: got %s (%s), expected %s", u.Branch, u.Result, u.Reason, want[u.Branch])
+		}
+		tip := laptop.Tip(ctx, u.Branch)
+		switch u.Result {
+		case BranchCreated, BranchUpdated:
+			if tip != branches[u.Branch] {
+				t.Errorf("%s is at %s, expected the server's %s", u.Branch, tip, branches[u.Branch])
+			}
+		default:
+			if tip != before["refs/heads/"+u.Branch] {
+				t.Errorf("%s was moved although it was %s", u.Branch, u.Result)
+			}
+		}
+	}
+}
@@ -2,20 +2,27 @@
 package bundle
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 // CreateFull creates a Git bundle containing the entire repository history.
 // It includes all branches and tags.
-func CreateFull(outputPath string) error {
+func (r *Repo) CreateFull(ctx context.Context, outputPath string) error {
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		return fmt.Errorf("failed to create bundle directory: %w", err)
 	}
+	outputPath, err := absPath(outputPath)
+	if err != nil {
+		return err
+	}
 
-	cmd := exec.Command("git", "bundle", "create", outputPath, "--all")
+	cmd := r.command(ctx, "bundle", "create", outputPath, "--all")
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("git bundle create failed: %v: %s", err, string(output))
 	}
@@ -23,16 +30,26 @@ func CreateFull(outputPath string) error {
 }
 
 // CreateIncremental creates a Git bundle containing only the commits that exist on the
-// specified branch but not on its remote tracking counterpart (origin/branch).
-func CreateIncremental(outputPath, branch string) error {
+// specified branch but not on its remote tracking counterpart (origin/branch). After a
+// shallow push, commits behind the server's shallow boundary are left out as well, so
+// the bundle never requires history the server does not have.
+func (r *Repo) CreateIncremental(ctx context.Context, outputPath, branch string) error {
 	// First, check if we have a remote tracking branch
-	checkCmd := exec.Command("git", "rev-parse", "--verify", "origin/"+branch)
-	if err := checkCmd.Run(); err != nil {
+	if !r.succeeds(ctx, "rev-parse", "--verify", "origin/"+branch) {
 		return fmt.Errorf("no tracking branch found for %s, a full push is required", branch)
 	}
 
-	bundleCmd := exec.Command("git", "bundle", "create", outputPath,
-		fmt.Sprintf("origin/%s..%s", branch, branch))
+	absOutput, err := absPath(outputPath)
+	if err != nil {
+		return err
+	}
+	args := []string{"bundle", "create", absOutput, fmt.Sprintf("origin/%s..%s", branch, branch)}
+	for _, oid := range r.ShallowBoundary(ctx) {
+		if r.hasCommit(ctx, oid) {
+			args = append(args, "^"+oid)
+		}
+	}
+	bundleCmd := r.command(ctx, args...)
 
 	if output, err := bundleCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("git bundle incremental create failed: %v: %s", err, string(output))
@@ -52,48 +69,152 @@ func CreateIncremental(outputPath, branch string) error {
 	return nil
 }
 
-// Merge takes a path to a Git bundle and merges the changes into the local repository
-// on the specified branch.
-func Merge(bundlePath, branch string) error {
-	// Verify bundle
-	verifyCmd := exec.Command("git", "bundle", "verify", bundlePath)
-	if output, err := verifyCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("invalid or incompatible bundle: %v: %s", err, string(output))
+// Strategy controls how commits fetched from a bundle are integrated into the
+// current branch. The same strategies are applied by the remote setup script.
+type Strategy string
+
+const (
+	// StrategyMerge creates a merge commit when the histories have diverged.
+	StrategyMerge Strategy = "merge"
+	// StrategyRebase replays local commits on top of the bundle's branch.
+	StrategyRebase Strategy = "rebase"
+	// StrategyFFOnly only updates the branch when it is a fast-forward.
+	StrategyFFOnly Strategy = "ff-only"
+	// StrategyFetchOnly only updates the tracking ref and leaves the branch alone.
+	StrategyFetchOnly Strategy = "fetch-only"
+)
+
+// DefaultRemote is the remote name whose RemotePrefix namespace bundle branches are
+// fetched into when no other name is configured.
+const DefaultRemote = "gitsync"
+
+// ErrNonFastForward is returned by Merge with StrategyFFOnly when the local branch
+// has commits that the bundle does not.
+var ErrNonFastForward = errors.New("not a fast-forward: local and bundle histories have diverged")
+
+// ParseStrategy validates a strategy name. An empty name selects StrategyMerge.
+func ParseStrategy(name string) (Strategy, error) {
+	switch s := Strategy(name); s {
+	case "":
+		return StrategyMerge, nil
+	case StrategyMerge, StrategyRebase, StrategyFFOnly, StrategyFetchOnly:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown merge strategy %q (use merge, rebase, ff-only or fetch-only)", name)
 	}
+}
+
+// MergeOptions controls how Merge integrates a bundle.
+type MergeOptions struct {
+	Strategy Strategy
+	// AbortOnConflict aborts a conflicted merge or rebase, restoring the pre-merge state.
+	AbortOnConflict bool
+	// Remote names the RemotePrefix namespace the bundle branches are fetched into,
+	// DefaultRemote when empty.
+	Remote string
+}
 
-	// Ensure any old bundle remote is removed
-	_ = exec.Command("git", "remote", "remove", "bundle").Run()
+// Merge takes a path to a Git bundle, fetches its branches into the RemotePrefix
+// namespace of opts.Remote and integrates the specified branch into the current branch using the
+// configured strategy. Conflicts are reported as a *ConflictError.
+func (r *Repo) Merge(ctx context.Context, bundlePath, branch string, opts MergeOptions) error {
+	strategy, err := ParseStrategy(string(opts.Strategy))
+	if err != nil {
+		return err
+	}
+	if bundlePath, err = absPath(bundlePath); err != nil {
+		return err
+	}
+	remote := opts.Remote
+	if remote == "" {
+		remote = DefaultRemote
+	}
+	prefix := RemotePrefix(remote)
 
-	addCmd := exec.Command("git", "remote", "add", "bundle", bundlePath)
-	if err := addCmd.Run(); err != nil {
-		return fmt.Errorf("failed to add bundle as remote: %w", err)
+	// Verify bundle
+	verifyCmd := r.command(ctx, "bundle", "verify", bundlePath)
+	if output, err := verifyCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid or incompatible bundle: %v: %s", err, string(output))
 	}
-	defer func() {
-		_ = exec.Command("git", "remote", "remove", "bundle").Run()
-	}()
 
 	// Fetch from bundle
-	fetchCmd := exec.Command("git", "fetch", "bundle")
+	// Submodules come from their own bundles, see ApplySubmodules
+	fetchCmd := r.command(ctx, "fetch", "--no-recurse-submodules", bundlePath, "+refs/heads/*:"+prefix+"*")
 	if output, err := fetchCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to fetch from bundle: %s", string(output))
 	}
 
-	// Merge
-	mergeCmd := exec.Command("git", "merge", "bundle/"+branch, "--no-edit")
-	if output, err := mergeCmd.CombinedOutput(); err != nil {
-		// Fallback to master if main branch merge fails (common transition issue)
-		mergeCmdMaster := exec.Command("git", "merge", "bundle/master", "--no-edit")
-		if output2, err2 := mergeCmdMaster.CombinedOutput(); err2 != nil {
-			return fmt.Errorf("merge failed (tried %s and master): %s", branch, string(output)+string(output2))
+	target := prefix + branch
+	if !r.succeeds(ctx, "rev-parse", "--verify", "-q", target) {
+		return fmt.Errorf("bundle does not contain branch %s", branch)
+	}
+
+	if strategy == StrategyFetchOnly {
+		return nil
+	}
+
+	// An unborn branch can always be fast-forwarded, whatever the strategy
+	if !r.succeeds(ctx, "rev-parse", "--verify", "-q", "HEAD") {
+		strategy = StrategyFFOnly
+	} else if strategy == StrategyFFOnly {
+		// Only diverged histories are a non-fast-forward; anything else that stops the
+		// merge, like local changes in the way, is reported as git tells it
+		var stderr strings.Builder
+		cmd := r.command(ctx, "merge-base", "--is-ancestor", "HEAD", target)
+		cmd.Stderr = &stderr
+		var exit *exec.ExitError
+		switch err := cmd.Run(); {
+		case err == nil:
+		case errors.As(err, &exit) && exit.ExitCode() == 1:
+			return fmt.Errorf("%w: %s", ErrNonFastForward, branch)
+		default:
+			return fmt.Errorf("git merge-base failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	var args []string
+	switch strategy {
+	case StrategyMerge:
+		args = []string{"merge", "--no-edit", target}
+	case StrategyRebase:
+		args = []string{"rebase", target}
+	case StrategyFFOnly:
+		args = []string{"merge", "--ff-only", target}
+	}
+
+	// Keep the merge base in conflict markers so resolve can show all three sides
+	args = append([]string{"-c", "merge.conflictStyle=diff3"}, args...)
+
+	ours, _ := r.command(ctx, "rev-parse", "HEAD").Output()
+	theirs, _ := r.command(ctx, "rev-parse", target).Output()
+
+	if output, err := r.command(ctx, args...).CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if strategy == StrategyFFOnly {
+			return fmt.Errorf("%s failed: %s", strategy, strings.TrimSpace(string(output)))
+		}
+
+		conflict := r.detectConflict(ctx, branch, strategy, strings.TrimSpace(string(ours)), strings.TrimSpace(string(theirs)))
+		if conflict == nil {
+			return fmt.Errorf("%s failed: %s", strategy, string(output))
+		}
+		if opts.AbortOnConflict {
+			if err := r.abortIntegration(ctx, strategy); err != nil {
+				return fmt.Errorf("%v; additionally, %w", conflict, err)
+			}
+			conflict.Aborted = true
 		}
+		return conflict
 	}
 
 	return nil
 }
 
 // PushToOrigin pushes the specified branch to the 'origin' remote.
-func PushToOrigin(branch string) error {
-	cmd := exec.Command("git", "push", "origin", branch)
+func (r *Repo) PushToOrigin(ctx context.Context, branch string) error {
+	cmd := r.command(ctx, "push", "origin", branch)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("git push origin failed: %v: %s", err, string(output))
 	}
@@ -101,8 +222,8 @@ func PushToOrigin(branch string) error {
 }
 
 // ShowRecentCommits prints the last n commits to stdout using a pretty graph format.
-func ShowRecentCommits(n int) {
-	cmd := exec.Command("git", "log", fmt.Sprintf("-%d", n), "--oneline", "--graph", "--color")
+func (r *Repo) ShowRecentCommits(ctx context.Context, n int) {
+	cmd := r.command(ctx, "log", fmt.Sprintf("-%d", n), "--oneline", "--graph", "--color")
 	cmd.Stdout = os.Stdout
 	_ = cmd.Run()
 }
@@ -27,10 +27,7 @@ func BenchmarkCreateFull(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		bundlePath := filepath.Join(dir, "bench.bundle")
 		
-		oldWd, _ := os.Getwd()
-		os.Chdir(dir)
-		CreateFull(bundlePath)
-		os.Chdir(oldWd)
+		NewRepo(dir).CreateFull(b.Context(), bundlePath)
 		
 		os.Remove(bundlePath)
 	}
@@ -1,9 +1,11 @@
 package bundle
 
 import (
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -37,12 +39,7 @@ func TestCreateFull(t *testing.T) {
 	repoDir := setupTestRepo(t)
 	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
 	
-	// Change to repo dir
-	oldWd, _ := os.Getwd()
-	defer os.Chdir(oldWd)
-	os.Chdir(repoDir)
-	
-	err := CreateFull(bundlePath)
+	err := NewRepo(repoDir).CreateFull(t.Context(), bundlePath)
 	if err != nil {
 		t.Fatalf("CreateFull failed: %v", err)
 	}
@@ -56,33 +53,152 @@ func TestMerge(t *testing.T) {
 	repoDir := setupTestRepo(t)
 	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
 	
-	oldWd, _ := os.Getwd()
-	defer os.Chdir(oldWd)
-	os.Chdir(repoDir)
-	
 	// Create bundle
-	CreateFull(bundlePath)
+	NewRepo(repoDir).CreateFull(t.Context(), bundlePath)
 	
 	// Create a new repo and merge the bundle
 	newRepoDir := t.TempDir()
-	os.Chdir(newRepoDir)
-	exec.Command("git", "init").Run()
-	exec.Command("git", "config", "user.email", "test@example.com").Run()
-	exec.Command("git", "config", "user.name", "Test User").Run()
+	git(t, newRepoDir, "init")
+	git(t, newRepoDir, "config", "user.email", "test@example.com")
+	git(t, newRepoDir, "config", "user.name", "Test User")
 	
 	// We need a commit to merge into usually, or it's a clone
 	// But Merge expects an existing repo
-	err := Merge(bundlePath, "master") // setupTestRepo uses master/main depending on git version
+	repo := NewRepo(newRepoDir)
+	err := repo.Merge(t.Context(), bundlePath, "master", MergeOptions{}) // setupTestRepo uses master/main depending on git version
 	if err != nil {
 		// Try main
-		err = Merge(bundlePath, "main")
+		err = repo.Merge(t.Context(), bundlePath, "main", MergeOptions{})
 	}
 	
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
 	}
 	
-	if _, err := os.Stat("file.txt"); os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(newRepoDir, "file.txt")); os.IsNotExist(err) {
 		t.Error("file.txt not found after merge")
 	}
 }
+
+// git runs a git command in dir and returns its trimmed output.
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commitFile writes a file in dir and commits it.
+func commitFile(t *testing.T, dir, name, content string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "-m", "update "+name)
+}
+
+// setupDivergedRepos returns a source repository and a clone of it that both gained
+// a commit of their own, plus a full bundle of the source and its branch name.
+func setupDivergedRepos(t *testing.T) (srcDir, dstDir, bundlePath, branch string) {
+	srcDir = setupTestRepo(t)
+	branch = git(t, srcDir, "symbolic-ref", "--short", "HEAD")
+
+	dstDir = filepath.Join(t.TempDir(), "clone")
+	git(t, srcDir, "clone", "-q", srcDir, dstDir)
+	git(t, dstDir, "config", "user.email", "test@example.com")
+	git(t, dstDir, "config", "user.name", "Test User")
+
+	commitFile(t, srcDir, "server.txt", "from server")
+	commitFile(t, dstDir, "laptop.txt", "from laptop")
+
+	bundlePath = filepath.Join(t.TempDir(), "diverged.bundle")
+	git(t, srcDir, "bundle", "create", bundlePath, "--all")
+	return srcDir, dstDir, bundlePath, branch
+}
+
+func TestMergeStrategies(t *testing.T) {
+	t.Run("ff-only refuses diverged branches", func(t *testing.T) {
+		_, dstDir, bundlePath, branch := setupDivergedRepos(t)
+
+		before := git(t, dstDir, "rev-parse", "HEAD")
+		err := NewRepo(dstDir).Merge(t.Context(), bundlePath, branch, MergeOptions{Strategy: StrategyFFOnly})
+		if !errors.Is(err, ErrNonFastForward) {
+			t.Fatalf("Expected ErrNonFastForward, got %v", err)
+		}
+		if after := git(t, dstDir, "rev-parse", "HEAD"); after != before {
+			t.Error("HEAD moved after a refused fast-forward")
+		}
+	})
+
+	t.Run("ff-only passes other failures through", func(t *testing.T) {
+		srcDir := setupTestRepo(t)
+		branch := git(t, srcDir, "symbolic-ref", "--short", "HEAD")
+		dstDir := filepath.Join(t.TempDir(), "clone")
+		git(t, srcDir, "clone", "-q", srcDir, dstDir)
+		commitFile(t, srcDir, "server.txt", "from server")
+		bundlePath := filepath.Join(t.TempDir(), "ahead.bundle")
+		git(t, srcDir, "bundle", "create", bundlePath, "--all")
+
+		// An untracked file in the way is not a diverged history
+		if err := os.WriteFile(filepath.Join(dstDir, "server.txt"), []byte("local"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := NewRepo(dstDir).Merge(t.Context(), bundlePath, branch, MergeOptions{Strategy: StrategyFFOnly})
+		if err == nil || errors.Is(err, ErrNonFastForward) || !strings.Contains(err.Error(), "server.txt") {
+			t.Fatalf("Expected git's error about server.txt, got %v", err)
+		}
+	})
+
+	t.Run("fetch-only leaves the branch alone", func(t *testing.T) {
+		srcDir, dstDir, bundlePath, branch := setupDivergedRepos(t)
+
+		before := git(t, dstDir, "rev-parse", "HEAD")
+		if err := NewRepo(dstDir).Merge(t.Context(), bundlePath, branch, MergeOptions{Strategy: StrategyFetchOnly, Remote: "lab"}); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		if after := git(t, dstDir, "rev-parse", "HEAD"); after != before {
+			t.Error("fetch-only moved HEAD")
+		}
+		if got, want := git(t, dstDir, "rev-parse", RemotePrefix("lab")+branch), git(t, srcDir, "rev-parse", "HEAD"); got != want {
+			t.Errorf("Tracking ref at %s, want %s", got, want)
+		}
+		if refs := git(t, dstDir, "for-each-ref", RemotePrefix(DefaultRemote)); refs != "" {
+			t.Errorf("Expected nothing fetched outside the remote's namespace, got %s", refs)
+		}
+	})
+
+	t.Run("rebase keeps history linear", func(t *testing.T) {
+		_, dstDir, bundlePath, branch := setupDivergedRepos(t)
+
+		if err := NewRepo(dstDir).Merge(t.Context(), bundlePath, branch, MergeOptions{Strategy: StrategyRebase}); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		if merges := git(t, dstDir, "rev-list", "--merges", "--count", "HEAD"); merges != "0" {
+			t.Errorf("Expected no merge commits, got %s", merges)
+		}
+		// Fails the test unless the server commit is now part of HEAD
+		git(t, dstDir, "merge-base", "--is-ancestor", RemotePrefix(DefaultRemote)+branch, "HEAD")
+	})
+
+	t.Run("merge creates a merge commit", func(t *testing.T) {
+		_, dstDir, bundlePath, branch := setupDivergedRepos(t)
+
+		if err := NewRepo(dstDir).Merge(t.Context(), bundlePath, branch, MergeOptions{Strategy: StrategyMerge}); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		if merges := git(t, dstDir, "rev-list", "--merges", "--count", "HEAD"); merges != "1" {
+			t.Errorf("Expected one merge commit, got %s", merges)
+		}
+	})
+
+	t.Run("missing branch is an error", func(t *testing.T) {
+		_, dstDir, bundlePath, _ := setupDivergedRepos(t)
+
+		if err := NewRepo(dstDir).Merge(t.Context(), bundlePath, "does-not-exist", MergeOptions{}); err == nil {
+			t.Error("Expected an error for a branch missing from the bundle")
+		}
+	})
+}
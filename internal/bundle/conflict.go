@@ -0,0 +1,126 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConflictError is returned by Merge when integrating a bundle stops on conflicts.
+// It lists the conflicted paths and the commits on each side that touched them.
+type ConflictError struct {
+	Branch        string   `json:"branch"`
+	Strategy      Strategy `json:"strategy"`
+	Ours          string   `json:"ours"`
+	Theirs        string   `json:"theirs"`
+	Paths         []string `json:"paths"`
+	OursCommits   []string `json:"ours_commits"`
+	TheirsCommits []string `json:"theirs_commits"`
+	Aborted       bool     `json:"aborted"`
+}
+
+func (e *ConflictError) Error() string {
+	state := "left in progress"
+	if e.Aborted {
+		state = "aborted"
+	}
+	return fmt.Sprintf("%s of %s conflicted in %d file(s) (%s): %s",
+		e.Strategy, e.Branch, len(e.Paths), state, strings.Join(e.Paths, ", "))
+}
+
+// detectConflict inspects the repository after a failed merge or rebase and returns a
+// ConflictError if there are unmerged paths, or nil if the failure had another cause.
+func (r *Repo) detectConflict(ctx context.Context, branch string, strategy Strategy, ours, theirs string) *ConflictError {
+	paths := r.UnmergedPaths(ctx)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	conflict := &ConflictError{
+		Branch:   branch,
+		Strategy: strategy,
+		Ours:     ours,
+		Theirs:   theirs,
+		Paths:    paths,
+	}
+
+	if base := r.lines(ctx, "merge-base", ours, theirs); len(base) == 1 {
+		logArgs := func(tip string) []string {
+			return append([]string{"log", "--format=%h %s", base[0] + ".." + tip, "--"}, paths...)
+		}
+		conflict.OursCommits = r.lines(ctx, logArgs(ours)...)
+		conflict.TheirsCommits = r.lines(ctx, logArgs(theirs)...)
+	}
+
+	return conflict
+}
+
+// abortIntegration restores the pre-merge state after a conflicted merge or rebase.
+func (r *Repo) abortIntegration(ctx context.Context, strategy Strategy) error {
+	args := []string{"merge", "--abort"}
+	if strategy == StrategyRebase {
+		args = []string{"rebase", "--abort"}
+	}
+	// Aborting must complete even if the merge was interrupted
+	if output, err := r.command(context.WithoutCancel(ctx), args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s failed: %s", strings.Join(args, " "), string(output))
+	}
+	return nil
+}
+
+// UnmergedPaths returns the paths of the repository that still have unresolved conflicts.
+func (r *Repo) UnmergedPaths(ctx context.Context) []string {
+	return r.lines(ctx, "diff", "--name-only", "--diff-filter=U")
+}
+
+// InProgress returns the strategy of an interrupted merge or rebase in the repository,
+// or an empty Strategy if neither is in progress.
+func (r *Repo) InProgress(ctx context.Context) Strategy {
+	switch {
+	case r.gitPathExists(ctx, "rebase-merge"), r.gitPathExists(ctx, "rebase-apply"):
+		return StrategyRebase
+	case r.gitPathExists(ctx, "MERGE_HEAD"):
+		return StrategyMerge
+	}
+	return ""
+}
+
+// Continue completes an interrupted merge or rebase once every conflict is staged. A
+// rebase that stops again on a later commit returns a *ConflictError.
+func (r *Repo) Continue(ctx context.Context, branch string) error {
+	strategy := r.InProgress(ctx)
+	if strategy == "" {
+		return fmt.Errorf("no merge or rebase in progress")
+	}
+	if paths := r.UnmergedPaths(ctx); len(paths) > 0 {
+		return fmt.Errorf("unresolved conflicts remain in: %s", strings.Join(paths, ", "))
+	}
+
+	args := []string{"commit", "--no-edit"}
+	if strategy == StrategyRebase {
+		args = []string{"-c", "core.editor=true", "-c", "merge.conflictStyle=diff3", "rebase", "--continue"}
+	}
+
+	if output, err := r.command(ctx, args...).CombinedOutput(); err != nil {
+		ours := r.lines(ctx, "rev-parse", "HEAD")
+		theirs := r.lines(ctx, "rev-parse", "REBASE_HEAD")
+		if len(ours) == 1 && len(theirs) == 1 {
+			if conflict := r.detectConflict(ctx, branch, strategy, ours[0], theirs[0]); conflict != nil {
+				return conflict
+			}
+		}
+		return fmt.Errorf("git %s failed: %s", strings.Join(args, " "), string(output))
+	}
+	return nil
+}
+
+// gitPathExists reports whether a file or directory exists inside the .git directory.
+func (r *Repo) gitPathExists(ctx context.Context, name string) bool {
+	path, err := r.gitPath(ctx, name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
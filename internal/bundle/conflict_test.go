@@ -0,0 +1,114 @@
+package bundle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupConflictingRepos returns a clone and a bundle of its source where both sides
+// changed file.txt differently.
+func setupConflictingRepos(t *testing.T) (dstDir, bundlePath, branch string) {
+	srcDir := setupTestRepo(t)
+	branch = git(t, srcDir, "symbolic-ref", "--short", "HEAD")
+
+	dstDir = filepath.Join(t.TempDir(), "clone")
+	git(t, srcDir, "clone", "-q", srcDir, dstDir)
+	git(t, dstDir, "config", "user.email", "test@example.com")
+	git(t, dstDir, "config", "user.name", "Test User")
+
+	commitFile(t, srcDir, "file.txt", "server version")
+	commitFile(t, dstDir, "file.txt", "laptop version")
+
+	bundlePath = filepath.Join(t.TempDir(), "conflict.bundle")
+	git(t, srcDir, "bundle", "create", bundlePath, "--all")
+	return dstDir, bundlePath, branch
+}
+
+func TestMergeReportsConflicts(t *testing.T) {
+	for _, strategy := range []Strategy{StrategyMerge, StrategyRebase} {
+		t.Run(string(strategy), func(t *testing.T) {
+			dstDir, bundlePath, branch := setupConflictingRepos(t)
+			before := git(t, dstDir, "rev-parse", "HEAD")
+
+			err := NewRepo(dstDir).Merge(t.Context(), bundlePath, branch, MergeOptions{Strategy: strategy, AbortOnConflict: true})
+
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("Expected *ConflictError, got %v", err)
+			}
+			if len(conflict.Paths) != 1 || conflict.Paths[0] != "file.txt" {
+				t.Errorf("Expected file.txt to be conflicted, got %v", conflict.Paths)
+			}
+			if conflict.Ours != before {
+				t.Errorf("Expected ours %s, got %s", before, conflict.Ours)
+			}
+			if len(conflict.OursCommits) != 1 || len(conflict.TheirsCommits) != 1 {
+				t.Errorf("Expected one commit per side, got %v and %v", conflict.OursCommits, conflict.TheirsCommits)
+			}
+			if !conflict.Aborted {
+				t.Error("Expected conflict to be aborted")
+			}
+
+			if after := git(t, dstDir, "rev-parse", "HEAD"); after != before {
+				t.Error("HEAD was not restored after abort")
+			}
+			if status := git(t, dstDir, "status", "--porcelain"); status != "" {
+				t.Errorf("Working tree not clean after abort: %s", status)
+			}
+		})
+	}
+}
+
+func TestMergeLeavesConflictInProgress(t *testing.T) {
+	dstDir, bundlePath, branch := setupConflictingRepos(t)
+
+	err := NewRepo(dstDir).Merge(t.Context(), bundlePath, branch, MergeOptions{Strategy: StrategyMerge})
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Aborted {
+		t.Fatalf("Expected an in-progress *ConflictError, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, ".git", "MERGE_HEAD")); err != nil {
+		t.Error("Expected the merge to be left in progress")
+	}
+}
+
+func TestContinueAfterResolving(t *testing.T) {
+	for _, strategy := range []Strategy{StrategyMerge, StrategyRebase} {
+		t.Run(string(strategy), func(t *testing.T) {
+			dstDir, bundlePath, branch := setupConflictingRepos(t)
+			repo := NewRepo(dstDir)
+			ctx := t.Context()
+
+			if repo.InProgress(ctx) != "" {
+				t.Fatal("Expected nothing in progress before merging")
+			}
+			repo.Merge(ctx, bundlePath, branch, MergeOptions{Strategy: strategy})
+
+			if got := repo.InProgress(ctx); got != strategy {
+				t.Fatalf("Expected %s in progress, got %q", strategy, got)
+			}
+			if err := repo.Continue(ctx, branch); err == nil {
+				t.Fatal("Expected Continue to refuse unresolved conflicts")
+			}
+
+			os.WriteFile(filepath.Join(dstDir, "file.txt"), []byte("resolved"), 0644)
+			git(t, dstDir, "add", "file.txt")
+			if paths := repo.UnmergedPaths(ctx); len(paths) != 0 {
+				t.Fatalf("Expected no unmerged paths, got %v", paths)
+			}
+
+			if err := repo.Continue(ctx, branch); err != nil {
+				t.Fatalf("Continue failed: %v", err)
+			}
+			if repo.InProgress(ctx) != "" {
+				t.Error("Expected the merge or rebase to be completed")
+			}
+			if status := git(t, dstDir, "status", "--porcelain"); status != "" {
+				t.Errorf("Working tree not clean: %s", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package bundle
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
+)
+
+// EncryptedExt is appended to the name of a bundle encrypted with age.
+const EncryptedExt = ".age"
+
+// ageHeader is the first line of every binary age file.
+const ageHeader = "age-encryption.org/v1"
+
+// ErrMissingKey is returned when none of the available identities can decrypt a bundle.
+var ErrMissingKey = errors.New("no identity available to decrypt bundle")
+
+// IsEncrypted reports whether the file at path is an age-encrypted bundle.
+func IsEncrypted(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(line) == ageHeader
+}
+
+// Encrypt encrypts the bundle at path for the given recipients and removes the
+// plaintext file. Recipients may be age public keys (age1...), SSH public keys
+// (ssh-ed25519 ..., ssh-rsa ...) or paths to age recipients files.
+// It returns the path of the encrypted bundle.
+func Encrypt(path string, recipients []string) (string, error) {
+	parsed, err := parseRecipients(recipients)
+	if err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer in.Close()
+
+	encPath := path + EncryptedExt
+	out, err := os.Create(encPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create encrypted bundle: %w", err)
+	}
+	defer out.Close()
+
+	w, err := age.Encrypt(out, parsed...)
+	if err != nil {
+		os.Remove(encPath)
+		return "", fmt.Errorf("failed to initialize encryption: %w", err)
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		os.Remove(encPath)
+		return "", fmt.Errorf("failed to encrypt bundle: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(encPath)
+		return "", fmt.Errorf("failed to finalize encrypted bundle: %w", err)
+	}
+
+	in.Close()
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("failed to remove plaintext bundle: %w", err)
+	}
+
+	return encPath, nil
+}
+
+// Decrypt decrypts an age-encrypted bundle into outputPath using the identity files
+// provided. When no identities are configured, the default SSH keys in ~/.ssh are tried.
+// It returns an error wrapping ErrMissingKey if none of the identities match.
+func Decrypt(path, outputPath string, identityPaths []string) error {
+	identities, err := loadIdentities(identityPaths)
+	if err != nil {
+		return err
+	}
+	if len(identities) == 0 {
+		return fmt.Errorf("%w: %s (set bundle.encryption.identities)", ErrMissingKey, filepath.Base(path))
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open encrypted bundle: %w", err)
+	}
+	defer in.Close()
+
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return fmt.Errorf("%w: %s (set bundle.encryption.identities)", ErrMissingKey, filepath.Base(path))
+		}
+		return fmt.Errorf("failed to decrypt bundle: %w", err)
+	}
+
+	// The plaintext is only for the owner, also when it replaces an earlier file
+	out, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create decrypted bundle: %w", err)
+	}
+	defer out.Close()
+	if err := out.Chmod(0o600); err != nil {
+		return fmt.Errorf("failed to create decrypted bundle: %w", err)
+	}
+
+	if _, err := io.Copy(out, r); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to decrypt bundle: %w", err)
+	}
+
+	return nil
+}
+
+// Open returns the path of a plaintext copy of the bundle at path. Encrypted bundles
+// are decrypted into a temporary file next to the original; plaintext bundles are
+// returned as-is. The returned cleanup function removes any temporary file.
+func Open(path string, identityPaths []string) (string, func(), error) {
+	if !IsEncrypted(path) {
+		return path, func() {}, nil
+	}
+
+	plainPath := strings.TrimSuffix(path, EncryptedExt)
+	if plainPath == path {
+		plainPath = path + ".plain"
+	}
+
+	if err := Decrypt(path, plainPath, identityPaths); err != nil {
+		return "", func() {}, err
+	}
+
+	return plainPath, func() { os.Remove(plainPath) }, nil
+}
+
+// ServerRecipients returns recipients as lines for an age recipients file on the server,
+// which has none of the local recipients files: those are read here, and comments of
+// SSH keys are dropped. Every recipient is checked like Encrypt does.
+func ServerRecipients(recipients []string) ([]string, error) {
+	var lines []string
+	for _, r := range recipients {
+		r = strings.TrimSpace(r)
+		if r != "" && !strings.HasPrefix(r, "age1") && !strings.HasPrefix(r, "ssh-") {
+			data, err := os.ReadFile(utils.ExpandHome(r))
+			if err != nil {
+				return nil, fmt.Errorf("failed to open recipients file: %w", err)
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					lines = append(lines, line)
+				}
+			}
+			continue
+		}
+		lines = append(lines, r)
+	}
+
+	var out []string
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if fields := strings.Fields(line); strings.HasPrefix(line, "ssh-") && len(fields) > 2 {
+			line = fields[0] + " " + fields[1]
+		}
+		if _, err := parseRecipients([]string{line}); err != nil {
+			return nil, err
+		}
+		out = append(out, line)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no encryption recipients configured")
+	}
+	return out, nil
+}
+
+func parseRecipients(recipients []string) ([]age.Recipient, error) {
+	var parsed []age.Recipient
+	for _, r := range recipients {
+		r = strings.TrimSpace(r)
+		switch {
+		case r == "":
+			continue
+		case strings.HasPrefix(r, "age1"):
+			rec, err := age.ParseX25519Recipient(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient %q: %w", r, err)
+			}
+			parsed = append(parsed, rec)
+		case strings.HasPrefix(r, "ssh-"):
+			rec, err := agessh.ParseRecipient(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SSH recipient %q: %w", r, err)
+			}
+			parsed = append(parsed, rec)
+		default:
+			f, err := os.Open(utils.ExpandHome(r))
+			if err != nil {
+				return nil, fmt.Errorf("failed to open recipients file: %w", err)
+			}
+			recs, err := age.ParseRecipients(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse recipients file %s: %w", r, err)
+			}
+			parsed = append(parsed, recs...)
+		}
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no encryption recipients configured")
+	}
+	return parsed, nil
+}
+
+func loadIdentities(identityPaths []string) ([]age.Identity, error) {
+	explicit := len(identityPaths) > 0
+	if !explicit {
+		homeDir, _ := os.UserHomeDir()
+		identityPaths = []string{
+			filepath.Join(homeDir, ".ssh", "id_ed25519"),
+			filepath.Join(homeDir, ".ssh", "id_rsa"),
+		}
+	}
+
+	var identities []age.Identity
+	for _, p := range identityPaths {
+		data, err := os.ReadFile(utils.ExpandHome(p))
+		if err != nil {
+			if explicit {
+				return nil, fmt.Errorf("failed to read identity file: %w", err)
+			}
+			continue
+		}
+
+		if strings.Contains(string(data), "PRIVATE KEY") {
+			// Passphrase-protected SSH keys cannot be used non-interactively
+			id, err := agessh.ParseIdentity(data)
+			if err != nil {
+				if explicit {
+					return nil, fmt.Errorf("failed to parse SSH identity %s: %w", p, err)
+				}
+				continue
+			}
+			identities = append(identities, id)
+			continue
+		}
+
+		ids, err := age.ParseIdentities(strings.NewReader(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity file %s: %w", p, err)
+		}
+		identities = append(identities, ids...)
+	}
+
+	return identities, nil
+}
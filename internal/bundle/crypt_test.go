@@ -0,0 +1,182 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+func writeAgeIdentity(t *testing.T) (string, *age.X25519Identity) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(path, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, id
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "test.bundle")
+	if err := os.WriteFile(bundlePath, []byte("# v2 git bundle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath, id := writeAgeIdentity(t)
+
+	encPath, err := Encrypt(bundlePath, []string{id.Recipient().String()})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if encPath != bundlePath+EncryptedExt {
+		t.Errorf("Expected %s, got %s", bundlePath+EncryptedExt, encPath)
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Error("Plaintext bundle was not removed")
+	}
+	if !IsEncrypted(encPath) {
+		t.Error("IsEncrypted returned false for encrypted bundle")
+	}
+
+	plainPath, cleanup, err := Open(encPath, []string{keyPath})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer cleanup()
+
+	data, err := os.ReadFile(plainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# v2 git bundle\n" {
+		t.Errorf("Unexpected decrypted content: %q", data)
+	}
+	if info, err := os.Stat(plainPath); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the decrypted bundle to be readable by the owner only, got %v", info.Mode())
+	}
+
+	// Replacing a readable file leaves it private too
+	other := filepath.Join(dir, "other.bundle")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Decrypt(encPath, other, []string{keyPath}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(other); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected an overwritten file to become private, got %v", info.Mode())
+	}
+}
+
+func TestDecryptMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "test.bundle")
+	os.WriteFile(bundlePath, []byte("data"), 0644)
+
+	_, id := writeAgeIdentity(t)
+	otherKeyPath, _ := writeAgeIdentity(t)
+
+	encPath, err := Encrypt(bundlePath, []string{id.Recipient().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Decrypt(encPath, filepath.Join(dir, "out.bundle"), []string{otherKeyPath})
+	if !errors.Is(err, ErrMissingKey) {
+		t.Errorf("Expected ErrMissingKey, got %v", err)
+	}
+}
+
+func TestEncryptSSHRecipient(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600)
+
+	bundlePath := filepath.Join(dir, "test.bundle")
+	os.WriteFile(bundlePath, []byte("data"), 0644)
+
+	encPath, err := Encrypt(bundlePath, []string{string(ssh.MarshalAuthorizedKey(sshPub))})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	if err := Decrypt(encPath, bundlePath, []string{keyPath}); err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+}
+
+func TestServerRecipients(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub)))
+
+	file := filepath.Join(t.TempDir(), "recipients.txt")
+	os.WriteFile(file, []byte("# team\n"+sshKey+" ops@laptop\n\n"), 0644)
+
+	lines, err := ServerRecipients([]string{id.Recipient().String(), file})
+	if err != nil {
+		t.Fatalf("ServerRecipients failed: %v", err)
+	}
+	if len(lines) != 2 || lines[0] != id.Recipient().String() || lines[1] != sshKey {
+		t.Errorf("Unexpected recipients %q", lines)
+	}
+
+	if _, err := ServerRecipients([]string{"age1invalid"}); err == nil {
+		t.Error("Expected an invalid recipient to be refused")
+	}
+}
+
+func TestOpenPlaintext(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
+	os.WriteFile(bundlePath, []byte("# v2 git bundle\n"), 0644)
+
+	plainPath, cleanup, err := Open(bundlePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+
+	if plainPath != bundlePath {
+		t.Errorf("Expected plaintext bundle to be returned as-is, got %s", plainPath)
+	}
+	if !utils.FileExists(bundlePath) {
+		t.Error("cleanup removed the original bundle")
+	}
+}
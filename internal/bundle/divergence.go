@@ -0,0 +1,88 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SyncState classifies a local branch against its counterpart on the server.
+type SyncState string
+
+const (
+	// SyncUpToDate means both sides are at the same commit.
+	SyncUpToDate SyncState = "up-to-date"
+	// SyncAhead means only the local side has new commits, or the server has no branch yet.
+	SyncAhead SyncState = "ahead"
+	// SyncBehind means only the server has new commits.
+	SyncBehind SyncState = "behind"
+	// SyncDiverged means both sides have commits the other lacks.
+	SyncDiverged SyncState = "diverged"
+)
+
+// ErrUnknownCommit is returned by Compare when the remote tip is not in the repository.
+var ErrUnknownCommit = errors.New("commit not found in repository")
+
+// Divergence describes how a local and a remote tip relate. Ahead and Behind count the
+// commits only the local side and only the remote side have; they are -1 when unknown,
+// e.g. when both sides have diverged and neither has the other's commits.
+type Divergence struct {
+	State  SyncState `json:"state"`
+	Local  string    `json:"local"`
+	Remote string    `json:"remote,omitempty"`
+	Base   string    `json:"base,omitempty"`
+	Ahead  int       `json:"ahead"`
+	Behind int       `json:"behind"`
+}
+
+// Classify returns the sync state for the commits only each side has.
+func Classify(ahead, behind int) SyncState {
+	switch {
+	case ahead == 0 && behind == 0:
+		return SyncUpToDate
+	case behind == 0:
+		return SyncAhead
+	case ahead == 0:
+		return SyncBehind
+	default:
+		return SyncDiverged
+	}
+}
+
+// Unrelated returns the divergence of two tips that are each missing from the other
+// side's repository, so each side has commits the other lacks.
+func Unrelated(local, remote string) *Divergence {
+	return &Divergence{State: SyncDiverged, Local: local, Remote: remote, Ahead: -1, Behind: -1}
+}
+
+// Tip returns the commit a branch points to, or "" if it does not exist.
+func (r *Repo) Tip(ctx context.Context, branch string) string {
+	if tip := r.lines(ctx, "rev-parse", "--verify", "-q", "refs/heads/"+branch+"^{commit}"); len(tip) == 1 {
+		return tip[0]
+	}
+	return ""
+}
+
+// Compare classifies the local commit against the remote one, both of which must be in
+// the repository; ErrUnknownCommit is returned otherwise. An empty remote tip means the
+// server has no such branch, so everything local is ahead.
+func (r *Repo) Compare(ctx context.Context, local, remote string) (*Divergence, error) {
+	if local == "" || !r.hasCommit(ctx, local) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommit, local)
+	}
+	if remote == "" {
+		return &Divergence{State: SyncAhead, Local: local, Ahead: r.countCommits(ctx, []string{local}, nil)}, nil
+	}
+	if !r.hasCommit(ctx, remote) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommit, remote)
+	}
+
+	d := &Divergence{Local: local, Remote: remote}
+	if base := r.lines(ctx, "merge-base", local, remote); len(base) == 1 {
+		d.Base = base[0]
+	}
+	d.Ahead = r.countCommits(ctx, []string{local}, []string{remote})
+	d.Behind = r.countCommits(ctx, []string{remote}, []string{local})
+	d.State = Classify(d.Ahead, d.Behind)
+	return d, nil
+}
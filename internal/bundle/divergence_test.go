@@ -0,0 +1,57 @@
+package bundle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		ahead, behind int
+		want          SyncState
+	}{
+		{0, 0, SyncUpToDate},
+		{3, 0, SyncAhead},
+		{0, 2, SyncBehind},
+		{1, 1, SyncDiverged},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.ahead, tt.behind); got != tt.want {
+			t.Errorf("Classify(%d, %d) = %s, want %s", tt.ahead, tt.behind, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	dir := setupTestRepo(t)
+	repo := NewRepo(dir)
+	ctx := t.Context()
+	branch := git(t, dir, "symbolic-ref", "--short", "HEAD")
+	base := repo.Tip(ctx, branch)
+
+	git(t, dir, "checkout", "-q", "-b", "other")
+	commitFile(t, dir, "other.txt", "other")
+	other := repo.Tip(ctx, "other")
+	git(t, dir, "checkout", "-q", branch)
+	commitFile(t, dir, "file.txt", "one")
+	commitFile(t, dir, "file.txt", "two")
+	local := repo.Tip(ctx, branch)
+
+	d, err := repo.Compare(ctx, local, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.State != SyncDiverged || d.Ahead != 2 || d.Behind != 1 || d.Base != base {
+		t.Errorf("Expected 2 ahead and 1 behind of %s, got %+v", base, d)
+	}
+
+	if d, err := repo.Compare(ctx, base, local); err != nil || d.State != SyncBehind {
+		t.Errorf("Expected behind, got %+v (%v)", d, err)
+	}
+	if _, err := repo.Compare(ctx, local, "0123456789012345678901234567890123456789"); !errors.Is(err, ErrUnknownCommit) {
+		t.Errorf("Expected ErrUnknownCommit, got %v", err)
+	}
+	if repo.Tip(ctx, "no-such-branch") != "" {
+		t.Error("Expected no tip for a missing branch")
+	}
+}
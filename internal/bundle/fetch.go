@@ -0,0 +1,74 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RefUpdate is a ref changed by FetchRemote. Old is empty for a new ref and New for a
+// pruned one.
+type RefUpdate struct {
+	Ref string `json:"ref"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// RemotePrefix returns the ref namespace that FetchRemote and Merge fetch branches into.
+func RemotePrefix(name string) string {
+	return "refs/remotes/" + name + "/"
+}
+
+// FetchRemote fetches every branch in a bundle into refs/remotes/<name>/* and changes
+// nothing else: local branches, tags, the index and the working tree are left alone.
+// Refs in the namespace whose branch is no longer in the bundle are pruned, so the
+// namespace mirrors the branches of the side that created the bundle. The changed refs
+// are returned sorted by name.
+func (r *Repo) FetchRemote(ctx context.Context, bundlePath, name string) ([]RefUpdate, error) {
+	prefix := RemotePrefix(name)
+	if name == "" || !r.succeeds(ctx, "check-ref-format", prefix+"HEAD") {
+		return nil, fmt.Errorf("invalid remote name %q", name)
+	}
+	bundlePath, err := absPath(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if output, err := r.command(ctx, "bundle", "verify", bundlePath).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("invalid or incompatible bundle: %v: %s", err, string(output))
+	}
+
+	before := r.RefTips(ctx, prefix)
+	fetchCmd := r.command(ctx, "fetch", "--no-recurse-submodules", "--no-tags", "--prune",
+		bundlePath, "+refs/heads/*:"+prefix+"*")
+	if output, err := fetchCmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to fetch from bundle: %s", string(output))
+	}
+	after := r.RefTips(ctx, prefix)
+
+	var updates []RefUpdate
+	for ref, tip := range after {
+		if before[ref] != tip {
+			updates = append(updates, RefUpdate{Ref: ref, Old: before[ref], New: tip})
+		}
+	}
+	for ref, tip := range before {
+		if _, ok := after[ref]; !ok {
+			updates = append(updates, RefUpdate{Ref: ref, Old: tip})
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].Ref < updates[j].Ref })
+	return updates, nil
+}
+
+// RefTips maps the refs under prefix to the objects they point to.
+func (r *Repo) RefTips(ctx context.Context, prefix string) map[string]string {
+	tips := make(map[string]string)
+	for _, line := range r.lines(ctx, "for-each-ref", "--format=%(refname) %(objectname)", prefix) {
+		if ref, tip, ok := strings.Cut(line, " "); ok {
+			tips[ref] = tip
+		}
+	}
+	return tips
+}
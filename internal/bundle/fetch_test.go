@@ -0,0 +1,80 @@
+package bundle
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFetchRemote(t *testing.T) {
+	serverDir := setupTestRepo(t)
+	branch := git(t, serverDir, "symbolic-ref", "--short", "HEAD")
+	git(t, serverDir, "branch", "feature")
+	git(t, serverDir, "branch", "old")
+	git(t, serverDir, "tag", "v1")
+
+	localDir := t.TempDir()
+	git(t, localDir, "clone", "-q", serverDir, ".")
+	localHead := git(t, localDir, "rev-parse", "HEAD")
+
+	server := NewRepo(serverDir)
+	local := NewRepo(localDir)
+	ctx := t.Context()
+
+	commitFile(t, serverDir, "server.txt", "server work")
+	first := filepath.Join(t.TempDir(), "first.bundle")
+	if err := server.CreateFull(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	updates, err := local.FetchRemote(ctx, first, "lab")
+	if err != nil {
+		t.Fatalf("FetchRemote failed: %v", err)
+	}
+	var refs []string
+	for _, u := range updates {
+		if u.Old != "" || u.New == "" {
+			t.Errorf("Expected only new refs, got %+v", u)
+		}
+		refs = append(refs, u.Ref)
+	}
+	want := []string{"refs/remotes/lab/" + branch, "refs/remotes/lab/feature", "refs/remotes/lab/old"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("Expected %v, got %v", want, refs)
+	}
+
+	// Nothing outside the namespace moves
+	if head := git(t, localDir, "rev-parse", "HEAD"); head != localHead {
+		t.Error("FetchRemote moved the current branch")
+	}
+	if git(t, localDir, "status", "--porcelain") != "" {
+		t.Error("FetchRemote touched the working tree")
+	}
+	if git(t, localDir, "rev-parse", "lab/"+branch) != git(t, serverDir, "rev-parse", "HEAD") {
+		t.Error("Expected the server branch under refs/remotes/lab")
+	}
+
+	// Branches deleted on the server are pruned, moved ones updated
+	git(t, serverDir, "branch", "-D", "old")
+	commitFile(t, serverDir, "server.txt", "more server work")
+	second := filepath.Join(t.TempDir(), "second.bundle")
+	if err := server.CreateFull(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	updates, err = local.FetchRemote(ctx, second, "lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[0].Ref != "refs/remotes/lab/"+branch || updates[0].Old == "" || updates[0].New == "" ||
+		updates[1].Ref != "refs/remotes/lab/old" || updates[1].New != "" {
+		t.Errorf("Expected %s to move and old to be pruned, got %+v", branch, updates)
+	}
+
+	if updates, err := local.FetchRemote(ctx, second, "lab"); err != nil || len(updates) != 0 {
+		t.Errorf("Expected no changes on a repeated fetch, got %+v (%v)", updates, err)
+	}
+	if _, err := local.FetchRemote(ctx, second, "bad..name"); err == nil {
+		t.Error("Expected an invalid remote name to be rejected")
+	}
+}
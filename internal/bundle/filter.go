@@ -0,0 +1,68 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FilterExt is appended to a bundle name to form the name of the file holding the object
+// filter the bundle was created with, see CreateFiltered.
+const FilterExt = ".filter"
+
+// FilterOptions selects the objects left out of a bundle.
+type FilterOptions struct {
+	// Spec is a git object filter, e.g. "blob:none" or "blob:limit=1m".
+	Spec string
+	// Checkout lists revisions whose files are always included, whatever the filter,
+	// so the receiving side can check them out.
+	Checkout []string
+}
+
+// CreateFiltered creates a bundle of all branches and tags that omits the objects
+// excluded by opts.Spec, like the pack of a partial clone. git bundle create cannot
+// filter objects, so the bundle is written directly, see writeBundle. The filter is written next to the bundle (see
+// FilterExt); the receiving side must store the pack as a promisor pack, making its
+// repository a partial clone whose missing objects can be backfilled from later bundles.
+func (r *Repo) CreateFiltered(ctx context.Context, outputPath string, opts FilterOptions) error {
+	if opts.Spec == "" {
+		return fmt.Errorf("filtered bundle needs an object filter")
+	}
+	refs := r.lines(ctx, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	if len(refs) == 0 {
+		return fmt.Errorf("no branches found to bundle")
+	}
+
+	// Objects named explicitly are packed even when the filter excludes them
+	var blobs []string
+	for _, rev := range opts.Checkout {
+		for _, entry := range r.lines(ctx, "ls-tree", "-r", rev) {
+			if fields := strings.Fields(entry); len(fields) >= 3 && fields[1] == "blob" {
+				blobs = append(blobs, fields[2])
+			}
+		}
+	}
+
+	if err := r.writeBundle(ctx, outputPath, refs, nil, blobs, "--filter="+opts.Spec); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath+FilterExt, []byte(opts.Spec+"\n"), 0644); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to write object filter: %w", err)
+	}
+	return nil
+}
+
+// ReadFilter returns the object filter written next to a bundle by CreateFiltered, or
+// "" for a complete bundle. Encrypted bundles share the file of their plaintext name.
+func ReadFilter(bundlePath string) (string, error) {
+	data, err := os.ReadFile(strings.TrimSuffix(bundlePath, EncryptedExt) + FilterExt)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,59 @@
+package bundle
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateFiltered(t *testing.T) {
+	srcDir := setupTestRepo(t)
+	commitFile(t, srcDir, "asset.bin", "old asset")
+	oldBlob := git(t, srcDir, "rev-parse", "HEAD:asset.bin")
+	commitFile(t, srcDir, "asset.bin", "new asset")
+	newBlob := git(t, srcDir, "rev-parse", "HEAD:asset.bin")
+	branch := git(t, srcDir, "symbolic-ref", "--short", "HEAD")
+
+	repo := NewRepo(srcDir)
+	ctx := t.Context()
+	bundlePath := filepath.Join(t.TempDir(), "filtered.bundle")
+	if err := repo.CreateFiltered(ctx, bundlePath, FilterOptions{Spec: "blob:none", Checkout: []string{branch}}); err != nil {
+		t.Fatalf("CreateFiltered failed: %v", err)
+	}
+
+	header, err := ReadHeader(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Refs) == 0 || len(header.Prerequisites) != 0 {
+		t.Errorf("Expected a complete bundle of all branches, got %+v", header)
+	}
+	if filter, _ := ReadFilter(bundlePath + EncryptedExt); filter != "blob:none" {
+		t.Errorf("Expected the filter next to the bundle, got %q", filter)
+	}
+	m, err := repo.NewManifest(ctx, bundlePath, DirectionPush)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Filter != "blob:none" || m.CommitCount != 3 {
+		t.Errorf("Expected a filtered manifest with 3 commits, got %q and %d", m.Filter, m.CommitCount)
+	}
+
+	// The pack holds the checked-out files but not their history
+	dstDir := t.TempDir()
+	git(t, dstDir, "init", "-q")
+	git(t, dstDir, "bundle", "unbundle", bundlePath)
+	if err := exec.Command("git", "-C", dstDir, "cat-file", "-e", newBlob).Run(); err != nil {
+		t.Error("Expected the blob of the checked-out branch in the bundle")
+	}
+	if err := exec.Command("git", "-C", dstDir, "cat-file", "-e", oldBlob).Run(); err == nil {
+		t.Error("Expected older blobs to be filtered out")
+	}
+
+	if err := repo.CreateFiltered(ctx, bundlePath, FilterOptions{Spec: "no-such-filter"}); err == nil {
+		t.Error("Expected an invalid filter to fail")
+	}
+	if filter, err := ReadFilter(filepath.Join(t.TempDir(), "plain.bundle")); err != nil || filter != "" {
+		t.Errorf("Expected no filter for a plain bundle, got %q (%v)", filter, err)
+	}
+}
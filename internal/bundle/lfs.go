@@ -0,0 +1,312 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LFSExt is appended to a bundle name to form the name of its Git LFS object archive.
+const LFSExt = ".lfs.tar"
+
+// lfsPointerMaxSize bounds the blobs inspected for LFS pointers; real pointers are
+// around 130 bytes.
+const lfsPointerMaxSize = 1024
+
+// ErrCorruptLFSObject is returned by InstallLFS when an archived object does not match its oid.
+var ErrCorruptLFSObject = errors.New("corrupt LFS object")
+
+// LFSObject is a Git LFS object referenced by a pointer file.
+type LFSObject struct {
+	OID  string
+	Size int64
+}
+
+// LFSPointers returns the LFS objects referenced by pointer files in the commits selected
+// by revs, e.g. a tip and ^prerequisite exclusions. Each object is listed once.
+func (r *Repo) LFSPointers(ctx context.Context, revs ...string) ([]LFSObject, error) {
+	revList := r.command(ctx, append([]string{"rev-list", "--objects"}, revs...)...)
+	revOut, err := revList.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list failed: %w", err)
+	}
+
+	var oids bytes.Buffer
+	for _, line := range strings.Split(string(revOut), "\n") {
+		if oid, _, _ := strings.Cut(line, " "); oid != "" {
+			oids.WriteString(oid + "\n")
+		}
+	}
+
+	// Only small blobs can be pointers, so avoid reading anything else
+	check := r.command(ctx, "cat-file", "--batch-check=%(objecttype) %(objectname) %(objectsize)")
+	check.Stdin = &oids
+	checkOut, err := check.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+
+	var candidates bytes.Buffer
+	for _, line := range strings.Split(string(checkOut), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "blob" {
+			continue
+		}
+		if size, _ := strconv.Atoi(fields[2]); size <= lfsPointerMaxSize {
+			candidates.WriteString(fields[1] + "\n")
+		}
+	}
+
+	batch := r.command(ctx, "cat-file", "--batch")
+	batch.Stdin = &candidates
+	batchOut, err := batch.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+
+	var objects []LFSObject
+	seen := make(map[string]bool)
+	br := bufio.NewReader(bytes.NewReader(batchOut))
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			break
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.Atoi(fields[2])
+		content := make([]byte, size+1) // contents are followed by a newline
+		if _, err := io.ReadFull(br, content); err != nil {
+			return nil, fmt.Errorf("truncated git cat-file output: %w", err)
+		}
+
+		if obj, ok := parseLFSPointer(content[:size]); ok && !seen[obj.OID] {
+			seen[obj.OID] = true
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// parseLFSPointer parses a Git LFS pointer file.
+func parseLFSPointer(data []byte) (LFSObject, bool) {
+	var obj LFSObject
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "version https://git-lfs.github.com/spec/") {
+		return obj, false
+	}
+
+	for _, line := range lines[1:] {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			obj.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			obj.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if len(obj.OID) != 64 {
+		return obj, false
+	}
+	return obj, true
+}
+
+// LFSStore returns the LFS object directory of the repository.
+func (r *Repo) LFSStore(ctx context.Context) (string, error) {
+	output, err := r.command(ctx, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %w", err)
+	}
+	return filepath.Join(r.path(strings.TrimSpace(string(output))), "lfs", "objects"), nil
+}
+
+// lfsObjectPath returns the path of an object inside an LFS store, e.g. ab/cd/abcd...
+func lfsObjectPath(oid string) string {
+	return filepath.Join(oid[0:2], oid[2:4], oid)
+}
+
+// LFSArchive describes an archive written by PackLFS.
+type LFSArchive struct {
+	Path    string
+	Objects []LFSObject
+	// Missing lists oids referenced by the bundle but absent from the local store,
+	// typically because they were never fetched.
+	Missing []string
+}
+
+// PackLFS archives the LFS objects referenced by the commits of the plaintext bundle at
+// bundlePath into <bundle>.lfs.tar, laid out like .git/lfs/objects. Path is empty when
+// none of the referenced objects are available locally, and a nil archive is returned
+// when the bundle references no LFS objects at all.
+func (r *Repo) PackLFS(ctx context.Context, bundlePath string) (*LFSArchive, error) {
+	header, err := ReadHeader(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var revs []string
+	for _, ref := range header.Refs {
+		revs = append(revs, ref.Tip)
+	}
+	for _, prereq := range header.Prerequisites {
+		revs = append(revs, "^"+prereq)
+	}
+	if len(revs) == 0 {
+		return nil, nil
+	}
+	boundary, err := ReadShallow(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	revs = append(revs, r.shallowExclusions(ctx, boundary)...)
+
+	objects, err := r.LFSPointers(ctx, revs...)
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+
+	store, err := r.LFSStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &LFSArchive{}
+	for _, obj := range objects {
+		if _, err := os.Stat(filepath.Join(store, lfsObjectPath(obj.OID))); err != nil {
+			archive.Missing = append(archive.Missing, obj.OID)
+			continue
+		}
+		archive.Objects = append(archive.Objects, obj)
+	}
+	if len(archive.Objects) == 0 {
+		return archive, nil
+	}
+
+	archive.Path = bundlePath + LFSExt
+	if err := writeLFSArchive(archive.Path, store, archive.Objects); err != nil {
+		os.Remove(archive.Path)
+		return nil, err
+	}
+	return archive, nil
+}
+
+func writeLFSArchive(archivePath, store string, objects []LFSObject) error {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create LFS archive: %w", err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, obj := range objects {
+		name := lfsObjectPath(obj.OID)
+		src, err := os.Open(filepath.Join(store, name))
+		if err != nil {
+			return err
+		}
+		info, err := src.Stat()
+		if err != nil {
+			src.Close()
+			return err
+		}
+
+		hdr := &tar.Header{Name: filepath.ToSlash(name), Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.Copy(tw, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("failed to archive LFS object %s: %w", obj.OID, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// InstallLFS extracts an archive written by PackLFS into the LFS store of the
+// repository, verifying every object against its oid. It returns the number of objects
+// installed; objects already in the store are skipped.
+func (r *Repo) InstallLFS(ctx context.Context, archivePath string) (int, error) {
+	store, err := r.LFSStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open LFS archive: %w", err)
+	}
+	defer f.Close()
+
+	installed := 0
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return installed, fmt.Errorf("failed to read LFS archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		oid := filepath.Base(hdr.Name)
+		if len(oid) != 64 {
+			return installed, fmt.Errorf("%w: unexpected entry %s", ErrCorruptLFSObject, hdr.Name)
+		}
+		dest := filepath.Join(store, lfsObjectPath(oid))
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+
+		if err := installLFSObject(tr, dest, oid); err != nil {
+			return installed, err
+		}
+		installed++
+	}
+	return installed, nil
+}
+
+// installLFSObject writes an object to a temporary file next to dest and renames it into
+// place only if its content hashes to oid.
+func installLFSObject(r io.Reader, dest, oid string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), oid+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != oid {
+		return fmt.Errorf("%w: %s", ErrCorruptLFSObject, oid)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
@@ -0,0 +1,114 @@
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addLFSFile commits an LFS pointer for content and stores the object in the repository's
+// LFS store, unless store is false. It returns the object id.
+func addLFSFile(t *testing.T, dir, name, content string, store bool) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+
+	if store {
+		objPath := filepath.Join(dir, ".git", "lfs", "objects", lfsObjectPath(oid))
+		os.MkdirAll(filepath.Dir(objPath), 0755)
+		if err := os.WriteFile(objPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+	commitFile(t, dir, name, pointer)
+	return oid
+}
+
+func TestPackAndInstallLFS(t *testing.T) {
+	srcDir := setupTestRepo(t)
+	oid := addLFSFile(t, srcDir, "model.bin", "large binary content", true)
+	addLFSFile(t, srcDir, "copy.bin", "large binary content", true)
+	missingOID := addLFSFile(t, srcDir, "missing.bin", "never fetched", false)
+
+	bundlePath := filepath.Join(t.TempDir(), "lfs.bundle")
+	src := NewRepo(srcDir)
+	if err := src.CreateFull(t.Context(), bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := src.PackLFS(t.Context(), bundlePath)
+	if err != nil {
+		t.Fatalf("PackLFS failed: %v", err)
+	}
+	if archive.Path != bundlePath+LFSExt {
+		t.Errorf("Unexpected archive path %s", archive.Path)
+	}
+	if len(archive.Objects) != 1 || archive.Objects[0].OID != oid || archive.Objects[0].Size != 20 {
+		t.Errorf("Expected one packed object, got %+v", archive.Objects)
+	}
+	if len(archive.Missing) != 1 || archive.Missing[0] != missingOID {
+		t.Errorf("Expected %s to be reported missing, got %v", missingOID, archive.Missing)
+	}
+
+	dstDir := filepath.Join(t.TempDir(), "clone")
+	git(t, srcDir, "clone", "-q", bundlePath, dstDir)
+	dst := NewRepo(dstDir)
+
+	n, err := dst.InstallLFS(t.Context(), archive.Path)
+	if err != nil {
+		t.Fatalf("InstallLFS failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 object installed, got %d", n)
+	}
+	data, err := os.ReadFile(filepath.Join(dstDir, ".git", "lfs", "objects", lfsObjectPath(oid)))
+	if err != nil || string(data) != "large binary content" {
+		t.Errorf("LFS object not installed: %v", err)
+	}
+
+	// Installing again skips objects that are already present
+	if n, err := dst.InstallLFS(t.Context(), archive.Path); err != nil || n != 0 {
+		t.Errorf("Expected nothing to install, got %d (%v)", n, err)
+	}
+}
+
+func TestPackLFSWithoutPointers(t *testing.T) {
+	repo := NewRepo(setupTestRepo(t))
+	bundlePath := filepath.Join(t.TempDir(), "plain.bundle")
+	if err := repo.CreateFull(t.Context(), bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if archive, err := repo.PackLFS(t.Context(), bundlePath); err != nil || archive != nil {
+		t.Errorf("Expected no archive, got %+v (%v)", archive, err)
+	}
+}
+
+func TestInstallLFSRejectsCorruptObjects(t *testing.T) {
+	repoDir := setupTestRepo(t)
+
+	sum := sha256.Sum256([]byte("expected"))
+	oid := hex.EncodeToString(sum[:])
+	archive := filepath.Join(t.TempDir(), "bad"+LFSExt)
+
+	f, _ := os.Create(archive)
+	tw := tar.NewWriter(f)
+	tw.WriteHeader(&tar.Header{Name: filepath.ToSlash(lfsObjectPath(oid)), Mode: 0644, Size: 8})
+	tw.Write([]byte("tampered"))
+	tw.Close()
+	f.Close()
+
+	if _, err := NewRepo(repoDir).InstallLFS(t.Context(), archive); !errors.Is(err, ErrCorruptLFSObject) {
+		t.Fatalf("Expected ErrCorruptLFSObject, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, ".git", "lfs", "objects", lfsObjectPath(oid))); err == nil {
+		t.Error("Corrupt object was installed")
+	}
+}
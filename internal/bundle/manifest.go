@@ -0,0 +1,279 @@
+package bundle
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManifestExt is appended to a bundle name to form the name of its manifest sidecar.
+const ManifestExt = ".manifest.json"
+
+// Sync directions recorded in a manifest.
+const (
+	DirectionPush   = "push"
+	DirectionPull   = "pull"
+	DirectionBackup = "backup"
+)
+
+// Header is the parsed header of a Git bundle file.
+type Header struct {
+	Version       int
+	Prerequisites []string
+	Refs          []Ref
+}
+
+// Ref is a reference advertised by a bundle.
+type Ref struct {
+	Name    string `json:"name"`
+	Base    string `json:"base,omitempty"`
+	Tip     string `json:"tip"`
+	Commits int    `json:"commits,omitempty"`
+}
+
+// Manifest describes a sync artifact. It is written next to every bundle so that
+// history and pull can show what a bundle contains without unpacking it. Format is empty
+// for bundles and FormatPatch for patch series, which list their Patches. Size and
+// SHA256 are those of the artifact as stored and transferred; PlainSHA256 is the hash of
+// the plaintext bundle when that is encrypted.
+type Manifest struct {
+	Direction     string      `json:"direction"`
+	Format        string      `json:"format,omitempty"`
+	Project       string      `json:"project"`
+	Server        string      `json:"server"`
+	Refs          []Ref       `json:"refs"`
+	Prerequisites []string    `json:"prerequisites,omitempty"`
+	CommitCount   int         `json:"commit_count"`
+	Creator       string      `json:"creator"`
+	Version       string      `json:"gitsynq_version"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Size          int64       `json:"size"`
+	SHA256        string      `json:"sha256"`
+	PlainSHA256   string      `json:"plain_sha256,omitempty"`
+	Compressed    bool        `json:"compressed"`
+	Encrypted     bool        `json:"encrypted"`
+	Signed        bool        `json:"signed"`
+	Volumes       int         `json:"volumes,omitempty"`
+	Shallow       []string    `json:"shallow,omitempty"`
+	Filter        string      `json:"filter,omitempty"`
+	Submodules    []Submodule `json:"submodules,omitempty"`
+	LFSObjects    int         `json:"lfs_objects,omitempty"`
+	Patches       []Patch     `json:"patches,omitempty"`
+}
+
+// ManifestPath returns the manifest sidecar path for a bundle. Encrypted bundles share
+// the manifest of their plaintext name.
+func ManifestPath(bundlePath string) string {
+	return strings.TrimSuffix(bundlePath, EncryptedExt) + ManifestExt
+}
+
+// ReadHeader parses the header of the plaintext Git bundle at path.
+func ReadHeader(path string) (*Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	signature, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle header: %w", err)
+	}
+
+	header := &Header{}
+	switch strings.TrimSpace(signature) {
+	case "# v2 git bundle":
+		header.Version = 2
+	case "# v3 git bundle":
+		header.Version = 3
+	default:
+		return nil, fmt.Errorf("not a git bundle: %s", path)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("truncated bundle header: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@"):
+			// v3 capability, e.g. @object-format=sha1
+		case strings.HasPrefix(line, "-"):
+			oid, _, _ := strings.Cut(line[1:], " ")
+			header.Prerequisites = append(header.Prerequisites, oid)
+		default:
+			oid, name, ok := strings.Cut(line, " ")
+			if !ok {
+				return nil, fmt.Errorf("malformed bundle header line: %q", line)
+			}
+			header.Refs = append(header.Refs, Ref{Name: name, Tip: oid})
+		}
+	}
+
+	return header, nil
+}
+
+// NewManifest builds a manifest for the plaintext bundle at path from its header and
+// contents. Base commits and commit counts are filled in when the bundled commits are
+// available in the repository; the caller sets the descriptive fields.
+func (r *Repo) NewManifest(ctx context.Context, path, direction string) (*Manifest, error) {
+	header, err := ReadHeader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, size, err := hashVolume(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash bundle: %w", err)
+	}
+
+	m := &Manifest{
+		Direction:     direction,
+		Refs:          header.Refs,
+		Prerequisites: header.Prerequisites,
+		Creator:       r.creator(ctx),
+		CreatedAt:     time.Now(),
+		Size:          size,
+		SHA256:        sum,
+	}
+
+	// History behind a shallow boundary is not part of the bundle
+	if m.Shallow, err = ReadShallow(path); err != nil {
+		return nil, err
+	}
+	if m.Filter, err = ReadFilter(path); err != nil {
+		return nil, err
+	}
+	exclude := header.Prerequisites
+	for _, rev := range r.shallowExclusions(ctx, m.Shallow) {
+		exclude = append(exclude, strings.TrimPrefix(rev, "^"))
+	}
+
+	var tips []string
+	for i, ref := range m.Refs {
+		if !r.hasCommit(ctx, ref.Tip) {
+			continue
+		}
+		tips = append(tips, ref.Tip)
+		for _, prereq := range header.Prerequisites {
+			if r.succeeds(ctx, "merge-base", "--is-ancestor", prereq, ref.Tip) {
+				m.Refs[i].Base = prereq
+				break
+			}
+		}
+		m.Refs[i].Commits = r.countCommits(ctx, []string{ref.Tip}, exclude)
+	}
+	if len(tips) > 0 {
+		m.CommitCount = r.countCommits(ctx, tips, exclude)
+	}
+
+	return m, nil
+}
+
+// Write stores the manifest next to the bundle at bundlePath and returns its path.
+func (m *Manifest) Write(bundlePath string) (string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	path := ManifestPath(bundlePath)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return path, nil
+}
+
+// SetArtifact records the size and hash of the artifact at path, the encrypted bundle
+// when the manifest was built from its plaintext, which keeps its hash in PlainSHA256.
+func (m *Manifest) SetArtifact(path string) error {
+	sum, size, err := hashVolume(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash bundle: %w", err)
+	}
+	if sum != m.SHA256 && m.PlainSHA256 == "" {
+		m.PlainSHA256 = m.SHA256
+	}
+	m.SHA256, m.Size = sum, size
+	return nil
+}
+
+// Verify checks that the artifact at path is the one the manifest describes.
+func (m *Manifest) Verify(path string) error {
+	sum, size, err := hashVolume(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash bundle: %w", err)
+	}
+	if sum != m.SHA256 || size != m.Size {
+		return fmt.Errorf("%s does not match its manifest: expected %d bytes with SHA-256 %s, got %d bytes with %s",
+			filepath.Base(path), m.Size, m.SHA256, size, sum)
+	}
+	return nil
+}
+
+// LoadManifest reads the manifest sidecar of the bundle at bundlePath.
+func LoadManifest(bundlePath string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(bundlePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 of the file at path.
+func FileSHA256(path string) (string, error) {
+	sum, _, err := hashVolume(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return sum, nil
+}
+
+func (r *Repo) hasCommit(ctx context.Context, oid string) bool {
+	return r.succeeds(ctx, "cat-file", "-e", oid+"^{commit}")
+}
+
+func (r *Repo) countCommits(ctx context.Context, tips, exclude []string) int {
+	args := append([]string{"rev-list", "--count"}, tips...)
+	for _, oid := range exclude {
+		if r.hasCommit(ctx, oid) {
+			args = append(args, "^"+oid)
+		}
+	}
+
+	output, err := r.command(ctx, args...).Output()
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(output)))
+	return n
+}
+
+// creator identifies who produced a bundle, preferring the Git identity.
+func (r *Repo) creator(ctx context.Context) string {
+	name, _ := r.command(ctx, "config", "user.name").Output()
+	email, _ := r.command(ctx, "config", "user.email").Output()
+	if n, e := strings.TrimSpace(string(name)), strings.TrimSpace(string(email)); n != "" && e != "" {
+		return fmt.Sprintf("%s <%s>", n, e)
+	}
+
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s", os.Getenv("USER"), host)
+}
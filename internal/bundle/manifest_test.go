@@ -0,0 +1,116 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadHeaderWithPrerequisites(t *testing.T) {
+	repoDir := setupTestRepo(t)
+
+	base := git(t, repoDir, "rev-parse", "HEAD")
+	commitFile(t, repoDir, "second.txt", "second")
+	git(t, repoDir, "branch", "-f", "synced", "HEAD~1")
+
+	bundlePath := filepath.Join(t.TempDir(), "incr.bundle")
+	git(t, repoDir, "bundle", "create", bundlePath, "synced..HEAD")
+
+	header, err := ReadHeader(bundlePath)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if len(header.Prerequisites) != 1 || header.Prerequisites[0] != base {
+		t.Errorf("Expected prerequisite %s, got %v", base, header.Prerequisites)
+	}
+	if len(header.Refs) != 1 || header.Refs[0].Name != "HEAD" {
+		t.Errorf("Expected a single HEAD ref, got %v", header.Refs)
+	}
+
+	m, err := NewRepo(repoDir).NewManifest(t.Context(), bundlePath, DirectionPush)
+	if err != nil {
+		t.Fatalf("NewManifest failed: %v", err)
+	}
+	if m.CommitCount != 1 {
+		t.Errorf("Expected 1 commit, got %d", m.CommitCount)
+	}
+	if m.Refs[0].Base != header.Prerequisites[0] {
+		t.Errorf("Expected base %s, got %s", header.Prerequisites[0], m.Refs[0].Base)
+	}
+}
+
+func TestManifestWriteAndLoad(t *testing.T) {
+	repoDir := setupTestRepo(t)
+	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
+	repo := NewRepo(repoDir)
+
+	if err := repo.CreateFull(t.Context(), bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := repo.NewManifest(t.Context(), bundlePath, DirectionPush)
+	if err != nil {
+		t.Fatalf("NewManifest failed: %v", err)
+	}
+	m.Project = "test-project"
+	m.Encrypted = true
+
+	sum, _ := FileSHA256(bundlePath)
+	if m.SHA256 != sum {
+		t.Errorf("Expected sha256 %s, got %s", sum, m.SHA256)
+	}
+	if m.CommitCount != 1 {
+		t.Errorf("Expected 1 commit, got %d", m.CommitCount)
+	}
+
+	// The manifest of an encrypted bundle is named after the plaintext bundle
+	if _, err := m.Write(bundlePath + EncryptedExt); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	loaded, err := LoadManifest(bundlePath)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if loaded.Project != "test-project" || !loaded.Encrypted || loaded.Direction != DirectionPush {
+		t.Errorf("Unexpected manifest: %+v", loaded)
+	}
+}
+
+func TestManifestSetArtifactAndVerify(t *testing.T) {
+	repoDir := setupTestRepo(t)
+	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
+	repo := NewRepo(repoDir)
+
+	if err := repo.CreateFull(t.Context(), bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	m, err := repo.NewManifest(t.Context(), bundlePath, DirectionPush)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainSum := m.SHA256
+
+	// An encrypted artifact keeps the plaintext hash next to its own
+	_, id := writeAgeIdentity(t)
+	encPath, err := Encrypt(bundlePath, []string{id.Recipient().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetArtifact(encPath); err != nil {
+		t.Fatalf("SetArtifact failed: %v", err)
+	}
+	if sum, _ := FileSHA256(encPath); m.SHA256 != sum || m.PlainSHA256 != plainSum {
+		t.Errorf("Expected sha256 %s and plain %s, got %s and %s", sum, plainSum, m.SHA256, m.PlainSHA256)
+	}
+	if err := m.Verify(encPath); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	if err := os.WriteFile(encPath, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(encPath); err == nil {
+		t.Error("Expected a modified artifact to fail verification")
+	}
+}
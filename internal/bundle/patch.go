@@ -0,0 +1,183 @@
+package bundle
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Transport formats for sending commits to the server.
+const (
+	// FormatBundle sends commits as a Git bundle, keeping their ids.
+	FormatBundle = "bundle"
+	// FormatPatch sends commits as a patch series applied with git am, which rewrites
+	// their committer and ids but can be reviewed as plain text on the way.
+	FormatPatch = "patch"
+)
+
+// PatchExt is the extension of a patch series. Patch series are kept, signed and pruned
+// like bundles.
+const PatchExt = ".patch"
+
+// PatchedPrefix is where the last commit sent as patches is recorded per branch. The
+// server has the changes up to it, though under different commit ids, so the next series
+// starts after it.
+const PatchedPrefix = "refs/gitsync/patched/"
+
+// Patch is one commit of a patch series.
+type Patch struct {
+	Commit  string `json:"commit"`
+	Subject string `json:"subject"`
+}
+
+var (
+	patchFrom   = regexp.MustCompile(`^From ([0-9a-f]{40,64}) Mon Sep 17 00:00:00 2001$`)
+	patchPrefix = regexp.MustCompile(`^\[PATCH[^\]]*\]\s*`)
+)
+
+// ValidateFormat checks that format names a transport format.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatBundle, FormatPatch:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected %s or %s", format, FormatBundle, FormatPatch)
+}
+
+// CreatePatches writes the commits of branch the server does not have yet to outputPath
+// as a patch series in mbox format, as git format-patch --stdout does, and returns them
+// oldest first. The server is known to have origin/<branch>, the branch as last pulled
+// into the RemotePrefix namespace of remote and the changes last sent as patches, so
+// the series starts after the newest of them. Merge commits cannot be expressed as
+// patches.
+func (r *Repo) CreatePatches(ctx context.Context, outputPath, branch, remote string) ([]Patch, error) {
+	tip := r.Tip(ctx, branch)
+	if tip == "" {
+		return nil, fmt.Errorf("branch %s not found", branch)
+	}
+
+	revs := []string{tip}
+	for _, ref := range []string{"refs/remotes/origin/" + branch, RemotePrefix(remote) + branch, PatchedPrefix + branch} {
+		if oid := r.Resolve(ctx, ref); oid != "" {
+			revs = append(revs, "^"+oid)
+		}
+	}
+	if len(revs) == 1 {
+		return nil, fmt.Errorf("no commit of %s is known to be on the server, push a bundle first", branch)
+	}
+	if merges := r.lines(ctx, append([]string{"rev-list", "--merges"}, revs...)...); len(merges) > 0 {
+		return nil, fmt.Errorf("%d merge commit(s) cannot be sent as patches, push a bundle instead", len(merges))
+	}
+	if len(r.lines(ctx, append([]string{"rev-list"}, revs...)...)) == 0 {
+		return nil, fmt.Errorf("no new commits found to send")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch series: %w", err)
+	}
+	defer f.Close()
+
+	var stderr strings.Builder
+	cmd := r.command(ctx, append([]string{"format-patch", "--stdout", "--binary", "--no-signature"}, revs...)...)
+	cmd.Stdout = f
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return nil, fmt.Errorf("git format-patch failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return ReadPatches(outputPath)
+}
+
+// ReadPatches lists the commits of the patch series at path in order.
+func ReadPatches(path string) ([]Patch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open patch series: %w", err)
+	}
+	defer f.Close()
+
+	var patches []Patch
+	inHeader, inSubject := false, false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := patchFrom.FindStringSubmatch(line); m != nil {
+			patches = append(patches, Patch{Commit: m[1]})
+			inHeader, inSubject = true, false
+			continue
+		}
+		if !inHeader {
+			continue
+		}
+
+		p := &patches[len(patches)-1]
+		switch {
+		case line == "":
+			inHeader = false
+		case inSubject && (line[0] == ' ' || line[0] == '\t'):
+			// Long subjects are folded onto indented lines
+			p.Subject += " " + strings.TrimSpace(line)
+		case strings.HasPrefix(line, "Subject: "):
+			p.Subject = strings.TrimPrefix(line, "Subject: ")
+			inSubject = true
+		default:
+			inSubject = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read patch series: %w", err)
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("not a patch series: %s", path)
+	}
+
+	for i := range patches {
+		patches[i].Subject = patchPrefix.ReplaceAllString(patches[i].Subject, "")
+	}
+	return patches, nil
+}
+
+// MarkPatched records the last commit of branch sent as patches, so the next series
+// starts after it.
+func (r *Repo) MarkPatched(ctx context.Context, branch, tip string) error {
+	return r.run(ctx, "update-ref", PatchedPrefix+branch, tip)
+}
+
+// NewPatchManifest builds a manifest for the patch series at path, which carries the
+// patches of branch. The caller sets the descriptive fields, as for NewManifest.
+func (r *Repo) NewPatchManifest(ctx context.Context, path, direction, branch string, patches []Patch) (*Manifest, error) {
+	sum, size, err := hashVolume(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash patch series: %w", err)
+	}
+
+	ref := Ref{Name: "refs/heads/" + branch, Commits: len(patches)}
+	if len(patches) > 0 {
+		ref.Tip = patches[len(patches)-1].Commit
+		ref.Base = r.Resolve(ctx, patches[0].Commit+"^")
+	}
+	return &Manifest{
+		Direction:   direction,
+		Format:      FormatPatch,
+		Refs:        []Ref{ref},
+		Patches:     patches,
+		CommitCount: len(patches),
+		Creator:     r.creator(ctx),
+		CreatedAt:   time.Now(),
+		Size:        size,
+		SHA256:      sum,
+	}, nil
+}
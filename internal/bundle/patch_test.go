@@ -0,0 +1,63 @@
+package bundle
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreatePatches(t *testing.T) {
+	dir := setupTestRepo(t)
+	branch := git(t, dir, "symbolic-ref", "--short", "HEAD")
+	repo := NewRepo(dir)
+	ctx := t.Context()
+	patchPath := filepath.Join(t.TempDir(), "push"+PatchExt)
+
+	if _, err := repo.CreatePatches(ctx, patchPath, branch, DefaultRemote); err == nil {
+		t.Error("Expected CreatePatches to fail without a commit known to be on the server")
+	}
+
+	git(t, dir, "update-ref", "refs/remotes/origin/"+branch, "HEAD")
+	if _, err := repo.CreatePatches(ctx, patchPath, branch, DefaultRemote); err == nil {
+		t.Error("Expected CreatePatches to fail without new commits")
+	}
+
+	commitFile(t, dir, "a.txt", "a")
+	long := "Subject long enough to be folded by git format-patch " + strings.Repeat("word ", 12)
+	commitFile(t, dir, "long.txt", "long")
+	git(t, dir, "commit", "--amend", "-q", "-m", strings.TrimSpace(long))
+	patches, err := repo.CreatePatches(ctx, patchPath, branch, DefaultRemote)
+	if err != nil {
+		t.Fatalf("CreatePatches failed: %v", err)
+	}
+	want := []Patch{
+		{Commit: git(t, dir, "rev-parse", "HEAD^"), Subject: "update a.txt"},
+		{Commit: git(t, dir, "rev-parse", "HEAD"), Subject: strings.TrimSpace(long)},
+	}
+	if len(patches) != len(want) {
+		t.Fatalf("Expected %d patches, got %+v", len(want), patches)
+	}
+	for i := range want {
+		if patches[i] != want[i] {
+			t.Errorf("Patch %d is %+v, expected %+v", i+1, patches[i], want[i])
+		}
+	}
+
+	// The next series starts after the commits already sent as patches
+	if err := repo.MarkPatched(ctx, branch, want[1].Commit); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "b.txt", "b")
+	if patches, err = repo.CreatePatches(ctx, patchPath, branch, DefaultRemote); err != nil || len(patches) != 1 || patches[0].Subject != "update b.txt" {
+		t.Errorf("Expected only the new commit, got %+v, %v", patches, err)
+	}
+
+	// Merge commits cannot be sent as patches
+	git(t, dir, "checkout", "-q", "-b", "side", "HEAD^")
+	commitFile(t, dir, "side.txt", "side")
+	git(t, dir, "checkout", "-q", branch)
+	git(t, dir, "merge", "-q", "--no-edit", "side")
+	if _, err := repo.CreatePatches(ctx, patchPath, branch, DefaultRemote); err == nil || !strings.Contains(err.Error(), "merge") {
+		t.Errorf("Expected CreatePatches to refuse merge commits, got %v", err)
+	}
+}
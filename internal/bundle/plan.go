@@ -0,0 +1,116 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Commits returns the one-line summaries of the commits reachable from tips but not from
+// exclude, newest first and at most limit of them, and how many there are in total.
+// Excluded commits that are not in the repository are ignored.
+func (r *Repo) Commits(ctx context.Context, tips, exclude []string, limit int) ([]string, int) {
+	revs := r.revisions(ctx, tips, exclude)
+	count := r.countCommits(ctx, tips, exclude)
+	if count == 0 {
+		return nil, 0
+	}
+	args := append([]string{"log", "--oneline", "--no-decorate", fmt.Sprintf("--max-count=%d", limit)}, revs...)
+	return r.lines(ctx, args...), count
+}
+
+// EstimateSize estimates the size of a bundle of tips that leaves out exclude from the
+// size of the objects in the repository's packs. Bundles are compressed like packs, so
+// the estimate is close, though deltas against left out objects can make bundles larger.
+func (r *Repo) EstimateSize(ctx context.Context, tips, exclude []string) (int64, error) {
+	list := r.command(ctx, append([]string{"rev-list", "--objects"}, r.revisions(ctx, tips, exclude)...)...)
+	objects, err := list.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	var oids strings.Builder
+	for _, line := range strings.Split(string(objects), "\n") {
+		if oid, _, _ := strings.Cut(line, " "); oid != "" {
+			oids.WriteString(oid + "\n")
+		}
+	}
+	check := r.command(ctx, "cat-file", "--batch-check=%(objectsize:disk)")
+	check.Stdin = strings.NewReader(oids.String())
+	sizes, err := check.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read object sizes: %w", err)
+	}
+
+	var total int64
+	for _, line := range strings.Fields(string(sizes)) {
+		n, _ := strconv.ParseInt(line, 10, 64)
+		total += n
+	}
+	return total, nil
+}
+
+// MergeConflicts returns the files that merging theirs into ours would conflict in,
+// worked out with git merge-tree without touching the index, the working tree or the
+// object database: the trees it writes go to a temporary object directory. Both commits
+// must be in the repository.
+func (r *Repo) MergeConflicts(ctx context.Context, ours, theirs string) ([]string, error) {
+	for _, oid := range []string{ours, theirs} {
+		if oid == "" || !r.hasCommit(ctx, oid) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCommit, oid)
+		}
+	}
+
+	objects, err := r.gitPath(ctx, "objects")
+	if err != nil {
+		return nil, err
+	}
+	if objects, err = filepath.Abs(objects); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp("", "gitsync-merge-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	scratch := &Repo{Dir: r.Dir, Git: r.Git, Env: append(append([]string{}, r.Env...),
+		"GIT_OBJECT_DIRECTORY="+tmpDir, "GIT_ALTERNATE_OBJECT_DIRECTORIES="+objects)}
+
+	var stderr strings.Builder
+	cmd := scratch.command(ctx, "merge-tree", "--write-tree", "--name-only", "--no-messages", ours, theirs)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return nil, nil
+	case !errors.As(err, &exit) || exit.ExitCode() != 1:
+		return nil, fmt.Errorf("git merge-tree failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// Exit status 1 means conflicts: the tree comes first, then the conflicted files
+	var conflicts []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n")[1:] {
+		if line = strings.TrimSpace(line); line != "" {
+			conflicts = append(conflicts, line)
+		}
+	}
+	return conflicts, nil
+}
+
+// revisions renders tips and the excluded commits that are in the repository as
+// arguments for git rev-list.
+func (r *Repo) revisions(ctx context.Context, tips, exclude []string) []string {
+	revs := append([]string{}, tips...)
+	for _, oid := range exclude {
+		if oid != "" && r.hasCommit(ctx, oid) {
+			revs = append(revs, "^"+oid)
+		}
+	}
+	return revs
+}
@@ -0,0 +1,64 @@
+package bundle
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPlanHelpers(t *testing.T) {
+	dir := setupTestRepo(t)
+	repo := NewRepo(dir)
+	ctx := t.Context()
+	base := git(t, dir, "rev-parse", "HEAD")
+	branch := git(t, dir, "symbolic-ref", "--short", "HEAD")
+
+	commitFile(t, dir, "a.txt", "a")
+	commitFile(t, dir, "b.txt", "b")
+	commitFile(t, dir, "file.txt", "ours")
+	ours := git(t, dir, "rev-parse", "HEAD")
+
+	commits, count := repo.Commits(ctx, []string{ours}, []string{base, "missing-ref"}, 2)
+	if count != 3 || len(commits) != 2 {
+		t.Fatalf("Expected 2 of 3 commits, got %d: %v", count, commits)
+	}
+	if want := git(t, dir, "log", "--oneline", "--no-decorate", "-1"); commits[0] != want {
+		t.Errorf("Expected the newest commit first, got %q", commits[0])
+	}
+
+	full, err := repo.EstimateSize(ctx, []string{ours}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	incremental, err := repo.EstimateSize(ctx, []string{ours}, []string{base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incremental <= 0 || incremental >= full {
+		t.Errorf("Expected 0 < incremental (%d) < full (%d)", incremental, full)
+	}
+
+	git(t, dir, "checkout", "-q", "-b", "theirs", base)
+	commitFile(t, dir, "c.txt", "c")
+	clean := git(t, dir, "rev-parse", "HEAD")
+	commitFile(t, dir, "file.txt", "theirs")
+	conflicting := git(t, dir, "rev-parse", "HEAD")
+	git(t, dir, "checkout", "-q", branch)
+	objects := git(t, dir, "count-objects")
+
+	if conflicts, err := repo.MergeConflicts(ctx, ours, clean); err != nil || conflicts != nil {
+		t.Errorf("Expected a clean merge, got %v, %v", conflicts, err)
+	}
+	if conflicts, err := repo.MergeConflicts(ctx, ours, conflicting); err != nil || !reflect.DeepEqual(conflicts, []string{"file.txt"}) {
+		t.Errorf("Expected file.txt to conflict, got %v, %v", conflicts, err)
+	}
+	if _, err := repo.MergeConflicts(ctx, ours, "0123456789012345678901234567890123456789"); !errors.Is(err, ErrUnknownCommit) {
+		t.Errorf("Expected ErrUnknownCommit, got %v", err)
+	}
+	if status := git(t, dir, "status", "--porcelain"); status != "" {
+		t.Errorf("MergeConflicts changed the working tree: %s", status)
+	}
+	if got := git(t, dir, "count-objects"); got != objects {
+		t.Errorf("MergeConflicts wrote objects: %s, was %s", got, objects)
+	}
+}
@@ -0,0 +1,119 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Repo is a Git repository that bundle operations run against. Git is invoked with the
+// repository as its working directory, so several repositories can be handled
+// concurrently without changing the process working directory. Relative file paths
+// passed to Repo methods are relative to the process working directory, as usual.
+type Repo struct {
+	// Dir is the working tree of the repository. Empty means the process working directory.
+	Dir string
+	// Git is the git binary to run, "git" if empty.
+	Git string
+	// Env holds extra environment variables (KEY=value) for every git command.
+	Env []string
+}
+
+// NewRepo returns a handle on the repository whose working tree is dir.
+func NewRepo(dir string) *Repo {
+	return &Repo{Dir: dir}
+}
+
+// Sub returns a handle on the repository at dir relative to r, e.g. a submodule,
+// sharing r's git binary and environment.
+func (r *Repo) Sub(dir string) *Repo {
+	return &Repo{Dir: r.path(dir), Git: r.Git, Env: r.Env}
+}
+
+// command prepares a git command in the repository. It is killed when ctx is done.
+func (r *Repo) command(ctx context.Context, args ...string) *exec.Cmd {
+	bin := r.Git
+	if bin == "" {
+		bin = "git"
+	}
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Dir = r.Dir
+	if len(r.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.Env...)
+	}
+	return cmd
+}
+
+// run runs a git command and returns its combined output in the error on failure.
+func (r *Repo) run(ctx context.Context, args ...string) error {
+	if output, err := r.command(ctx, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, string(output))
+	}
+	return nil
+}
+
+// succeeds reports whether a git command exits successfully.
+func (r *Repo) succeeds(ctx context.Context, args ...string) bool {
+	return r.command(ctx, args...).Run() == nil
+}
+
+// lines runs a git command and returns its non-empty output lines.
+func (r *Repo) lines(ctx context.Context, args ...string) []string {
+	output, err := r.command(ctx, args...).Output()
+	if err != nil {
+		return nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// output runs a git command and returns its trimmed output, with its stderr in the
+// error on failure.
+func (r *Repo) output(ctx context.Context, args ...string) (string, error) {
+	var stderr strings.Builder
+	cmd := r.command(ctx, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// gitPath returns the path of a file inside the Git directory.
+func (r *Repo) gitPath(ctx context.Context, name string) (string, error) {
+	path := r.lines(ctx, "rev-parse", "--git-path", name)
+	if len(path) != 1 {
+		return "", fmt.Errorf("not a git repository: %s", r.path("."))
+	}
+	return r.path(path[0]), nil
+}
+
+// path resolves a path printed by git, which is relative to the repository, against
+// the process working directory.
+func (r *Repo) path(p string) string {
+	if filepath.IsAbs(p) || r.Dir == "" {
+		return p
+	}
+	return filepath.Join(r.Dir, p)
+}
+
+// absPath makes a caller-supplied file path absolute so git resolves it the same way
+// from inside the repository.
+func absPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", p, err)
+	}
+	return abs, nil
+}
@@ -0,0 +1,80 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRepoConcurrentBundles(t *testing.T) {
+	bundleDir := t.TempDir()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		repoDir := setupTestRepo(t)
+		commitFile(t, repoDir, "repo.txt", fmt.Sprintf("repo %d", i))
+
+		wg.Add(1)
+		go func(i int, repo *Repo) {
+			defer wg.Done()
+			errs[i] = repo.CreateFull(t.Context(), filepath.Join(bundleDir, fmt.Sprintf("%d.bundle", i)))
+		}(i, NewRepo(repoDir))
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("CreateFull %d failed: %v", i, err)
+		}
+		cloneDir := filepath.Join(t.TempDir(), "clone")
+		git(t, bundleDir, "clone", "-q", filepath.Join(bundleDir, fmt.Sprintf("%d.bundle", i)), cloneDir)
+		if data, _ := os.ReadFile(filepath.Join(cloneDir, "repo.txt")); string(data) != fmt.Sprintf("repo %d", i) {
+			t.Errorf("Bundle %d has the wrong contents: %q", i, data)
+		}
+	}
+}
+
+func TestRepoCancelled(t *testing.T) {
+	repo := NewRepo(setupTestRepo(t))
+	bundlePath := filepath.Join(t.TempDir(), "cancelled.bundle")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := repo.CreateFull(ctx, bundlePath); err == nil {
+		t.Fatal("Expected CreateFull to fail with a cancelled context")
+	}
+	if _, err := os.Stat(bundlePath); err == nil {
+		t.Error("Bundle created despite the cancelled context")
+	}
+}
+
+func TestRepoEnv(t *testing.T) {
+	repoDir := setupTestRepo(t)
+	bundlePath := filepath.Join(t.TempDir(), "env.bundle")
+
+	repo := &Repo{Dir: repoDir, Env: []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=user.name",
+		"GIT_CONFIG_VALUE_0=Env User",
+	}}
+	if err := repo.CreateFull(t.Context(), bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := repo.NewManifest(t.Context(), bundlePath, DirectionPush)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Creator != "Env User <test@example.com>" {
+		t.Errorf("Expected the creator from Env, got %q", m.Creator)
+	}
+
+	missing := &Repo{Dir: repoDir, Git: filepath.Join(t.TempDir(), "no-such-git")}
+	if err := missing.CreateFull(t.Context(), bundlePath); err == nil {
+		t.Error("Expected an error for a missing git binary")
+	}
+}
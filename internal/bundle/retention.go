@@ -0,0 +1,157 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Artifact is a bundle together with its sidecars: signature, manifest, volumes,
+// submodule bundles and LFS archive. Artifacts are always kept or pruned as a whole.
+type Artifact struct {
+	// Name is the plaintext bundle name shared by every file of the artifact.
+	Name    string
+	Files   []string
+	Size    int64
+	ModTime time.Time
+}
+
+// ArtifactName returns the name of the bundle or patch series a file belongs to, e.g.
+// p.bundle for p.bundle.age.sig, or "" if the file is not part of an artifact.
+func ArtifactName(file string) string {
+	name := ""
+	for _, ext := range []string{".bundle", PatchExt} {
+		idx := strings.LastIndex(file, ext)
+		if idx <= 0 {
+			continue
+		}
+		end := idx + len(ext)
+		if end < len(file) && file[end] != '.' {
+			continue
+		}
+		if end > len(name) {
+			name = file[:end]
+		}
+	}
+	return name
+}
+
+// ProjectArtifacts returns the artifacts named like the bundles and patch series sync
+// creates for project: the project name, "server-" for pulls, "backup-" for backups or
+// "fetch-" and "push-" for the remote helper, then the timestamp. Artifacts of other
+// projects sharing a directory are left out, even when their name starts with this
+// one's, like app-web for app.
+func ProjectArtifacts(artifacts []Artifact, project string) []Artifact {
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(project) + `-(server-|backup-|fetch-|push-)?[0-9]{8}-[0-9]{6}(\.bundle|` + regexp.QuoteMeta(PatchExt) + `)$`)
+	var matched []Artifact
+	for _, a := range artifacts {
+		if pattern.MatchString(a.Name) {
+			matched = append(matched, a)
+		}
+	}
+	return matched
+}
+
+// GroupArtifacts groups the regular files of a directory listing into artifacts, newest
+// first. An artifact is as old as its most recently modified file.
+func GroupArtifacts(files []os.FileInfo) []Artifact {
+	byName := make(map[string]*Artifact)
+	for _, f := range files {
+		name := ArtifactName(f.Name())
+		if name == "" || !f.Mode().IsRegular() {
+			continue
+		}
+
+		a, ok := byName[name]
+		if !ok {
+			a = &Artifact{Name: name}
+			byName[name] = a
+		}
+		a.Files = append(a.Files, f.Name())
+		a.Size += f.Size()
+		if f.ModTime().After(a.ModTime) {
+			a.ModTime = f.ModTime()
+		}
+	}
+
+	artifacts := make([]Artifact, 0, len(byName))
+	for _, a := range byName {
+		sort.Strings(a.Files)
+		artifacts = append(artifacts, *a)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		if !artifacts[i].ModTime.Equal(artifacts[j].ModTime) {
+			return artifacts[i].ModTime.After(artifacts[j].ModTime)
+		}
+		return artifacts[i].Name > artifacts[j].Name
+	})
+	return artifacts
+}
+
+// LocalArtifacts returns the artifacts in a local directory, newest first. A missing
+// directory has no artifacts.
+func LocalArtifacts(dir string) ([]Artifact, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []os.FileInfo
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	return GroupArtifacts(files), nil
+}
+
+// RemoveArtifact deletes every file of an artifact from dir.
+func RemoveArtifact(dir string, a Artifact) error {
+	for _, f := range a.Files {
+		if err := os.Remove(filepath.Join(dir, f)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retention limits how many artifacts are kept. Zero values disable a limit.
+type Retention struct {
+	// MaxCount is the number of artifacts to keep.
+	MaxCount int
+	// MaxAge prunes artifacts older than this.
+	MaxAge time.Duration
+	// MaxSize bounds the total size of the kept artifacts.
+	MaxSize int64
+}
+
+// Expired returns the artifacts, sorted newest first as by GroupArtifacts, that fall
+// outside the retention limits at now. Once one artifact is pruned, every older one is
+// pruned too. The newest artifact is always kept so the most recent sync can still be
+// inspected.
+func (r Retention) Expired(artifacts []Artifact, now time.Time) []Artifact {
+	var total int64
+	for i, a := range artifacts {
+		if i > 0 && r.exceeded(a, i, total, now) {
+			return artifacts[i:]
+		}
+		total += a.Size
+	}
+	return nil
+}
+
+func (r Retention) exceeded(a Artifact, kept int, total int64, now time.Time) bool {
+	if r.MaxCount > 0 && kept >= r.MaxCount {
+		return true
+	}
+	if r.MaxAge > 0 && now.Sub(a.ModTime) > r.MaxAge {
+		return true
+	}
+	return r.MaxSize > 0 && total+a.Size > r.MaxSize
+}
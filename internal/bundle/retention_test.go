@@ -0,0 +1,153 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArtifactName(t *testing.T) {
+	tests := map[string]string{
+		"p-20240101-120000.bundle":                 "p-20240101-120000.bundle",
+		"p-20240101-120000.bundle.age.sig":         "p-20240101-120000.bundle",
+		"p-20240101-120000.bundle.manifest.json":   "p-20240101-120000.bundle",
+		"p-20240101-120000.bundle.002":             "p-20240101-120000.bundle",
+		"p-20240101-120000.bundle.sub001.age":      "p-20240101-120000.bundle",
+		"p-20240101-120000.bundle.lfs.tar.age.sig": "p-20240101-120000.bundle",
+		"p-20240101-120000.patch":                  "p-20240101-120000.patch",
+		"p-20240101-120000.patch.sig":              "p-20240101-120000.patch",
+		"p-20240101-120000.bundles":                "",
+		"notes.txt":                                "",
+		".bundle":                                  "",
+	}
+	for file, want := range tests {
+		if got := ArtifactName(file); got != want {
+			t.Errorf("ArtifactName(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestProjectArtifacts(t *testing.T) {
+	var artifacts []Artifact
+	for _, name := range []string{
+		"app-20240101-120000.bundle",
+		"app-server-20240101-120000.bundle",
+		"app-backup-20240101-120000.bundle",
+		"app-20240101-120000.patch",
+		"app-web-20240101-120000.bundle",
+		"app-web-server-20240101-120000.bundle",
+		"app-notes.bundle",
+		"myapp-20240101-120000.bundle",
+	} {
+		artifacts = append(artifacts, Artifact{Name: name})
+	}
+
+	var got []string
+	for _, a := range ProjectArtifacts(artifacts, "app") {
+		got = append(got, a.Name)
+	}
+	want := []string{
+		"app-20240101-120000.bundle",
+		"app-server-20240101-120000.bundle",
+		"app-backup-20240101-120000.bundle",
+		"app-20240101-120000.patch",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProjectArtifacts(app) = %v, want %v", got, want)
+	}
+
+	if got := ProjectArtifacts(artifacts, "app-web"); len(got) != 2 {
+		t.Errorf("Expected the 2 app-web artifacts, got %+v", got)
+	}
+}
+
+func TestLocalArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	write("old.bundle", 100, 48*time.Hour)
+	write("old.bundle.sig", 10, 48*time.Hour)
+	write("new.bundle.age", 200, time.Hour)
+	write("new.bundle.manifest.json", 5, 30*time.Minute)
+	write("README", 1, 0)
+	os.Mkdir(filepath.Join(dir, "dir.bundle"), 0755)
+
+	artifacts, err := LocalArtifacts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("Expected 2 artifacts, got %+v", artifacts)
+	}
+
+	newest := artifacts[0]
+	if newest.Name != "new.bundle" || newest.Size != 205 ||
+		!reflect.DeepEqual(newest.Files, []string{"new.bundle.age", "new.bundle.manifest.json"}) {
+		t.Errorf("Unexpected newest artifact %+v", newest)
+	}
+	if !newest.ModTime.Equal(now.Add(-30 * time.Minute)) {
+		t.Errorf("Expected artifact to be as old as its newest file, got %v", newest.ModTime)
+	}
+
+	if err := RemoveArtifact(dir, artifacts[1]); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old.bundle", "old.bundle.sig"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Expected %s to be removed with its artifact", name)
+		}
+	}
+
+	if artifacts, err := LocalArtifacts(filepath.Join(dir, "missing")); err != nil || artifacts != nil {
+		t.Errorf("Expected no artifacts for a missing directory, got %v (%v)", artifacts, err)
+	}
+}
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	artifacts := []Artifact{
+		{Name: "a.bundle", Size: 500, ModTime: now.Add(-time.Hour)},
+		{Name: "b.bundle", Size: 300, ModTime: now.Add(-2 * day)},
+		{Name: "c.bundle", Size: 100, ModTime: now.Add(-10 * day)},
+		{Name: "d.bundle", Size: 100, ModTime: now.Add(-40 * day)},
+	}
+
+	names := func(as []Artifact) []string {
+		var out []string
+		for _, a := range as {
+			out = append(out, a.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		want      []string
+	}{
+		{"no limits", Retention{}, nil},
+		{"count", Retention{MaxCount: 2}, []string{"c.bundle", "d.bundle"}},
+		{"age", Retention{MaxAge: 7 * day}, []string{"c.bundle", "d.bundle"}},
+		{"size", Retention{MaxSize: 850}, []string{"c.bundle", "d.bundle"}},
+		{"newest is kept", Retention{MaxSize: 10, MaxAge: time.Minute}, []string{"b.bundle", "c.bundle", "d.bundle"}},
+		{"strictest wins", Retention{MaxCount: 3, MaxAge: 30 * day, MaxSize: 1000}, []string{"d.bundle"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(tt.retention.Expired(artifacts, now)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ShallowExt is appended to a bundle name to form the name of the file listing its
+// shallow boundary, see CreateShallow.
+const ShallowExt = ".shallow"
+
+// shallowStateFile is the file in the Git directory that records the shallow boundary
+// of the server repository, see SaveShallow.
+const shallowStateFile = "gitsync-shallow"
+
+// ShallowOptions limits a bundle to recent history. Depth and Since are mutually
+// exclusive, as they are for git clone.
+type ShallowOptions struct {
+	// Depth is the number of commits to keep on each branch.
+	Depth int
+	// Since is a date understood by git, e.g. "2024-01-01" or "6 months ago".
+	Since string
+}
+
+// Enabled reports whether history should be truncated.
+func (o ShallowOptions) Enabled() bool {
+	return o.Depth > 0 || o.Since != ""
+}
+
+// CreateShallow creates a bundle of the recent history of every branch, as selected by
+// opts. The bundle has no prerequisites: its oldest commits simply lack their parents,
+// exactly like the pack of a shallow clone. Those commits form the shallow boundary,
+// which is returned and written next to the bundle (see ShallowExt); the receiving side
+// must record them in .git/shallow before fetching from the bundle.
+func (r *Repo) CreateShallow(ctx context.Context, outputPath string, opts ShallowOptions) ([]string, error) {
+	if !opts.Enabled() {
+		return nil, fmt.Errorf("shallow bundle needs a depth or a date")
+	}
+	if opts.Depth > 0 && opts.Since != "" {
+		return nil, fmt.Errorf("depth and since cannot be used together")
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	absOutput, err := absPath(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	source, err := absPath(r.path("."))
+	if err != nil {
+		return nil, err
+	}
+
+	// Let git pick the boundary, as it does for clone --depth, by cloning the recent
+	// history into a scratch repository and bundling that
+	tmp, err := os.MkdirTemp("", "gitsync-shallow-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	args := []string{"clone", "-q", "--bare", "--no-single-branch"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	} else {
+		args = append(args, "--shallow-since", opts.Since)
+	}
+	args = append(args, "file://"+filepath.ToSlash(source), tmp)
+	if err := r.run(ctx, args...); err != nil {
+		return nil, err
+	}
+
+	scratch := &Repo{Dir: tmp, Git: r.Git, Env: r.Env}
+	if output, err := scratch.command(ctx, "bundle", "create", absOutput, "--all").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git bundle create failed: %v: %s", err, string(output))
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmp, "shallow"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// Without a shallow file the limits covered the whole history
+	boundary := strings.Fields(string(data))
+	if err := os.WriteFile(outputPath+ShallowExt, data, 0644); err != nil {
+		os.Remove(outputPath)
+		return nil, fmt.Errorf("failed to write shallow boundary: %w", err)
+	}
+	return boundary, nil
+}
+
+// ReadShallow returns the shallow boundary written next to a bundle by CreateShallow, or
+// nil for a complete bundle. Encrypted bundles share the file of their plaintext name.
+func ReadShallow(bundlePath string) ([]string, error) {
+	data, err := os.ReadFile(strings.TrimSuffix(bundlePath, EncryptedExt) + ShallowExt)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// SaveShallow records the shallow boundary of the server repository after a shallow
+// push, so later incremental bundles only require commits the server has. An empty
+// boundary clears the record, e.g. once the server holds the complete history.
+func (r *Repo) SaveShallow(ctx context.Context, boundary []string) error {
+	path, err := r.gitPath(ctx, shallowStateFile)
+	if err != nil {
+		return err
+	}
+	if len(boundary) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(strings.Join(boundary, "\n")+"\n"), 0644)
+}
+
+// ShallowBoundary returns the shallow boundary recorded by SaveShallow, if any.
+func (r *Repo) ShallowBoundary(ctx context.Context) []string {
+	path, err := r.gitPath(ctx, shallowStateFile)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// shallowExclusions returns rev-list arguments that leave out the history behind a
+// shallow boundary, i.e. the parents of the boundary commits.
+func (r *Repo) shallowExclusions(ctx context.Context, boundary []string) []string {
+	var revs []string
+	for _, oid := range boundary {
+		for _, parent := range r.lines(ctx, "rev-parse", oid+"^@") {
+			revs = append(revs, "^"+parent)
+		}
+	}
+	return revs
+}
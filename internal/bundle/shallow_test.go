@@ -0,0 +1,116 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupHistoryRepo returns a repository with n commits on its branch.
+func setupHistoryRepo(t *testing.T, n int) (dir, branch string) {
+	dir = setupTestRepo(t)
+	for i := 2; i <= n; i++ {
+		commitFile(t, dir, "file.txt", string(rune('a'+i)))
+	}
+	return dir, git(t, dir, "symbolic-ref", "--short", "HEAD")
+}
+
+func TestCreateShallow(t *testing.T) {
+	srcDir, branch := setupHistoryRepo(t, 6)
+	repo := NewRepo(srcDir)
+	ctx := t.Context()
+	bundlePath := filepath.Join(t.TempDir(), "shallow.bundle")
+
+	boundary, err := repo.CreateShallow(ctx, bundlePath, ShallowOptions{Depth: 2})
+	if err != nil {
+		t.Fatalf("CreateShallow failed: %v", err)
+	}
+	if want := []string{git(t, srcDir, "rev-parse", "HEAD~1")}; !reflect.DeepEqual(boundary, want) {
+		t.Fatalf("Expected boundary %v, got %v", want, boundary)
+	}
+	if recorded, _ := ReadShallow(bundlePath + EncryptedExt); !reflect.DeepEqual(recorded, boundary) {
+		t.Errorf("Expected the boundary next to the bundle, got %v", recorded)
+	}
+
+	header, err := ReadHeader(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Prerequisites) != 0 {
+		t.Errorf("Expected no prerequisites, got %v", header.Prerequisites)
+	}
+
+	m, err := repo.NewManifest(ctx, bundlePath, DirectionPush)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.CommitCount != 2 || !reflect.DeepEqual(m.Shallow, boundary) {
+		t.Errorf("Expected 2 commits behind the boundary, got %d and %v", m.CommitCount, m.Shallow)
+	}
+
+	// A repository that records the boundary first can fetch the bundle
+	dstDir := t.TempDir()
+	git(t, dstDir, "init", "-q")
+	os.WriteFile(filepath.Join(dstDir, ".git", "shallow"), []byte(boundary[0]+"\n"), 0644)
+	git(t, dstDir, "fetch", "-q", bundlePath, "+refs/heads/*:refs/remotes/origin/*")
+	if count := git(t, dstDir, "rev-list", "--count", "refs/remotes/origin/"+branch); count != "2" {
+		t.Errorf("Expected 2 commits in the shallow repository, got %s", count)
+	}
+
+	if _, err := repo.CreateShallow(ctx, bundlePath, ShallowOptions{Depth: 1, Since: "2024-01-01"}); err == nil {
+		t.Error("Expected depth and since to be mutually exclusive")
+	}
+}
+
+func TestCreateShallowSince(t *testing.T) {
+	srcDir, _ := setupHistoryRepo(t, 3)
+	bundlePath := filepath.Join(t.TempDir(), "since.bundle")
+
+	// Everything is newer than the cut-off, so the whole history is bundled
+	boundary, err := NewRepo(srcDir).CreateShallow(t.Context(), bundlePath, ShallowOptions{Since: "2000-01-01"})
+	if err != nil {
+		t.Fatalf("CreateShallow failed: %v", err)
+	}
+	if len(boundary) != 0 {
+		t.Errorf("Expected no boundary, got %v", boundary)
+	}
+	if recorded, err := ReadShallow(bundlePath); err != nil || len(recorded) != 0 {
+		t.Errorf("Expected an empty boundary file, got %v (%v)", recorded, err)
+	}
+}
+
+func TestIncrementalAfterShallowPush(t *testing.T) {
+	srcDir, branch := setupHistoryRepo(t, 6)
+	repo := NewRepo(srcDir)
+	ctx := t.Context()
+
+	// origin is far behind the shallow boundary
+	git(t, srcDir, "update-ref", "refs/remotes/origin/"+branch, "HEAD~4")
+	boundary := []string{git(t, srcDir, "rev-parse", "HEAD~1")}
+	if err := repo.SaveShallow(ctx, boundary); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.ShallowBoundary(ctx); !reflect.DeepEqual(got, boundary) {
+		t.Fatalf("Expected recorded boundary %v, got %v", boundary, got)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "incr.bundle")
+	if err := repo.CreateIncremental(ctx, bundlePath, branch); err != nil {
+		t.Fatalf("CreateIncremental failed: %v", err)
+	}
+	header, err := ReadHeader(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(header.Prerequisites, boundary) {
+		t.Errorf("Expected the bundle to require only %v, got %v", boundary, header.Prerequisites)
+	}
+
+	if err := repo.SaveShallow(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.ShallowBoundary(ctx); got != nil {
+		t.Errorf("Expected the boundary to be cleared, got %v", got)
+	}
+}
@@ -0,0 +1,339 @@
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/princetheprogrammerbtw/gitsynq/pkg/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureExt is appended to a bundle name to form the name of its detached signature.
+const SignatureExt = ".sig"
+
+// SignatureNamespace is the ssh-keygen -Y namespace used for bundle signatures.
+const SignatureNamespace = "gitsynq"
+
+const (
+	sigMagic    = "SSHSIG"
+	sigVersion  = 1
+	sigHashAlg  = "sha512"
+	sigPEMType  = "SSH SIGNATURE"
+	sigArmorLen = 70
+)
+
+var (
+	// ErrUnsigned is returned when a bundle has no detached signature.
+	ErrUnsigned = errors.New("bundle is not signed")
+	// ErrUntrustedSigner is returned when a signature is valid but its key is not in the allowed signers list.
+	ErrUntrustedSigner = errors.New("bundle signer is not in the allowed signers list")
+)
+
+// sshSignature is the wire format of an SSHSIG blob as produced by ssh-keygen -Y sign.
+type sshSignature struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// signedData is the structure that is actually signed for an SSHSIG signature.
+type signedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// Sign creates a detached signature for the file at path using the SSH private key at
+// keyPath. The signature is written next to the file with the SignatureExt suffix in the
+// format used by ssh-keygen -Y sign, so it can be verified with ssh-keygen -Y verify.
+func Sign(path, keyPath string) (string, error) {
+	keyData, err := os.ReadFile(utils.ExpandHome(keyPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to read signing key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	digest, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	data := ssh.Marshal(signedData{
+		Magic:         magicBytes(),
+		Namespace:     SignatureNamespace,
+		HashAlgorithm: sigHashAlg,
+		Hash:          digest,
+	})
+
+	var sig *ssh.Signature
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// ssh-keygen refuses SHA-1 RSA signatures
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to sign bundle: %w", err)
+	}
+
+	blob := ssh.Marshal(sshSignature{
+		Magic:         magicBytes(),
+		Version:       sigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     SignatureNamespace,
+		HashAlgorithm: sigHashAlg,
+		Signature:     ssh.Marshal(sig),
+	})
+
+	sigPath := path + SignatureExt
+	if err := os.WriteFile(sigPath, armorSignature(blob), 0644); err != nil {
+		return "", fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	return sigPath, nil
+}
+
+// Verify checks the detached signature of the file at path against an ssh-keygen
+// allowed signers file and returns the principal that signed it. It returns an error
+// wrapping ErrUnsigned when no signature exists and ErrUntrustedSigner when the
+// signing key is not allowed.
+func Verify(path, allowedSignersPath string) (string, error) {
+	armored, err := os.ReadFile(path + SignatureExt)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: %s", ErrUnsigned, filepath.Base(path))
+		}
+		return "", fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != sigPEMType {
+		return "", fmt.Errorf("malformed signature for %s", filepath.Base(path))
+	}
+
+	var sig sshSignature
+	if err := ssh.Unmarshal(block.Bytes, &sig); err != nil {
+		return "", fmt.Errorf("malformed signature for %s: %w", filepath.Base(path), err)
+	}
+	if sig.Magic != magicBytes() || sig.Version != sigVersion {
+		return "", fmt.Errorf("unsupported signature format for %s", filepath.Base(path))
+	}
+	if sig.Namespace != SignatureNamespace {
+		return "", fmt.Errorf("signature namespace %q does not match %q", sig.Namespace, SignatureNamespace)
+	}
+
+	pub, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid signing key in signature: %w", err)
+	}
+
+	var inner ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &inner); err != nil {
+		return "", fmt.Errorf("malformed signature for %s: %w", filepath.Base(path), err)
+	}
+	if inner.Format == ssh.KeyAlgoRSA {
+		// Like ssh-keygen, refuse RSA signatures made with SHA-1
+		return "", fmt.Errorf("refusing SHA-1 RSA signature for %s, sign with rsa-sha2-512", filepath.Base(path))
+	}
+
+	digest, err := hashFileWith(path, sig.HashAlgorithm)
+	if err != nil {
+		return "", err
+	}
+
+	data := ssh.Marshal(signedData{
+		Magic:         magicBytes(),
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          digest,
+	})
+	if err := pub.Verify(data, &inner); err != nil {
+		return "", fmt.Errorf("bad signature for %s: %w", filepath.Base(path), err)
+	}
+
+	return findPrincipal(allowedSignersPath, pub)
+}
+
+// findPrincipal looks up the principal allowed to sign with pub in an ssh-keygen
+// allowed signers file ("principals [options] keytype key" per line). Of an entry's
+// comma-separated principals it returns the first that is not a negation. Entries for
+// other namespaces, outside their valid-after and valid-before window, or marked
+// cert-authority are skipped, the latter since bundles are never signed with
+// certificates.
+func findPrincipal(allowedSignersPath string, pub ssh.PublicKey) (string, error) {
+	f, err := os.Open(utils.ExpandHome(allowedSignersPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to open allowed signers file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(fields[1]))
+		if err != nil || !bytes.Equal(key.Marshal(), pub.Marshal()) {
+			continue
+		}
+		if !namespaceAllowed(options) || hasOption(options, "cert-authority") {
+			continue
+		}
+		if ok, err := validNow(options, time.Now()); err != nil {
+			return "", fmt.Errorf("invalid allowed signers entry for %s: %w", fields[0], err)
+		} else if !ok {
+			continue
+		}
+
+		for _, principal := range strings.Split(fields[0], ",") {
+			if principal != "" && !strings.HasPrefix(principal, "!") {
+				return principal, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read allowed signers file: %w", err)
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUntrustedSigner, ssh.FingerprintSHA256(pub))
+}
+
+// namespaceAllowed honours the namespaces="..." option of an allowed signers entry.
+func namespaceAllowed(options []string) bool {
+	for _, opt := range options {
+		name, value, ok := strings.Cut(opt, "=")
+		if !ok || !strings.EqualFold(name, "namespaces") {
+			continue
+		}
+		for _, ns := range strings.Split(strings.Trim(value, `"`), ",") {
+			if ok, _ := filepath.Match(strings.TrimSpace(ns), SignatureNamespace); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// hasOption reports whether an allowed signers entry has the flag option name.
+func hasOption(options []string, name string) bool {
+	for _, opt := range options {
+		if strings.EqualFold(opt, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validNow honours the valid-after="..." and valid-before="..." options of an allowed
+// signers entry at time now.
+func validNow(options []string, now time.Time) (bool, error) {
+	for _, opt := range options {
+		name, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(name)
+		if name != "valid-after" && name != "valid-before" {
+			continue
+		}
+		t, err := parseSignerTime(strings.Trim(value, `"`))
+		if err != nil {
+			return false, err
+		}
+		if name == "valid-after" && now.Before(t) || name == "valid-before" && !now.Before(t) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseSignerTime parses a time in the YYYYMMDD[HHMM[SS]][Z] format of ssh-keygen,
+// in local time unless it ends in Z.
+func parseSignerTime(value string) (time.Time, error) {
+	loc := time.Local
+	if v, ok := strings.CutSuffix(value, "Z"); ok {
+		value, loc = v, time.UTC
+	}
+	layouts := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(value)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+func armorSignature(blob []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var buf bytes.Buffer
+	buf.WriteString("-----BEGIN " + sigPEMType + "-----\n")
+	for len(encoded) > sigArmorLen {
+		buf.WriteString(encoded[:sigArmorLen] + "\n")
+		encoded = encoded[sigArmorLen:]
+	}
+	buf.WriteString(encoded + "\n")
+	buf.WriteString("-----END " + sigPEMType + "-----\n")
+	return buf.Bytes()
+}
+
+func hashFile(path string) ([]byte, error) {
+	return hashFileWith(path, sigHashAlg)
+}
+
+func hashFileWith(path, alg string) ([]byte, error) {
+	if alg != "sha512" && alg != "sha256" {
+		return nil, fmt.Errorf("unsupported signature hash algorithm %q", alg)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+
+	var h hash.Hash = sha512.New()
+	if alg == "sha256" {
+		h = sha256.New()
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to hash bundle: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+func magicBytes() [6]byte {
+	var m [6]byte
+	copy(m[:], sigMagic)
+	return m
+}
@@ -0,0 +1,203 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeSigningKey generates an ed25519 SSH key and an allowed signers file trusting it.
+func writeSigningKey(t *testing.T, principal string) (keyPath, allowedPath string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyPath = filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	allowedPath = filepath.Join(dir, "allowed_signers")
+	entry := principal + " " + string(ssh.MarshalAuthorizedKey(sshPub))
+	if err := os.WriteFile(allowedPath, []byte(entry), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath, allowedPath
+}
+
+func TestSignAndVerify(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
+	os.WriteFile(bundlePath, []byte("# v2 git bundle\n"), 0644)
+
+	keyPath, allowedPath := writeSigningKey(t, "dev@example.com")
+
+	if _, err := Sign(bundlePath, keyPath); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	principal, err := Verify(bundlePath, allowedPath)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if principal != "dev@example.com" {
+		t.Errorf("Expected principal dev@example.com, got %s", principal)
+	}
+
+	// Tampering with the bundle must invalidate the signature
+	os.WriteFile(bundlePath, []byte("# v2 git bundle\ntampered\n"), 0644)
+	if _, err := Verify(bundlePath, allowedPath); err == nil {
+		t.Error("Verify succeeded on a tampered bundle")
+	}
+}
+
+func TestVerifyUntrustedAndUnsigned(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
+	os.WriteFile(bundlePath, []byte("data"), 0644)
+
+	keyPath, _ := writeSigningKey(t, "alice")
+	_, otherAllowed := writeSigningKey(t, "bob")
+
+	if _, err := Verify(bundlePath, otherAllowed); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Expected ErrUnsigned, got %v", err)
+	}
+
+	if _, err := Sign(bundlePath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(bundlePath, otherAllowed); !errors.Is(err, ErrUntrustedSigner) {
+		t.Errorf("Expected ErrUntrustedSigner, got %v", err)
+	}
+}
+
+func TestSignatureCompatibleWithSSHKeygen(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
+	os.WriteFile(bundlePath, []byte("# v2 git bundle\n"), 0644)
+
+	keyPath, allowedPath := writeSigningKey(t, "dev@example.com")
+	sigPath, err := Sign(bundlePath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, _ := os.Open(bundlePath)
+	defer in.Close()
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", allowedPath,
+		"-I", "dev@example.com", "-n", SignatureNamespace, "-s", sigPath)
+	cmd.Stdin = in
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen rejected signature: %v: %s", err, output)
+	}
+
+	// And the other way round: a signature made by ssh-keygen verifies with Verify
+	os.Remove(sigPath)
+	if output, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", keyPath,
+		"-n", SignatureNamespace, bundlePath).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen sign failed: %v: %s", err, output)
+	}
+	principal, err := Verify(bundlePath, allowedPath)
+	if err != nil {
+		t.Fatalf("Verify rejected ssh-keygen signature: %v", err)
+	}
+	if !strings.Contains(principal, "dev@example.com") {
+		t.Errorf("Unexpected principal %s", principal)
+	}
+}
+
+func TestVerifyAllowedSignersOptions(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "test.bundle")
+	os.WriteFile(bundlePath, []byte("data"), 0644)
+	keyPath, allowedPath := writeSigningKey(t, "dev@example.com")
+	if _, err := Sign(bundlePath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := os.ReadFile(allowedPath)
+	key := strings.TrimPrefix(string(entry), "dev@example.com ")
+
+	tests := []struct {
+		name      string
+		entry     string
+		principal string
+	}{
+		{"principals one by one", "!eve,dev@example.com,ops " + key, "dev@example.com"},
+		{"valid after", `dev valid-after="20000101" ` + key, "dev"},
+		{"expired", `dev valid-before="20000101Z" ` + key, ""},
+		{"not yet valid", `dev valid-after="99991231235959" ` + key, ""},
+		{"certificate authority", "dev cert-authority " + key, ""},
+		{"other namespace", `dev namespaces="git" ` + key, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.WriteFile(allowedPath, []byte(tt.entry), 0644)
+			principal, err := Verify(bundlePath, allowedPath)
+			if tt.principal == "" {
+				if !errors.Is(err, ErrUntrustedSigner) {
+					t.Errorf("Expected ErrUntrustedSigner, got %q, %v", principal, err)
+				}
+				return
+			}
+			if err != nil || principal != tt.principal {
+				t.Errorf("Expected %s, got %q, %v", tt.principal, principal, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRefusesSHA1RSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "test.bundle")
+	os.WriteFile(bundlePath, []byte("data"), 0644)
+	allowedPath := filepath.Join(dir, "allowed_signers")
+	os.WriteFile(allowedPath, []byte("dev "+string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), 0644)
+
+	digest, _ := hashFile(bundlePath)
+	data := ssh.Marshal(signedData{Magic: magicBytes(), Namespace: SignatureNamespace, HashAlgorithm: sigHashAlg, Hash: digest})
+	sig, err := signer.(ssh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := ssh.Marshal(sshSignature{
+		Magic:         magicBytes(),
+		Version:       sigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     SignatureNamespace,
+		HashAlgorithm: sigHashAlg,
+		Signature:     ssh.Marshal(sig),
+	})
+	os.WriteFile(bundlePath+SignatureExt, armorSignature(blob), 0644)
+
+	if _, err := Verify(bundlePath, allowedPath); err == nil || !strings.Contains(err.Error(), "SHA-1") {
+		t.Errorf("Expected the SHA-1 signature to be refused, got %v", err)
+	}
+}
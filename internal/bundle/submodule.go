@@ -0,0 +1,237 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SubmoduleRefPrefix is the ref namespace a submodule bundle is fetched into inside an
+// existing submodule checkout.
+const SubmoduleRefPrefix = "refs/gitsync/"
+
+// Submodule describes the bundle of one submodule, shipped next to the main bundle.
+type Submodule struct {
+	// Parent is the path of the repository that contains the submodule, relative to
+	// the superproject, or empty for a direct submodule.
+	Parent string `json:"parent,omitempty"`
+	Name   string `json:"name"`
+	// Path is the submodule path inside Parent.
+	Path   string `json:"path"`
+	Bundle string `json:"bundle"`
+}
+
+// FullPath returns the submodule path relative to the superproject.
+func (s Submodule) FullPath() string {
+	return path.Join(s.Parent, s.Path)
+}
+
+// SubmoduleBundleName returns the name of the nth submodule bundle of a bundle, starting at 1.
+func SubmoduleBundleName(bundleName string, n int) string {
+	return fmt.Sprintf("%s.sub%03d", bundleName, n)
+}
+
+// CreateSubmoduleBundles bundles the checked-out submodules of the repository,
+// recursively, next to bundlePath. Parents are listed before their nested submodules.
+// Submodules that are not checked out are skipped since there is nothing to bundle.
+//
+// Only the submodule commits the bundled range of the superproject needs are bundled:
+// the gitlinks recorded by its new commits, leaving out the history of the gitlinks at
+// its prerequisites, which the other side already has. Submodules whose gitlink did not
+// change are skipped. Without prerequisites, or for a submodule that is new in the
+// range, the complete submodule history is bundled.
+func (r *Repo) CreateSubmoduleBundles(ctx context.Context, bundlePath string) ([]Submodule, error) {
+	absBundle, err := absPath(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	header, err := ReadHeader(absBundle)
+	if err != nil {
+		return nil, err
+	}
+	var tips []string
+	for _, ref := range header.Refs {
+		tips = append(tips, ref.Tip)
+	}
+
+	var subs []Submodule
+	// walk bundles the submodules of parent for the range tips ^bases of its commits;
+	// full bundles everything instead
+	var walk func(parent string, tips, bases []string, full bool) error
+	walk = func(parent string, tips, bases []string, full bool) error {
+		for _, sub := range r.listSubmodules(ctx, parent) {
+			dir := filepath.Join(parent, sub.Path)
+			if _, err := os.Stat(filepath.Join(r.path(dir), ".git")); err != nil {
+				continue
+			}
+			subRepo := r.Sub(dir)
+
+			var subTips, subBases []string
+			if !full {
+				subTips, subBases = r.Sub(parent).gitlinks(ctx, sub.Path, tips, bases)
+				subTips = subRepo.haveCommits(ctx, subTips)
+				if len(subTips) == 0 {
+					continue
+				}
+				subBases = subRepo.haveCommits(ctx, subBases)
+			}
+			subFull := full || len(subBases) == 0
+
+			sub.Parent = filepath.ToSlash(parent)
+			if sub.Parent == "." {
+				sub.Parent = ""
+			}
+			out := SubmoduleBundleName(absBundle, len(subs)+1)
+			sub.Bundle = filepath.Base(out)
+
+			if subFull {
+				cmd := subRepo.command(ctx, "bundle", "create", out, "--all")
+				if output, err := cmd.CombinedOutput(); err != nil {
+					return fmt.Errorf("failed to bundle submodule %s: %v: %s", sub.FullPath(), err, string(output))
+				}
+			} else {
+				// The newest gitlink doubles as HEAD, which the other side fetches
+				refs := map[string]string{"HEAD": subTips[0]}
+				for i, oid := range subTips {
+					refs[fmt.Sprintf("refs/gitlinks/%d", i+1)] = oid
+				}
+				if err := subRepo.CreateRefs(ctx, out, refs, subBases); err != nil {
+					return fmt.Errorf("failed to bundle submodule %s: %w", sub.FullPath(), err)
+				}
+			}
+			subs = append(subs, sub)
+
+			if err := walk(dir, subTips, subBases, subFull); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(".", tips, header.Prerequisites, len(header.Prerequisites) == 0); err != nil {
+		RemoveSubmoduleBundles(bundlePath, subs)
+		return nil, err
+	}
+	return subs, nil
+}
+
+// gitlinks returns the commits the submodule at path is recorded at by the commits in
+// tips ^bases, newest first, and the ones it is recorded at by bases.
+func (r *Repo) gitlinks(ctx context.Context, path string, tips, bases []string) (changed, known []string) {
+	args := append([]string{"rev-list"}, tips...)
+	for _, oid := range bases {
+		args = append(args, "^"+oid)
+	}
+	seen := make(map[string]bool)
+	for _, commit := range r.lines(ctx, append(args, "--", path)...) {
+		if oid := r.Resolve(ctx, commit+":"+path); oid != "" && !seen[oid] {
+			seen[oid] = true
+			changed = append(changed, oid)
+		}
+	}
+	seen = make(map[string]bool)
+	for _, base := range bases {
+		if oid := r.Resolve(ctx, base+":"+path); oid != "" && !seen[oid] {
+			seen[oid] = true
+			known = append(known, oid)
+		}
+	}
+	return changed, known
+}
+
+// haveCommits returns the commits in oids that the repository has.
+func (r *Repo) haveCommits(ctx context.Context, oids []string) []string {
+	var have []string
+	for _, oid := range oids {
+		if r.hasCommit(ctx, oid) {
+			have = append(have, oid)
+		}
+	}
+	return have
+}
+
+// listSubmodules returns the submodules declared in the .gitmodules file of dir, a
+// path relative to the repository.
+func (r *Repo) listSubmodules(ctx context.Context, dir string) []Submodule {
+	if _, err := os.Stat(filepath.Join(r.path(dir), ".gitmodules")); err != nil {
+		return nil
+	}
+
+	cmd := r.Sub(dir).command(ctx, "config", "-f", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	var subs []Submodule
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, subPath, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		subs = append(subs, Submodule{Name: name, Path: subPath})
+	}
+	return subs
+}
+
+// ApplySubmodules checks out the submodules of the repository from bundles in bundleDir.
+// Submodules that are already cloned fetch the bundle into SubmoduleRefPrefix; new ones
+// are cloned from it and then pointed back at the URL in .gitmodules.
+func (r *Repo) ApplySubmodules(ctx context.Context, bundleDir string, subs []Submodule) error {
+	for _, sub := range subs {
+		bundlePath, err := absPath(filepath.Join(bundleDir, sub.Bundle))
+		if err != nil {
+			return err
+		}
+
+		parent := sub.Parent
+		if parent == "" {
+			parent = "."
+		}
+		gitIn := func(dir string, args ...string) error {
+			if output, err := r.Sub(dir).command(ctx, args...).CombinedOutput(); err != nil {
+				return fmt.Errorf("submodule %s: git %s failed: %s", sub.FullPath(), strings.Join(args, " "), string(output))
+			}
+			return nil
+		}
+
+		if err := gitIn(parent, "submodule", "init", "--", sub.Path); err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(filepath.Join(r.path(parent), sub.Path, ".git")); err == nil {
+			err := gitIn(filepath.Join(parent, sub.Path), "fetch", "-q", bundlePath,
+				"+refs/*:"+SubmoduleRefPrefix+"*", "+HEAD:"+SubmoduleRefPrefix+"HEAD")
+			if err != nil {
+				return err
+			}
+			if err := gitIn(parent, "submodule", "update", "--", sub.Path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := gitIn(parent, "config", "submodule."+sub.Name+".url", bundlePath); err != nil {
+			return err
+		}
+		if err := gitIn(parent, "-c", "protocol.file.allow=always", "submodule", "update", "--", sub.Path); err != nil {
+			return err
+		}
+		if err := gitIn(parent, "submodule", "sync", "--", sub.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveSubmoduleBundles deletes the submodule bundles that were created next to bundlePath.
+func RemoveSubmoduleBundles(bundlePath string, subs []Submodule) {
+	dir := filepath.Dir(bundlePath)
+	for _, sub := range subs {
+		os.Remove(filepath.Join(dir, sub.Bundle))
+	}
+}
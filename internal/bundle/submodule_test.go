@@ -0,0 +1,144 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupSubmoduleRepo returns a superproject with a submodule "lib" that itself has a
+// nested submodule "inner".
+func setupSubmoduleRepo(t *testing.T) (superDir, libDir string) {
+	innerDir := setupTestRepo(t)
+	libDir = setupTestRepo(t)
+	superDir = setupTestRepo(t)
+
+	git(t, libDir, "-c", "protocol.file.allow=always", "submodule", "add", "-q", innerDir, "inner")
+	git(t, libDir, "commit", "-q", "-m", "add inner")
+	git(t, superDir, "-c", "protocol.file.allow=always", "submodule", "add", "-q", libDir, "lib")
+	git(t, superDir, "commit", "-q", "-m", "add lib")
+	git(t, superDir, "-c", "protocol.file.allow=always", "submodule", "update", "-q", "--init", "--recursive")
+	return superDir, libDir
+}
+
+func TestSubmoduleBundles(t *testing.T) {
+	superDir, _ := setupSubmoduleRepo(t)
+	bundleDir := t.TempDir()
+	bundlePath := filepath.Join(bundleDir, "super.bundle")
+	super := NewRepo(superDir)
+	ctx := t.Context()
+
+	if err := super.CreateFull(ctx, bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := super.CreateSubmoduleBundles(ctx, bundlePath)
+	if err != nil {
+		t.Fatalf("CreateSubmoduleBundles failed: %v", err)
+	}
+	if len(subs) != 2 || subs[0].FullPath() != "lib" || subs[1].FullPath() != "lib/inner" {
+		t.Fatalf("Expected lib and lib/inner, got %+v", subs)
+	}
+	if subs[1].Parent != "lib" || subs[1].Bundle != "super.bundle.sub002" {
+		t.Errorf("Unexpected nested submodule: %+v", subs[1])
+	}
+
+	// A fresh clone gets its submodules from the bundles alone
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	git(t, bundleDir, "clone", "-q", bundlePath, cloneDir)
+	clone := NewRepo(cloneDir)
+	if err := clone.ApplySubmodules(ctx, bundleDir, subs); err != nil {
+		t.Fatalf("ApplySubmodules failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "lib", "inner", "file.txt")); err != nil {
+		t.Fatal("Nested submodule was not checked out")
+	}
+	if url := git(t, cloneDir, "config", "submodule.lib.url"); url == filepath.Join(bundleDir, subs[0].Bundle) {
+		t.Error("Submodule URL still points at the bundle")
+	}
+
+	// New submodule commits reach an existing checkout
+	commitFile(t, filepath.Join(superDir, "lib"), "new.txt", "new")
+	git(t, superDir, "commit", "-q", "-am", "bump lib")
+	RemoveSubmoduleBundles(bundlePath, subs)
+	if err := super.CreateFull(ctx, bundlePath+"2"); err != nil {
+		t.Fatal(err)
+	}
+	subs, err = super.CreateSubmoduleBundles(ctx, bundlePath+"2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	git(t, cloneDir, "pull", "-q", "--no-rebase", "--no-recurse-submodules", bundlePath+"2", "HEAD")
+	if err := clone.ApplySubmodules(ctx, bundleDir, subs); err != nil {
+		t.Fatalf("ApplySubmodules on an existing checkout failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "lib", "new.txt")); err != nil {
+		t.Error("Submodule was not updated to the new commit")
+	}
+}
+
+func TestSubmoduleBundlesIncremental(t *testing.T) {
+	superDir, _ := setupSubmoduleRepo(t)
+	bundleDir := t.TempDir()
+	super := NewRepo(superDir)
+	ctx := t.Context()
+
+	// The server starts from a full sync
+	fullPath := filepath.Join(bundleDir, "full.bundle")
+	if err := super.CreateFull(ctx, fullPath); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := super.CreateSubmoduleBundles(ctx, fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	git(t, bundleDir, "clone", "-q", fullPath, cloneDir)
+	clone := NewRepo(cloneDir)
+	if err := clone.ApplySubmodules(ctx, bundleDir, subs); err != nil {
+		t.Fatal(err)
+	}
+
+	base := git(t, superDir, "rev-parse", "HEAD")
+	synced := git(t, superDir, "rev-parse", "HEAD:lib")
+	commitFile(t, filepath.Join(superDir, "lib"), "new.txt", "new")
+	git(t, superDir, "commit", "-q", "-am", "bump lib")
+	commitFile(t, superDir, "other.txt", "other")
+	tip := git(t, superDir, "rev-parse", "HEAD")
+	bumped := git(t, superDir, "rev-parse", "HEAD:lib")
+
+	incPath := filepath.Join(bundleDir, "inc.bundle")
+	branch := git(t, superDir, "symbolic-ref", "HEAD")
+	if err := super.CreateRefs(ctx, incPath, map[string]string{branch: tip}, []string{base}); err != nil {
+		t.Fatal(err)
+	}
+	subs, err = super.CreateSubmoduleBundles(ctx, incPath)
+	if err != nil {
+		t.Fatalf("CreateSubmoduleBundles failed: %v", err)
+	}
+
+	// Only lib changed, and only its new commit is sent
+	if len(subs) != 1 || subs[0].FullPath() != "lib" {
+		t.Fatalf("Expected only lib to be bundled, got %+v", subs)
+	}
+	header, err := ReadHeader(filepath.Join(bundleDir, subs[0].Bundle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Prerequisites) != 1 || header.Prerequisites[0] != synced {
+		t.Errorf("Expected the bundle to require the synced commit %s, got %v", synced, header.Prerequisites)
+	}
+	for _, ref := range header.Refs {
+		if ref.Tip != bumped {
+			t.Errorf("Expected only the new gitlink %s, got %s %s", bumped, ref.Tip, ref.Name)
+		}
+	}
+
+	git(t, cloneDir, "pull", "-q", "--no-rebase", "--no-recurse-submodules", incPath, branch)
+	if err := clone.ApplySubmodules(ctx, bundleDir, subs); err != nil {
+		t.Fatalf("ApplySubmodules failed: %v", err)
+	}
+	if got := git(t, filepath.Join(cloneDir, "lib"), "rev-parse", "HEAD"); got != bumped {
+		t.Errorf("Expected lib at %s, got %s", bumped, got)
+	}
+}
@@ -0,0 +1,209 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VolumeManifestExt is appended to a bundle name to form the name of its volume manifest.
+const VolumeManifestExt = ".volumes.json"
+
+var (
+	// ErrMissingVolume is returned by Join when one or more parts are not present.
+	ErrMissingVolume = errors.New("missing bundle volume")
+	// ErrCorruptVolume is returned by Join when a part does not match its recorded hash.
+	ErrCorruptVolume = errors.New("corrupt bundle volume")
+)
+
+// Volume describes one fixed-size part of a split bundle.
+type Volume struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// VolumeManifest lists the parts a bundle was split into, so the receiving side can
+// detect missing or corrupt parts before reassembling it.
+type VolumeManifest struct {
+	Bundle  string   `json:"bundle"`
+	Size    int64    `json:"size"`
+	SHA256  string   `json:"sha256"`
+	Volumes []Volume `json:"volumes"`
+}
+
+// VolumeName returns the file name of the n-th (1-based) part of a bundle.
+func VolumeName(bundleName string, n int) string {
+	return fmt.Sprintf("%s.%03d", bundleName, n)
+}
+
+// Split cuts the bundle at path into numbered parts of at most volumeSize bytes
+// (bundle.001, bundle.002, ...) next to the original, and writes a manifest with the
+// hash of every part. The original bundle is left in place.
+func Split(path string, volumeSize int64) (*VolumeManifest, string, error) {
+	if volumeSize <= 0 {
+		return nil, "", fmt.Errorf("invalid volume size %d", volumeSize)
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer in.Close()
+
+	dir, name := filepath.Split(path)
+	manifest := &VolumeManifest{Bundle: name}
+	whole := sha256.New()
+
+	for n := 1; ; n++ {
+		partName := VolumeName(name, n)
+		vol, err := writeVolume(filepath.Join(dir, partName), io.TeeReader(io.LimitReader(in, volumeSize), whole))
+		if err != nil {
+			return nil, "", err
+		}
+		if vol.Size == 0 {
+			os.Remove(filepath.Join(dir, partName))
+			break
+		}
+
+		vol.Name = partName
+		manifest.Volumes = append(manifest.Volumes, *vol)
+		manifest.Size += vol.Size
+		if vol.Size < volumeSize {
+			break
+		}
+	}
+	manifest.SHA256 = hex.EncodeToString(whole.Sum(nil))
+
+	manifestPath := path + VolumeManifestExt
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal volume manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return nil, "", fmt.Errorf("failed to write volume manifest: %w", err)
+	}
+
+	return manifest, manifestPath, nil
+}
+
+// LoadVolumeManifest reads a volume manifest written by Split.
+func LoadVolumeManifest(manifestPath string) (*VolumeManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read volume manifest: %w", err)
+	}
+
+	var manifest VolumeManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse volume manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Join verifies every part listed in the manifest at manifestPath and reassembles them
+// into outputPath. Parts are looked up in the manifest's directory. All missing and
+// corrupt parts are reported at once, wrapping ErrMissingVolume or ErrCorruptVolume.
+func Join(manifestPath, outputPath string) error {
+	manifest, err := LoadVolumeManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(manifestPath)
+
+	var missing, corrupt []string
+	for _, vol := range manifest.Volumes {
+		sum, size, err := hashVolume(filepath.Join(dir, vol.Name))
+		switch {
+		case os.IsNotExist(err):
+			missing = append(missing, vol.Name)
+		case err != nil:
+			return err
+		case sum != vol.SHA256 || size != vol.Size:
+			corrupt = append(corrupt, vol.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingVolume, strings.Join(missing, ", "))
+	}
+	if len(corrupt) > 0 {
+		return fmt.Errorf("%w: %s", ErrCorruptVolume, strings.Join(corrupt, ", "))
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer out.Close()
+
+	whole := sha256.New()
+	for _, vol := range manifest.Volumes {
+		part, err := os.Open(filepath.Join(dir, vol.Name))
+		if err != nil {
+			return fmt.Errorf("failed to open volume: %w", err)
+		}
+		_, err = io.Copy(io.MultiWriter(out, whole), part)
+		part.Close()
+		if err != nil {
+			return fmt.Errorf("failed to reassemble bundle: %w", err)
+		}
+	}
+
+	if manifest.SHA256 != "" && hex.EncodeToString(whole.Sum(nil)) != manifest.SHA256 {
+		out.Close()
+		os.Remove(outputPath)
+		return fmt.Errorf("%w: reassembled bundle does not match %s", ErrCorruptVolume, manifest.SHA256)
+	}
+
+	return nil
+}
+
+// RemoveVolumes deletes the parts and the manifest of a split bundle.
+func RemoveVolumes(manifestPath string) error {
+	manifest, err := LoadVolumeManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(manifestPath)
+	for _, vol := range manifest.Volumes {
+		os.Remove(filepath.Join(dir, vol.Name))
+	}
+	return os.Remove(manifestPath)
+}
+
+func writeVolume(path string, r io.Reader) (*Volume, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create volume: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write volume: %w", err)
+	}
+
+	return &Volume{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func hashVolume(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read volume %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
@@ -0,0 +1,74 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestBundle(t *testing.T, size int) (string, []byte) {
+	data := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+	path := filepath.Join(t.TempDir(), "test.bundle")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestSplitAndJoin(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		volumeSize int64
+		wantParts  int
+	}{
+		{"uneven", 2500, 1000, 3},
+		{"exact", 2000, 1000, 2},
+		{"single", 500, 1000, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, data := writeTestBundle(t, tt.size)
+
+			manifest, manifestPath, err := Split(path, tt.volumeSize)
+			if err != nil {
+				t.Fatalf("Split failed: %v", err)
+			}
+			if len(manifest.Volumes) != tt.wantParts {
+				t.Errorf("Expected %d parts, got %d", tt.wantParts, len(manifest.Volumes))
+			}
+
+			outPath := filepath.Join(t.TempDir(), "joined.bundle")
+			if err := Join(manifestPath, outPath); err != nil {
+				t.Fatalf("Join failed: %v", err)
+			}
+
+			joined, _ := os.ReadFile(outPath)
+			if !bytes.Equal(joined, data) {
+				t.Error("Reassembled bundle differs from original")
+			}
+		})
+	}
+}
+
+func TestJoinDetectsMissingAndCorruptParts(t *testing.T) {
+	path, _ := writeTestBundle(t, 3000)
+	_, manifestPath, err := Split(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(t.TempDir(), "joined.bundle")
+
+	os.WriteFile(VolumeName(path, 2), []byte("garbage"), 0644)
+	if err := Join(manifestPath, outPath); !errors.Is(err, ErrCorruptVolume) {
+		t.Errorf("Expected ErrCorruptVolume, got %v", err)
+	}
+
+	os.Remove(VolumeName(path, 3))
+	if err := Join(manifestPath, outPath); !errors.Is(err, ErrMissingVolume) {
+		t.Errorf("Expected ErrMissingVolume, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WIPRef is the ref a bundle carries work in progress under.
+const WIPRef = "refs/gitsync/wip"
+
+// ReceivedWIPRef is where the receiving side keeps the last work in progress it got, so
+// it can be applied by hand if it was not applied automatically, and dropped once the
+// sending side has committed it.
+const ReceivedWIPRef = "refs/gitsync/received-wip"
+
+// wipIdentity names WIP commits when no git identity is configured, e.g. on a fresh server.
+var wipIdentity = []string{
+	"GIT_AUTHOR_NAME=gitsync", "GIT_AUTHOR_EMAIL=gitsync@localhost",
+	"GIT_COMMITTER_NAME=gitsync", "GIT_COMMITTER_EMAIL=gitsync@localhost",
+}
+
+// HasWIP reports whether the working tree or index has changes CaptureWIP would capture,
+// without writing anything to the repository.
+func (r *Repo) HasWIP(ctx context.Context, untracked bool) (bool, error) {
+	if r.Resolve(ctx, "HEAD^{commit}") == "" {
+		return false, fmt.Errorf("work in progress can only be captured on top of a commit")
+	}
+	return len(r.lines(ctx, wipStatus(untracked)...)) > 0, nil
+}
+
+// wipStatus returns the git status arguments that list the changes to capture.
+func wipStatus(untracked bool) []string {
+	status := []string{"status", "--porcelain", "--ignore-submodules=all"}
+	if !untracked {
+		status = append(status, "--untracked-files=no")
+	}
+	return status
+}
+
+// CaptureWIP records the uncommitted changes in the working tree and index as a commit
+// in the format of git stash: its tree is the working tree, its parents are HEAD, a
+// commit of the index and, with untracked, a commit of the untracked files that are not
+// ignored. The branch, index and working tree are left alone and no stash entry is
+// added. It returns "" if there is nothing to capture.
+func (r *Repo) CaptureWIP(ctx context.Context, untracked bool) (string, error) {
+	head := r.Resolve(ctx, "HEAD^{commit}")
+	if head == "" {
+		return "", fmt.Errorf("work in progress can only be captured on top of a commit")
+	}
+	if len(r.lines(ctx, wipStatus(untracked)...)) == 0 {
+		return "", nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "gitsync-wip-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	g := &Repo{Dir: r.Dir, Git: r.Git, Env: r.Env}
+	if !r.succeeds(ctx, "var", "GIT_COMMITTER_IDENT") {
+		g.Env = append(append([]string{}, r.Env...), wipIdentity...)
+	}
+	// A copy of the index collects the working tree without touching the real one
+	tmpIndex := filepath.Join(tmpDir, "index")
+	staging := &Repo{Dir: r.Dir, Git: r.Git, Env: append(append([]string{}, g.Env...), "GIT_INDEX_FILE="+tmpIndex)}
+
+	branch := "(no branch)"
+	if name := r.lines(ctx, "symbolic-ref", "-q", "--short", "HEAD"); len(name) == 1 {
+		branch = name[0]
+	}
+	subject := branch + ": " + strings.Join(r.lines(ctx, "log", "-1", "--format=%h %s", head), "")
+
+	indexTree, err := g.output(ctx, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	indexCommit, err := g.output(ctx, "commit-tree", "-p", head, "-m", "index on "+subject, indexTree)
+	if err != nil {
+		return "", err
+	}
+
+	parents := []string{"-p", head, "-p", indexCommit}
+	if untracked && len(r.lines(ctx, "ls-files", "--others", "--exclude-standard")) > 0 {
+		files, err := r.output(ctx, "ls-files", "-z", "--others", "--exclude-standard")
+		if err != nil {
+			return "", err
+		}
+		add := staging.command(ctx, "update-index", "-z", "--add", "--stdin")
+		add.Stdin = strings.NewReader(files)
+		if output, err := add.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("failed to record untracked files: %v: %s", err, string(output))
+		}
+		untrackedTree, err := staging.output(ctx, "write-tree")
+		if err != nil {
+			return "", err
+		}
+		untrackedCommit, err := g.output(ctx, "commit-tree", "-m", "untracked files on "+subject, untrackedTree)
+		if err != nil {
+			return "", err
+		}
+		parents = append(parents, "-p", untrackedCommit)
+		os.Remove(tmpIndex)
+	}
+
+	indexPath, err := r.gitPath(ctx, "index")
+	if err != nil {
+		return "", err
+	}
+	if data, err := os.ReadFile(indexPath); err == nil {
+		if err := os.WriteFile(tmpIndex, data, 0644); err != nil {
+			return "", err
+		}
+	}
+	if err := staging.run(ctx, "add", "--update"); err != nil {
+		return "", err
+	}
+	workTree, err := staging.output(ctx, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	args := append([]string{"commit-tree"}, parents...)
+	return g.output(ctx, append(args, "-m", "WIP on "+subject, workTree)...)
+}
+
+// CreateWIP creates a bundle of branch and the work in progress captured by CaptureWIP,
+// carried under WIPRef. Like CreateIncremental, commits the server already has through
+// origin/<branch> are left out; with full, every branch and tag is bundled in full.
+func (r *Repo) CreateWIP(ctx context.Context, outputPath, branch, wip string, full bool) error {
+	refs := map[string]string{WIPRef: wip}
+	var exclude []string
+	if full {
+		for ref, oid := range r.RefTips(ctx, "refs/heads/") {
+			refs[ref] = oid
+		}
+		for ref, oid := range r.RefTips(ctx, "refs/tags/") {
+			refs[ref] = oid
+		}
+	} else {
+		tip := r.Tip(ctx, branch)
+		if tip == "" {
+			return fmt.Errorf("branch %s not found", branch)
+		}
+		refs["refs/heads/"+branch] = tip
+		if base := r.Resolve(ctx, "refs/remotes/origin/"+branch); base != "" {
+			exclude = append(exclude, base)
+		}
+		exclude = append(exclude, r.ShallowBoundary(ctx)...)
+	}
+	return r.CreateRefs(ctx, outputPath, refs, exclude)
+}
+
+// ReceiveWIP stores the work in progress carried by a bundle under ReceivedWIPRef and
+// returns it, or "" if the bundle carries none.
+func (r *Repo) ReceiveWIP(ctx context.Context, bundlePath string) (string, error) {
+	bundlePath, err := absPath(bundlePath)
+	if err != nil {
+		return "", err
+	}
+	if !r.succeeds(ctx, "ls-remote", "--exit-code", bundlePath, WIPRef) {
+		return "", nil
+	}
+	if err := r.run(ctx, "fetch", "-q", "--no-recurse-submodules", "--no-tags", bundlePath, "+"+WIPRef+":"+ReceivedWIPRef); err != nil {
+		return "", err
+	}
+	return r.Resolve(ctx, ReceivedWIPRef), nil
+}
+
+// ApplyWIP restores work in progress into the working tree and index with git stash
+// apply. It is only applied on top of the commit it was captured on and into a working
+// tree without changes to tracked files, so it applies without conflicts; otherwise
+// nothing is changed and false is returned.
+func (r *Repo) ApplyWIP(ctx context.Context, wip string) (bool, error) {
+	if r.Resolve(ctx, "HEAD") != r.Resolve(ctx, wip+"^1") {
+		return false, nil
+	}
+	if len(r.lines(ctx, "status", "--porcelain", "--untracked-files=no", "--ignore-submodules=all")) > 0 {
+		return false, nil
+	}
+	if err := r.run(ctx, "stash", "apply", "--index", wip); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DropWIP undoes the work in progress last applied from ReceivedWIPRef if it is still
+// exactly as it was applied: HEAD has not moved and neither the index, the working tree
+// nor the restored untracked files have changed. The sending side still has it, usually
+// committed by now, so the working tree is clean for the next sync. The ref is kept, so
+// a dropped WIP can be applied again by hand. It reports whether anything was dropped.
+func (r *Repo) DropWIP(ctx context.Context) (bool, error) {
+	wip := r.Resolve(ctx, ReceivedWIPRef)
+	if wip == "" || r.Resolve(ctx, "HEAD") != r.Resolve(ctx, wip+"^1") {
+		return false, nil
+	}
+	if !r.succeeds(ctx, "diff", "--quiet", wip, "--") || !r.succeeds(ctx, "diff", "--quiet", "--cached", wip+"^2", "--") {
+		return false, nil
+	}
+
+	// Untracked files are only removed if they still have the content that was restored
+	var untracked []string
+	if r.Resolve(ctx, wip+"^3") != "" {
+		for _, line := range r.lines(ctx, "ls-tree", "-r", wip+"^3") {
+			meta, path, _ := strings.Cut(line, "\t")
+			fields := strings.Fields(meta)
+			if len(fields) != 3 {
+				continue
+			}
+			if hash := r.lines(ctx, "hash-object", "--", path); len(hash) != 1 || hash[0] != fields[2] {
+				return false, nil
+			}
+			untracked = append(untracked, path)
+		}
+	}
+	if r.succeeds(ctx, "diff", "--quiet", "HEAD", "--") && r.succeeds(ctx, "diff", "--quiet", "--cached", "HEAD", "--") && len(untracked) == 0 {
+		return false, nil
+	}
+
+	if err := r.run(ctx, "reset", "-q", "--hard", "HEAD"); err != nil {
+		return false, err
+	}
+	for _, path := range untracked {
+		if err := os.Remove(r.path(path)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,107 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWIP(t *testing.T) {
+	serverDir := setupTestRepo(t)
+	branch := git(t, serverDir, "symbolic-ref", "--short", "HEAD")
+	laptopDir := t.TempDir()
+	git(t, laptopDir, "clone", "-q", serverDir, ".")
+	git(t, laptopDir, "config", "user.email", "test@example.com")
+	git(t, laptopDir, "config", "user.name", "Test User")
+
+	laptop := NewRepo(laptopDir)
+	server := NewRepo(serverDir)
+	ctx := t.Context()
+
+	if wip, err := laptop.CaptureWIP(ctx, true); err != nil || wip != "" {
+		t.Fatalf("Expected nothing to capture in a clean tree, got %q, %v", wip, err)
+	}
+	if has, err := laptop.HasWIP(ctx, true); err != nil || has {
+		t.Fatalf("Expected no work in progress in a clean tree, got %v, %v", has, err)
+	}
+
+	// Unstaged, staged and untracked changes
+	if err := os.WriteFile(filepath.Join(laptopDir, "file.txt"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(laptopDir, "staged.txt"), []byte("staged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, laptopDir, "add", "staged.txt")
+	if err := os.WriteFile(filepath.Join(laptopDir, "untracked.txt"), []byte("untracked"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status := git(t, laptopDir, "status", "--porcelain")
+	objects := git(t, laptopDir, "count-objects")
+
+	if has, err := laptop.HasWIP(ctx, false); err != nil || !has {
+		t.Errorf("Expected work in progress, got %v, %v", has, err)
+	}
+	if got := git(t, laptopDir, "count-objects"); got != objects {
+		t.Errorf("HasWIP wrote objects: %s, was %s", got, objects)
+	}
+
+	wip, err := laptop.CaptureWIP(ctx, true)
+	if err != nil || wip == "" {
+		t.Fatalf("CaptureWIP failed: %q, %v", wip, err)
+	}
+	if got := git(t, laptopDir, "status", "--porcelain"); got != status {
+		t.Errorf("CaptureWIP changed the working tree:\n%s", got)
+	}
+	if git(t, laptopDir, "stash", "list") != "" {
+		t.Error("CaptureWIP added a stash entry")
+	}
+	if git(t, laptopDir, "rev-parse", wip+"^1") != git(t, laptopDir, "rev-parse", "HEAD") {
+		t.Error("Expected the WIP commit on top of HEAD")
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "wip.bundle")
+	if err := laptop.CreateWIP(ctx, bundlePath, branch, wip, false); err != nil {
+		t.Fatalf("CreateWIP failed: %v", err)
+	}
+	received, err := server.ReceiveWIP(ctx, bundlePath)
+	if err != nil || received != wip {
+		t.Fatalf("ReceiveWIP returned %q, %v, expected %s", received, err, wip)
+	}
+
+	applied, err := server.ApplyWIP(ctx, received)
+	if err != nil || !applied {
+		t.Fatalf("ApplyWIP failed: %v, %v", applied, err)
+	}
+	if got := git(t, serverDir, "status", "--porcelain"); got != status {
+		t.Errorf("Expected the laptop's changes on the server, got:\n%s", got)
+	}
+	if content, _ := os.ReadFile(filepath.Join(serverDir, "untracked.txt")); string(content) != "untracked" {
+		t.Errorf("Untracked file not restored: %q", content)
+	}
+
+	// Unchanged work in progress is dropped, changed work in progress is kept
+	dropped, err := server.DropWIP(ctx)
+	if err != nil || !dropped {
+		t.Fatalf("DropWIP failed: %v, %v", dropped, err)
+	}
+	if got := git(t, serverDir, "status", "--porcelain"); got != "" {
+		t.Errorf("Expected a clean server tree, got:\n%s", got)
+	}
+	if _, err := server.ApplyWIP(ctx, received); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(serverDir, "file.txt"), []byte("edited on the server"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if dropped, err := server.DropWIP(ctx); err != nil || dropped {
+		t.Errorf("Expected changed work in progress to be kept, got %v, %v", dropped, err)
+	}
+
+	// Work in progress is only applied on top of the commit it was captured on
+	git(t, serverDir, "stash", "-u")
+	commitFile(t, serverDir, "server.txt", "server work")
+	if applied, err := server.ApplyWIP(ctx, received); err != nil || applied {
+		t.Errorf("Expected ApplyWIP to skip a moved HEAD, got %v, %v", applied, err)
+	}
+}
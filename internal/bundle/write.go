@@ -0,0 +1,117 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// writeBundle writes a bundle directly, for what git bundle create cannot do: refs are
+// "oid refname" header lines, prerequisites are commits the receiving side must already
+// have, and objects are packed in addition to the history of refs. The pack comes from
+// git pack-objects with packArgs, e.g. an object filter.
+func (r *Repo) writeBundle(ctx context.Context, outputPath string, refs, prerequisites, objects []string, packArgs ...string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+
+	var header, revs strings.Builder
+	// Version 2 bundles can only hold SHA-1 repositories
+	if format := r.lines(ctx, "rev-parse", "--show-object-format"); len(format) == 1 && format[0] != "sha1" {
+		fmt.Fprintf(&header, "# v3 git bundle\n@object-format=%s\n", format[0])
+	} else {
+		header.WriteString("# v2 git bundle\n")
+	}
+	for _, oid := range prerequisites {
+		header.WriteString("-" + oid + "\n")
+		revs.WriteString("^" + oid + "\n")
+	}
+	for _, ref := range refs {
+		header.WriteString(ref + "\n")
+		revs.WriteString(strings.Fields(ref)[0] + "\n")
+	}
+	header.WriteString("\n")
+	for _, oid := range objects {
+		revs.WriteString(oid + "\n")
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer out.Close()
+	if _, err := out.WriteString(header.String()); err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+
+	// Like git bundle create, leave out objects the prerequisites already provide
+	args := []string{"pack-objects", "-q", "--stdout", "--revs"}
+	if len(prerequisites) > 0 {
+		args = append(args, "--thin")
+	}
+	var stderr bytes.Buffer
+	cmd := r.command(ctx, append(args, packArgs...)...)
+	cmd.Stdin = strings.NewReader(revs.String())
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("git pack-objects failed: %v: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// CreateRefs creates a bundle that holds the objects in refs, which maps ref names in
+// the bundle to objects, e.g. to push a commit under a different name. Commits in
+// exclude that the repository has become prerequisites, so history the receiving side
+// already has is left out.
+func (r *Repo) CreateRefs(ctx context.Context, outputPath string, refs map[string]string, exclude []string) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("no refs to bundle")
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, refs[name]+" "+name)
+	}
+
+	var prerequisites []string
+	seen := make(map[string]bool)
+	for _, oid := range exclude {
+		// Tags are peeled, prerequisites are always commits
+		commit := r.lines(ctx, "rev-parse", "--verify", "-q", oid+"^{commit}")
+		if len(commit) == 1 && !seen[commit[0]] {
+			seen[commit[0]] = true
+			prerequisites = append(prerequisites, commit[0])
+		}
+	}
+	return r.writeBundle(ctx, outputPath, lines, prerequisites, nil)
+}
+
+// Unbundle stores the objects of a bundle in the repository without updating any ref.
+// The prerequisites of the bundle must be present.
+func (r *Repo) Unbundle(ctx context.Context, bundlePath string) error {
+	bundlePath, err := absPath(bundlePath)
+	if err != nil {
+		return err
+	}
+	return r.run(ctx, "bundle", "unbundle", bundlePath)
+}
+
+// Resolve returns the object rev names, or "" if there is no such object.
+func (r *Repo) Resolve(ctx context.Context, rev string) string {
+	if oid := r.lines(ctx, "rev-parse", "--verify", "-q", rev); len(oid) == 1 {
+		return oid[0]
+	}
+	return ""
+}
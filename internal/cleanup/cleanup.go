@@ -0,0 +1,178 @@
+// Package cleanup keeps track of the temporary files a sync creates locally and on the
+// server, so they can be removed however the sync ends: on success, on failure, or when
+// it is interrupted.
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Runner runs shell commands on the server. *ssh.Client implements it.
+type Runner interface {
+	Run(ctx context.Context, command string) (string, error)
+}
+
+// artifact is a tracked path and everything named after it, such as the signature,
+// manifest and volumes next to a bundle. runner is nil for local artifacts. An exact
+// artifact is only the file itself.
+type artifact struct {
+	runner Runner
+	prefix string
+	always bool
+	exact  bool
+}
+
+// Tracker collects the artifacts of one sync and removes them when it finishes. It is
+// safe for concurrent use.
+type Tracker struct {
+	keep bool
+
+	mu        sync.Mutex
+	artifacts []artifact
+	finished  bool
+}
+
+// NewTracker returns an empty Tracker. With keep, Finish leaves every artifact in place
+// for debugging and only reports them.
+func NewTracker(keep bool) *Tracker {
+	return &Tracker{keep: keep}
+}
+
+// Temporary tracks a local file that is removed however the sync ends, along with
+// every file in the same directory whose name starts with its name.
+func (t *Tracker) Temporary(path string) {
+	t.add(artifact{prefix: path, always: true})
+}
+
+// TemporaryFile tracks a local file that is removed however the sync ends, but unlike
+// Temporary leaves the files named after it alone, e.g. the decrypted copy of x.bundle.age.
+func (t *Tracker) TemporaryFile(path string) {
+	t.add(artifact{prefix: path, always: true, exact: true})
+}
+
+// Output tracks a local file the sync produces, such as a bundle kept in the bundle
+// history. It is removed, like Temporary, only if the sync fails.
+func (t *Tracker) Output(path string) {
+	t.add(artifact{prefix: path})
+}
+
+// Remote tracks a file on the server that is removed however the sync ends, along with
+// every file next to it whose name starts with its name.
+func (t *Tracker) Remote(runner Runner, path string) {
+	t.add(artifact{runner: runner, prefix: path, always: true})
+}
+
+func (t *Tracker) add(a artifact) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.artifacts = append(t.artifacts, a)
+}
+
+// Finish removes the tracked artifacts: the temporary and remote ones always, the
+// outputs unless the sync succeeded. Only the first call does anything, so it can be
+// called both on the success path and on the way out of a failed sync. It returns the
+// paths it removed, or with keep those it left in place. Removal is best effort; the
+// error joins every failure.
+func (t *Tracker) Finish(ctx context.Context, success bool) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return nil, nil
+	}
+	t.finished = true
+
+	var paths []string
+	var errs []error
+	remote := make(map[Runner][]string)
+	var runners []Runner
+	for _, a := range t.artifacts {
+		if success && !a.always {
+			continue
+		}
+		if a.runner != nil {
+			if _, ok := remote[a.runner]; !ok {
+				runners = append(runners, a.runner)
+			}
+			remote[a.runner] = append(remote[a.runner], a.prefix)
+			paths = append(paths, a.prefix+"*")
+			continue
+		}
+		matches, err := matchLocal(a.prefix)
+		if a.exact {
+			matches = exactMatch(matches, a.prefix)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, path := range matches {
+			if !t.keep {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	if !t.keep {
+		for _, runner := range runners {
+			if _, err := runner.Run(ctx, RemoveScript(remote[runner]...)); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove files on the server: %w", err))
+			}
+		}
+	}
+	return paths, errors.Join(errs...)
+}
+
+// matchLocal returns prefix and the files next to it whose names start with its name.
+func matchLocal(prefix string) ([]string, error) {
+	dir, name := filepath.Split(prefix)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), name) && !entry.IsDir() {
+			matches = append(matches, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// exactMatch returns the one of matches that is path itself, if any.
+func exactMatch(matches []string, path string) []string {
+	for _, match := range matches {
+		if match == filepath.Clean(path) {
+			return []string{match}
+		}
+	}
+	return nil
+}
+
+// RemoveScript returns a POSIX shell command that removes every file whose path starts
+// with one of prefixes. A leading ~/ is left unquoted so the shell expands it.
+func RemoveScript(prefixes ...string) string {
+	words := []string{"rm", "-f", "--"}
+	for _, prefix := range prefixes {
+		home := ""
+		if rest, ok := strings.CutPrefix(prefix, "~/"); ok {
+			home, prefix = "~/", rest
+		}
+		words = append(words, home+"'"+strings.ReplaceAll(prefix, "'", `'\''`)+"'*")
+	}
+	return strings.Join(words, " ")
+}
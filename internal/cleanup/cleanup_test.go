@@ -0,0 +1,118 @@
+package cleanup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// shellRunner runs commands with the local shell, standing in for the server.
+type shellRunner struct{ commands []string }
+
+func (r *shellRunner) Run(ctx context.Context, command string) (string, error) {
+	r.commands = append(r.commands, command)
+	output, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+	return string(output), err
+}
+
+func touch(t *testing.T, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestTrackerFinish(t *testing.T) {
+	dir := t.TempDir()
+	serverDir := filepath.Join(t.TempDir(), "it's remote")
+	if err := os.Mkdir(serverDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "p-1.bundle")
+	temporary := filepath.Join(dir, "p-1.plain")
+	uploaded := filepath.Join(serverDir, "p-1.bundle")
+	unrelated := filepath.Join(dir, "p-2.bundle")
+	touch(t, output, output+".sig", output+".sub001", temporary, uploaded, uploaded+".001", unrelated)
+
+	newTracker := func(keep bool, runner Runner) *Tracker {
+		tr := NewTracker(keep)
+		tr.Output(output)
+		tr.Temporary(temporary)
+		tr.Remote(runner, uploaded)
+		tr.Temporary(filepath.Join(dir, "never-created"))
+		return tr
+	}
+
+	// Keeping reports everything a failed sync would remove and removes nothing
+	runner := &shellRunner{}
+	kept, err := newTracker(true, runner).Finish(t.Context(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 5 || len(runner.commands) != 0 || !exists(output) || !exists(uploaded) {
+		t.Errorf("Expected 5 artifacts kept and nothing removed, got %v, %v", kept, runner.commands)
+	}
+
+	// A successful sync keeps its outputs
+	tr := newTracker(false, runner)
+	removed, err := tr.Finish(t.Context(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{temporary, uploaded + "*"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("Removed %v, expected %v", removed, want)
+	}
+	if !exists(output) || !exists(output+".sig") || exists(temporary) || exists(uploaded) || exists(uploaded+".001") {
+		t.Error("Expected only the temporary and remote artifacts to be removed")
+	}
+	if removed, _ := tr.Finish(t.Context(), false); removed != nil {
+		t.Errorf("Expected a second Finish to do nothing, removed %v", removed)
+	}
+
+	// A failed sync removes its outputs too
+	if _, err := newTracker(false, runner).Finish(t.Context(), false); err != nil {
+		t.Fatal(err)
+	}
+	if exists(output) || exists(output+".sig") || exists(output+".sub001") {
+		t.Error("Expected the outputs of a failed sync to be removed")
+	}
+	if !exists(unrelated) {
+		t.Error("Removed a file that was not tracked")
+	}
+}
+
+func TestTrackerTemporaryFile(t *testing.T) {
+	dir := t.TempDir()
+	encrypted := filepath.Join(dir, "p-1.bundle.age")
+	plain := filepath.Join(dir, "p-1.bundle")
+	touch(t, encrypted, plain)
+
+	tr := NewTracker(false)
+	tr.Output(encrypted)
+	tr.TemporaryFile(plain)
+	removed, err := tr.Finish(t.Context(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{plain}) || exists(plain) || !exists(encrypted) {
+		t.Errorf("Expected only the plaintext to be removed, removed %v", removed)
+	}
+}
+
+func TestRemoveScript(t *testing.T) {
+	got := RemoveScript("~/sync/p.bundle", "/srv/it's")
+	want := `rm -f -- ~/'sync/p.bundle'* '/srv/it'\''s'*`
+	if got != want {
+		t.Errorf("RemoveScript() = %s, expected %s", got, want)
+	}
+}
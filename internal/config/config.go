@@ -4,6 +4,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -19,6 +22,9 @@ type Config struct {
 type ProjectConfig struct {
 	Name   string `yaml:"name"`
 	Branch string `yaml:"branch"`
+	// Strategy is how bundles are integrated on both sides:
+	// merge (default), rebase, ff-only or fetch-only.
+	Strategy string `yaml:"strategy,omitempty"`
 }
 
 // ServerConfig contains connection details for the remote air-gapped server.
@@ -28,6 +34,21 @@ type ServerConfig struct {
 	Port       int    `yaml:"port"`
 	RemotePath string `yaml:"remote_path"`
 	SSHKeyPath string `yaml:"ssh_key_path,omitempty"`
+	// Name is the remote name server branches are fetched under, refs/remotes/<name>/*.
+	Name string `yaml:"name,omitempty"`
+	// Layout is how the repository is kept on the server: "checkout" (default), a clone
+	// pushes are merged into, or "bare", a bare repository with managed worktrees.
+	Layout string `yaml:"layout,omitempty"`
+	// Worktrees are the worktrees of a bare server repository. Empty means one for the
+	// project branch.
+	Worktrees []WorktreeConfig `yaml:"worktrees,omitempty"`
+}
+
+// WorktreeConfig is a worktree of a bare server repository.
+type WorktreeConfig struct {
+	Branch string `yaml:"branch"`
+	// Path is relative to the server repository unless absolute. Empty means the branch name.
+	Path string `yaml:"path,omitempty"`
 }
 
 // BundleConfig contains settings for Git bundle creation and storage.
@@ -35,14 +56,121 @@ type BundleConfig struct {
 	Directory  string `yaml:"directory"`
 	Compress   bool   `yaml:"compress"`
 	MaxHistory int    `yaml:"max_history"`
+	VolumeSize string `yaml:"volume_size,omitempty"`
+	// MaxAge prunes bundles older than this, e.g. "30d". Empty keeps bundles regardless of age.
+	MaxAge string `yaml:"max_age,omitempty"`
+	// MaxSize bounds the total size of kept bundles, e.g. "2G". Empty disables the limit.
+	MaxSize string `yaml:"max_size,omitempty"`
+	// Format is how push sends commits: "bundle" (default) or "patch" for a patch series
+	// applied with git am.
+	Format string `yaml:"format,omitempty"`
+
+	Encryption EncryptionConfig `yaml:"encryption,omitempty"`
+	Signing    SigningConfig    `yaml:"signing,omitempty"`
+}
+
+// EncryptionConfig contains the age recipients and identities used to encrypt bundles at rest.
+type EncryptionConfig struct {
+	// Recipients are age public keys, SSH public keys or recipients files.
+	// Encryption is enabled when at least one recipient is set.
+	Recipients []string `yaml:"recipients,omitempty"`
+	// Identities are local age identity files or SSH private keys used for decryption.
+	Identities []string `yaml:"identities,omitempty"`
+	// RemoteIdentity is the identity file on the server used to decrypt pushed bundles.
+	RemoteIdentity string `yaml:"remote_identity,omitempty"`
+}
+
+// Enabled reports whether bundles should be encrypted.
+func (e EncryptionConfig) Enabled() bool {
+	return len(e.Recipients) > 0
+}
+
+// SigningConfig contains the SSH keys used to sign bundles and the allowed signers
+// files (ssh-keygen format) used to verify them before they are applied.
+type SigningConfig struct {
+	// Key is the local SSH private key used to sign pushed bundles.
+	Key string `yaml:"key,omitempty"`
+	// AllowedSigners is the local allowed signers file used to verify pulled bundles.
+	AllowedSigners string `yaml:"allowed_signers,omitempty"`
+	// RemoteKey is the SSH private key on the server used to sign bundles for pull.
+	RemoteKey string `yaml:"remote_key,omitempty"`
+	// RemoteAllowedSigners is the allowed signers file on the server used to verify pushed bundles.
+	RemoteAllowedSigners string `yaml:"remote_allowed_signers,omitempty"`
+	// Strict refuses unsigned bundles on both sides.
+	Strict bool `yaml:"strict,omitempty"`
 }
 
 // ConfigFile is the default name for the GitSynq configuration file.
 var ConfigFile = ".gitsync.yaml"
 
-// Load reads and parses the configuration file from the current directory.
+// Load reads and parses the configuration file from the current directory. server.name
+// must not be a remote the repository already has, as pull prunes refs/remotes/<name>/*.
 func Load() (*Config, error) {
-	data, err := os.ReadFile(ConfigFile)
+	cfg, err := LoadFile(ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if isGitRemote(filepath.Dir(ConfigFile), cfg.Server.Name) {
+		return nil, fmt.Errorf("server.name %q is already a git remote of this repository, choose another name", cfg.Server.Name)
+	}
+	return cfg, nil
+}
+
+// isGitRemote reports whether the repository in dir has a remote called name. Outside a
+// repository it has none.
+func isGitRemote(dir, name string) bool {
+	out, err := exec.Command("git", "-C", dir, "remote").Output()
+	if err != nil {
+		return false
+	}
+	for _, remote := range strings.Fields(string(out)) {
+		if remote == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validRefComponent reports whether name can be used as a single path component of a
+// ref, following git check-ref-format.
+func validRefComponent(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return false
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\/", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ProfileDir returns the directory holding named configurations, used where there is no
+// project directory to read .gitsync.yaml from, e.g. by the git-remote-gitsync helper.
+func ProfileDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "gitsync", "profiles"), nil
+}
+
+// LoadProfile reads the named configuration <ProfileDir>/<name>.yaml.
+func LoadProfile(name string) (*Config, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid profile name %q", name)
+	}
+	dir, err := ProfileDir()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(filepath.Join(dir, name+".yaml"))
+}
+
+// LoadFile reads and parses a configuration file, filling in defaults.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -56,6 +184,12 @@ func Load() (*Config, error) {
 	if cfg.Server.Port == 0 {
 		cfg.Server.Port = 22
 	}
+	if cfg.Server.Name == "" {
+		cfg.Server.Name = "gitsync"
+	}
+	if !validRefComponent(cfg.Server.Name) {
+		return nil, fmt.Errorf("server.name %q is not a valid remote name", cfg.Server.Name)
+	}
 	if cfg.Bundle.Directory == "" {
 		cfg.Bundle.Directory = ".gitsync-bundles"
 	}
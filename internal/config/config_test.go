@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -68,4 +70,86 @@ server:
 	if loaded.Bundle.Directory != ".gitsync-bundles" {
 		t.Errorf("Expected default directory .gitsync-bundles, got %s", loaded.Bundle.Directory)
 	}
+	if loaded.Server.Name != "gitsync" {
+		t.Errorf("Expected default server name gitsync, got %s", loaded.Server.Name)
+	}
+}
+
+func TestLoadServerName(t *testing.T) {
+	dir := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, output)
+	}
+	if output, err := exec.Command("git", "-C", dir, "remote", "add", "origin", "https://example.com/repo.git").CombinedOutput(); err != nil {
+		t.Fatalf("git remote add failed: %v: %s", err, output)
+	}
+	oldConfigFile := ConfigFile
+	defer func() { ConfigFile = oldConfigFile }()
+	ConfigFile = filepath.Join(dir, ".gitsync.yaml")
+
+	for name, valid := range map[string]bool{
+		"lab":     true,
+		"lab-2":   true,
+		"origin":  false,
+		"a/b":     false,
+		"a b":     false,
+		".hidden": false,
+		"x.lock":  false,
+		"a..b":    false,
+		"a@{1}":   false,
+		"what?":   false,
+		"star*":   false,
+		"a\\b":    false,
+		"caret^":  false,
+		"tilde~":  false,
+		"colon:":  false,
+	} {
+		data := []byte("server:\n  name: '" + name + "'\n")
+		if err := os.WriteFile(ConfigFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load()
+		if valid && (err != nil || cfg.Server.Name != name) {
+			t.Errorf("Expected server.name %q to load, got %v", name, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Expected server.name %q to be rejected", name)
+		}
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	dir, err := ProfileDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`
+server:
+  host: lab.example.com
+  user: dev
+  remote_path: /srv/git
+`)
+	if err := os.WriteFile(filepath.Join(dir, "lab.yaml"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadProfile("lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Host != "lab.example.com" || cfg.Server.Port != 22 {
+		t.Errorf("Expected the lab server with defaults, got %+v", cfg.Server)
+	}
+
+	for _, name := range []string{"", "missing", "../lab", ".hidden"} {
+		if _, err := LoadProfile(name); err == nil {
+			t.Errorf("Expected an error for profile %q", name)
+		}
+	}
 }
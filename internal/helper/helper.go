@@ -0,0 +1,324 @@
+// Package helper implements the git remote-helper protocol on top of bundles, so that
+// git fetch, pull and push can talk to a gitsync server directly. Git starts the
+// git-remote-gitsync binary for gitsync:// URLs and drives it through stdin and stdout;
+// see gitremote-helpers(7).
+package helper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/remote"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
+)
+
+// Scheme is the URL scheme git hands to git-remote-gitsync.
+const Scheme = "gitsync://"
+
+// Transport runs scripts on the server and moves files to and from it. *ssh.Client
+// implements it.
+type Transport interface {
+	Run(ctx context.Context, script string) (string, error)
+	Upload(localPath, remotePath string, onProgress ssh.ProgressFunc) error
+	Download(remotePath, localPath string, onProgress ssh.ProgressFunc) error
+	Remove(remotePath string) error
+}
+
+// URL is a parsed gitsync://profile/project remote URL.
+type URL struct {
+	// Profile names the configuration in config.ProfileDir that holds the server settings.
+	Profile string
+	// Project is the repository directory under the server's remote_path.
+	Project string
+}
+
+// ParseURL parses a remote URL as git passes it to the helper: gitsync://profile/project,
+// or profile/project when the remote was written as gitsync::profile/project.
+func ParseURL(raw string) (*URL, error) {
+	profile, project, ok := strings.Cut(strings.TrimPrefix(raw, Scheme), "/")
+	project = strings.TrimSuffix(project, "/")
+	if !ok || profile == "" || project == "" || strings.Contains(project, "/") || project == "." || project == ".." {
+		return nil, fmt.Errorf("invalid gitsync URL %q, expected %sprofile/project", raw, Scheme)
+	}
+	return &URL{Profile: profile, Project: project}, nil
+}
+
+// Helper answers the commands git sends to a remote helper for one server repository.
+type Helper struct {
+	// Repo is the local repository git runs the helper for.
+	Repo *bundle.Repo
+	// Transport reaches the server.
+	Transport Transport
+	// RepoPath is the repository on the server.
+	RepoPath string
+	// BundleDir is the server directory bundles are transferred through.
+	BundleDir string
+	// Name prefixes the names of transferred bundles, like the project name does for push.
+	Name string
+	// Log receives progress messages; git shows the helper's stderr to the user.
+	Log io.Writer
+	// PushRefusal, if set, is why every push is refused, e.g. a profile requiring signed
+	// or encrypted bundles, which only gitsync push sends.
+	PushRefusal string
+
+	// refs is the server's refs as last listed.
+	refs []remote.RemoteRef
+}
+
+// Serve reads commands from in and writes the replies to out until git ends the session
+// with a blank line or closes in.
+func (h *Helper) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+	for {
+		line, err := readLine(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var reply []string
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch cmd {
+		case "":
+			return nil
+		case "capabilities":
+			reply = []string{"fetch", "push", ""}
+		case "option":
+			reply = []string{"unsupported"}
+		case "list":
+			if reply, err = h.list(ctx); err != nil {
+				return err
+			}
+			reply = append(reply, "")
+		case "fetch":
+			batch, err := readBatch(r, line)
+			if err != nil {
+				return err
+			}
+			if err := h.fetch(ctx, batch); err != nil {
+				return err
+			}
+			reply = []string{""}
+		case "push":
+			batch, err := readBatch(r, line)
+			if err != nil {
+				return err
+			}
+			if reply, err = h.push(ctx, batch); err != nil {
+				return err
+			}
+			reply = append(reply, "")
+		default:
+			return fmt.Errorf("unsupported command %q", strings.TrimSpace(cmd+" "+arg))
+		}
+
+		if _, err := io.WriteString(out, strings.Join(reply, "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+}
+
+// readLine reads one command line without its line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// readBatch reads the lines following first up to the blank line that ends a batch of
+// fetch or push commands.
+func readBatch(r *bufio.Reader, first string) ([]string, error) {
+	batch := []string{first}
+	for {
+		line, err := readLine(r)
+		if err == io.EOF || line == "" {
+			return batch, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, line)
+	}
+}
+
+// list returns the server's refs in the format git expects from the list command.
+func (h *Helper) list(ctx context.Context) ([]string, error) {
+	output, err := h.Transport.Run(ctx, remote.ListScript(h.RepoPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list server refs: %w\n%s", err, output)
+	}
+	h.refs = remote.ParseRefs(output)
+
+	lines := make([]string, 0, len(h.refs))
+	for _, ref := range h.refs {
+		if ref.Target != "" {
+			lines = append(lines, "@"+ref.Target+" "+ref.Name)
+		} else {
+			lines = append(lines, ref.Oid+" "+ref.Name)
+		}
+	}
+	return lines, nil
+}
+
+// fetch has the server bundle the requested refs, leaving out what the local repository
+// already has, and stores the objects locally. Git updates the refs itself.
+func (h *Helper) fetch(ctx context.Context, batch []string) error {
+	var refs []string
+	for _, line := range batch {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid fetch command %q", line)
+		}
+		refs = append(refs, fields[2])
+	}
+
+	var haves []string
+	for _, tip := range h.Repo.RefTips(ctx, "refs/") {
+		haves = append(haves, tip)
+	}
+	sort.Strings(haves)
+
+	remoteBundle := h.bundlePath("fetch")
+	output, err := h.Transport.Run(ctx, remote.FetchScript(h.RepoPath, remoteBundle, refs, haves))
+	if err != nil {
+		return fmt.Errorf("failed to create bundle on server: %w\n%s", err, output)
+	}
+	defer h.Transport.Remove(remoteBundle)
+
+	tmpDir, err := os.MkdirTemp("", "gitsync-helper-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	localBundle := filepath.Join(tmpDir, filepath.Base(remoteBundle))
+
+	h.logf("Downloading %s...", filepath.Base(remoteBundle))
+	if err := h.Transport.Download(remoteBundle, localBundle, nil); err != nil {
+		return fmt.Errorf("failed to download bundle: %w", err)
+	}
+	return h.Repo.Unbundle(ctx, localBundle)
+}
+
+// push bundles the pushed commits, leaving out what the server already has, and has
+// the server apply the ref updates. It returns git's "ok"/"error" status lines.
+func (h *Helper) push(ctx context.Context, batch []string) ([]string, error) {
+	if h.refs == nil {
+		if _, err := h.list(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var updates []remote.PushUpdate
+	var status []string
+	refs := make(map[string]string)
+	for _, line := range batch {
+		spec := strings.TrimPrefix(line, "push ")
+		force := strings.HasPrefix(spec, "+")
+		src, dst, ok := strings.Cut(strings.TrimPrefix(spec, "+"), ":")
+		if !ok || dst == "" {
+			return nil, fmt.Errorf("invalid push command %q", line)
+		}
+		if src == "" {
+			updates = append(updates, remote.PushUpdate{Ref: dst, Force: force})
+			continue
+		}
+		oid := h.Repo.Resolve(ctx, src)
+		if oid == "" {
+			status = append(status, fmt.Sprintf("error %s src refspec %s does not match any", dst, src))
+			continue
+		}
+		updates = append(updates, remote.PushUpdate{Ref: dst, Oid: oid, Force: force})
+		refs[dst] = oid
+	}
+	if len(updates) == 0 {
+		return status, nil
+	}
+	if h.PushRefusal != "" {
+		for _, u := range updates {
+			status = append(status, "error "+u.Ref+" "+h.PushRefusal)
+		}
+		return status, nil
+	}
+
+	remoteBundle := ""
+	if len(refs) > 0 {
+		var exclude []string
+		for _, ref := range h.refs {
+			if ref.Oid != "" {
+				exclude = append(exclude, ref.Oid)
+			}
+		}
+
+		tmpDir, err := os.MkdirTemp("", "gitsync-helper-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+		remoteBundle = h.bundlePath("push")
+		localBundle := filepath.Join(tmpDir, filepath.Base(remoteBundle))
+		if err := h.Repo.CreateRefs(ctx, localBundle, refs, exclude); err != nil {
+			return nil, err
+		}
+
+		h.logf("Uploading %s...", filepath.Base(remoteBundle))
+		// The script removes the bundle once it is unbundled, but not when it fails early
+		defer h.Transport.Remove(remoteBundle)
+		if err := h.Transport.Upload(localBundle, remoteBundle, nil); err != nil {
+			return nil, fmt.Errorf("failed to upload bundle: %w", err)
+		}
+	}
+
+	output, err := h.Transport.Run(ctx, remote.PushScript(h.RepoPath, remoteBundle, updates))
+	results := remote.ParsePushResults(output)
+	reported := make(map[string]bool)
+	for _, result := range results {
+		reported[result.Ref] = true
+		if result.Error != "" {
+			status = append(status, "error "+result.Ref+" "+result.Error)
+		} else {
+			status = append(status, "ok "+result.Ref)
+		}
+	}
+	for _, u := range updates {
+		if reported[u.Ref] {
+			continue
+		}
+		// The script stopped before it got to this ref
+		message := "not applied on the server"
+		if err != nil {
+			message = strings.TrimSpace(fmt.Sprintf("%v %s", err, lastLine(output)))
+		}
+		status = append(status, "error "+u.Ref+" "+message)
+	}
+	return status, nil
+}
+
+// bundlePath returns a new path on the server for a transferred bundle.
+func (h *Helper) bundlePath(kind string) string {
+	timestamp := time.Now().Format("20060102-150405")
+	return filepath.Join(h.BundleDir, fmt.Sprintf("%s-%s-%s.bundle", h.Name, kind, timestamp))
+}
+
+func (h *Helper) logf(format string, args ...any) {
+	if h.Log != nil {
+		fmt.Fprintf(h.Log, "gitsync: "+format+"\n", args...)
+	}
+}
+
+// lastLine returns the last non-empty line of output, which usually explains a failure.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,270 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/remote"
+	"github.com/princetheprogrammerbtw/gitsynq/internal/ssh"
+)
+
+// localTransport runs server scripts with the local shell and copies files, standing in
+// for an SSH connection.
+type localTransport struct{}
+
+func (localTransport) Run(ctx context.Context, script string) (string, error) {
+	output, err := exec.CommandContext(ctx, "sh", "-c", script).CombinedOutput()
+	return string(output), err
+}
+
+func (localTransport) Upload(localPath, remotePath string, _ ssh.ProgressFunc) error {
+	return copyFile(localPath, remotePath)
+}
+
+func (localTransport) Download(remotePath, localPath string, _ ssh.ProgressFunc) error {
+	return copyFile(remotePath, localPath)
+}
+
+func (localTransport) Remove(remotePath string) error {
+	return os.Remove(remotePath)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func commitFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "-q", "-m", "update "+name)
+}
+
+// setupHelper returns a laptop repository with one commit and a helper for a server
+// repository that does not exist yet.
+func setupHelper(t *testing.T) (h *Helper, laptop, server, branch string) {
+	laptop = t.TempDir()
+	git(t, laptop, "init", "-q")
+	git(t, laptop, "config", "user.email", "test@example.com")
+	git(t, laptop, "config", "user.name", "Test User")
+	commitFile(t, laptop, "file.txt", "hello")
+	branch = git(t, laptop, "symbolic-ref", "--short", "HEAD")
+
+	bundleDir := t.TempDir()
+	server = filepath.Join(bundleDir, "project")
+	h = &Helper{
+		Repo:      bundle.NewRepo(laptop),
+		Transport: localTransport{},
+		RepoPath:  server,
+		BundleDir: bundleDir,
+		Name:      "project",
+	}
+	return h, laptop, server, branch
+}
+
+// serve sends commands to a new session of the helper and returns its replies.
+func serve(t *testing.T, h *Helper, commands ...string) string {
+	t.Helper()
+	h.refs = nil
+	var out strings.Builder
+	in := strings.NewReader(strings.Join(commands, "\n") + "\n\n")
+	if err := h.Serve(t.Context(), in, &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	return out.String()
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		profile string
+		project string
+	}{
+		{"gitsync://lab/myproject", "lab", "myproject"},
+		{"gitsync://lab/myproject/", "lab", "myproject"},
+		{"lab/myproject", "lab", "myproject"},
+	}
+	for _, tt := range tests {
+		u, err := ParseURL(tt.raw)
+		if err != nil {
+			t.Errorf("ParseURL(%q) failed: %v", tt.raw, err)
+			continue
+		}
+		if u.Profile != tt.profile || u.Project != tt.project {
+			t.Errorf("ParseURL(%q) = %+v", tt.raw, u)
+		}
+	}
+
+	for _, raw := range []string{"gitsync://lab", "gitsync:///myproject", "gitsync://lab/a/b", "gitsync://lab/.."} {
+		if _, err := ParseURL(raw); err == nil {
+			t.Errorf("Expected ParseURL(%q) to fail", raw)
+		}
+	}
+}
+
+func TestHelper(t *testing.T) {
+	h, laptop, server, branch := setupHelper(t)
+	ref := "refs/heads/" + branch
+
+	if got := serve(t, h, "capabilities"); got != "fetch\npush\n\n" {
+		t.Errorf("Unexpected capabilities: %q", got)
+	}
+	// The server repository does not exist yet
+	if got := serve(t, h, "list for-push"); got != "\n" {
+		t.Errorf("Expected no refs, got %q", got)
+	}
+
+	// The first push creates the server repository and checks the branch out
+	if got := serve(t, h, "list for-push", "push "+ref+":"+ref); !strings.HasSuffix(got, "ok "+ref+"\n\n") {
+		t.Fatalf("Push failed: %q", got)
+	}
+	tip := git(t, laptop, "rev-parse", "HEAD")
+	if got := git(t, server, "rev-parse", "HEAD"); got != tip {
+		t.Errorf("Server HEAD is %s, expected %s", got, tip)
+	}
+	if content, err := os.ReadFile(filepath.Join(server, "file.txt")); err != nil || string(content) != "hello" {
+		t.Errorf("Server working tree not updated: %q, %v", content, err)
+	}
+
+	// Later pushes only fast-forward the checked-out branch
+	commitFile(t, laptop, "file.txt", "hello again")
+	if got := serve(t, h, "list for-push", "push "+ref+":"+ref, "push "+ref+":refs/heads/feature"); !strings.HasSuffix(got, "ok "+ref+"\nok refs/heads/feature\n\n") {
+		t.Fatalf("Push failed: %q", got)
+	}
+	tip = git(t, laptop, "rev-parse", "HEAD")
+	if got := git(t, server, "rev-parse", "HEAD", "refs/heads/feature"); got != tip+"\n"+tip {
+		t.Errorf("Server refs not updated: %s", got)
+	}
+	if content, _ := os.ReadFile(filepath.Join(server, "file.txt")); string(content) != "hello again" {
+		t.Errorf("Server working tree not updated: %q", content)
+	}
+
+	// Commits made on the server are fetched
+	git(t, server, "config", "user.email", "server@example.com")
+	git(t, server, "config", "user.name", "Server User")
+	commitFile(t, server, "server.txt", "server")
+	serverTip := git(t, server, "rev-parse", "HEAD")
+	list := serve(t, h, "list")
+	if !strings.Contains(list, serverTip+" "+ref+"\n") || !strings.Contains(list, "@"+ref+" HEAD\n") {
+		t.Fatalf("Unexpected list: %q", list)
+	}
+	if got := serve(t, h, "fetch "+serverTip+" "+ref); got != "\n" {
+		t.Fatalf("Unexpected fetch reply: %q", got)
+	}
+	git(t, laptop, "cat-file", "-e", serverTip+"^{commit}")
+
+	// Diverged pushes need force, which the checked-out branch refuses
+	commitFile(t, laptop, "laptop.txt", "laptop")
+	got := serve(t, h, "list for-push", "push "+ref+":"+ref)
+	if !strings.HasSuffix(got, "error "+ref+" non-fast-forward\n\n") {
+		t.Errorf("Expected non-fast-forward error, got %q", got)
+	}
+	got = serve(t, h, "list for-push", "push +"+ref+":"+ref, "push +"+ref+":refs/heads/feature")
+	if !strings.Contains(got, "error "+ref+" refusing to force-update") || !strings.Contains(got, "ok refs/heads/feature\n") {
+		t.Errorf("Unexpected forced push reply: %q", got)
+	}
+
+	// Branches other than the checked-out one can be deleted
+	got = serve(t, h, "list for-push", "push :refs/heads/feature", "push :"+ref)
+	if !strings.Contains(got, "ok refs/heads/feature\n") || !strings.Contains(got, "error "+ref+" refusing to delete") {
+		t.Errorf("Unexpected delete reply: %q", got)
+	}
+
+	// Transferred bundles are cleaned up
+	entries, err := os.ReadDir(h.BundleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the repository in the bundle directory, got %d entries", len(entries))
+	}
+}
+
+func TestHelperRefusesPush(t *testing.T) {
+	bundles := func(t *testing.T, h *Helper) []string {
+		t.Helper()
+		matches, _ := filepath.Glob(filepath.Join(h.BundleDir, "*.bundle"))
+		return matches
+	}
+
+	t.Run("profile requires signing or encryption", func(t *testing.T) {
+		h, _, server, branch := setupHelper(t)
+		h.PushRefusal = "signing required"
+		ref := "refs/heads/" + branch
+		if got := serve(t, h, "list for-push", "push "+ref+":"+ref); !strings.HasSuffix(got, "error "+ref+" signing required\n\n") {
+			t.Errorf("Expected the push to be refused, got %q", got)
+		}
+		if _, err := os.Stat(server); !os.IsNotExist(err) {
+			t.Error("Expected nothing to reach the server")
+		}
+	})
+
+	t.Run("server hooks", func(t *testing.T) {
+		h, laptop, server, branch := setupHelper(t)
+		ref := "refs/heads/" + branch
+		serve(t, h, "list for-push", "push "+ref+":"+ref)
+		hooks := filepath.Join(server, ".git", remote.HookDir)
+		if err := os.MkdirAll(hooks, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(hooks, remote.HookPreApply), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		before := git(t, server, "rev-parse", "HEAD")
+		commitFile(t, laptop, "file.txt", "hooked")
+		if got := serve(t, h, "list for-push", "push "+ref+":"+ref); !strings.Contains(got, "error "+ref+" the server repository has hooks") {
+			t.Errorf("Expected the push to be refused, got %q", got)
+		}
+		if git(t, server, "rev-parse", "HEAD") != before {
+			t.Error("Expected the server branch to be left alone")
+		}
+		if left := bundles(t, h); len(left) != 0 {
+			t.Errorf("Expected the bundle to be removed, got %v", left)
+		}
+	})
+
+	t.Run("failing script", func(t *testing.T) {
+		h, _, server, branch := setupHelper(t)
+		ref := "refs/heads/" + branch
+		// A file where the repository should be makes the script fail before unbundling
+		if err := os.WriteFile(server, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := serve(t, h, "list for-push", "push "+ref+":"+ref); !strings.Contains(got, "error "+ref) {
+			t.Errorf("Expected the push to fail, got %q", got)
+		}
+		if left := bundles(t, h); len(left) != 0 {
+			t.Errorf("Expected the bundle to be removed, got %v", left)
+		}
+	})
+}
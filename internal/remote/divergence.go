@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+// Line prefixes the tip script uses to report the server branch.
+const (
+	TipPrefix    = "GITSYNC_TIP:"
+	BasePrefix   = "GITSYNC_BASE:"
+	AheadPrefix  = "GITSYNC_AHEAD:"
+	BehindPrefix = "GITSYNC_BEHIND:"
+)
+
+// TipScript returns a POSIX shell script that reports the server's tip of branch and the
+// files with uncommitted changes in its working tree, which in a bare repository is the
+// worktree that has branch checked out. When the server also has the local
+// commit, it compares the two itself and reports their merge base and the commits only
+// each side has, counted from the local side.
+func TipScript(repoPath, branch, local string) string {
+	return fmt.Sprintf(`
+		REPO_PATH="%s"
+		BRANCH="%s"
+		LOCAL="%s"
+
+		[ -d "$REPO_PATH/.git" ] || exit 0
+		cd "$REPO_PATH"
+		%s
+		TIP=$(git rev-parse --verify -q "refs/heads/$BRANCH^{commit}") || exit 0
+		echo "%s$TIP"
+		[ "$(git rev-parse --is-bare-repository)" = true ] || git status --porcelain --untracked-files=no --ignore-submodules=all | cut -c4- | sed 's/^/%s/'
+		if [ -n "$LOCAL" ] && git cat-file -e "$LOCAL^{commit}" 2>/dev/null; then
+			echo "%s$(git merge-base "$LOCAL" "$TIP")"
+			echo "%s$(git rev-list --count "$TIP..$LOCAL")"
+			echo "%s$(git rev-list --count "$LOCAL..$TIP")"
+		fi
+	`, repoPath, branch, local, EnterWorktreeScript(branch), TipPrefix, DirtyPrefix, BasePrefix, AheadPrefix, BehindPrefix)
+}
+
+// RemoteTip is the server branch as reported by TipScript.
+type RemoteTip struct {
+	// Tip is the commit of the server branch, "" if there is no such branch.
+	Tip string
+	// Divergence is set when the server had the local commit and compared it.
+	Divergence *bundle.Divergence
+	// Dirty lists the files with uncommitted changes on the server.
+	Dirty []string
+}
+
+// ParseTip extracts the server branch reported in the output of TipScript for local.
+func ParseTip(output, local string) (*RemoteTip, error) {
+	values := make(map[string]string)
+	var dirty []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if path, ok := strings.CutPrefix(line, DirtyPrefix); ok {
+			dirty = append(dirty, path)
+		}
+		for _, prefix := range []string{TipPrefix, BasePrefix, AheadPrefix, BehindPrefix} {
+			if strings.HasPrefix(line, prefix) {
+				values[prefix] = strings.TrimPrefix(line, prefix)
+			}
+		}
+	}
+
+	tip := &RemoteTip{Tip: values[TipPrefix], Dirty: dirty}
+	if tip.Tip == "" {
+		return tip, nil
+	}
+	if _, ok := values[AheadPrefix]; !ok {
+		return tip, nil
+	}
+
+	ahead, err := strconv.Atoi(values[AheadPrefix])
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit count from server: %q", values[AheadPrefix])
+	}
+	behind, err := strconv.Atoi(values[BehindPrefix])
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit count from server: %q", values[BehindPrefix])
+	}
+	tip.Divergence = &bundle.Divergence{
+		State:  bundle.Classify(ahead, behind),
+		Local:  local,
+		Remote: tip.Tip,
+		Base:   values[BasePrefix],
+		Ahead:  ahead,
+		Behind: behind,
+	}
+	return tip, nil
+}
+
+// Compare classifies the local commit against the server branch. Whichever side has
+// both commits does the comparison; when neither does, each side has commits the
+// other lacks and the branches have diverged.
+func (t *RemoteTip) Compare(ctx context.Context, repo *bundle.Repo, local string) (*bundle.Divergence, error) {
+	if t.Divergence != nil {
+		return t.Divergence, nil
+	}
+	d, err := repo.Compare(ctx, local, t.Tip)
+	if errors.Is(err, bundle.ErrUnknownCommit) && t.Tip != "" {
+		return bundle.Unrelated(local, t.Tip), nil
+	}
+	return d, err
+}
@@ -0,0 +1,101 @@
+package remote
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+// compareWithServer runs the tip script against server and classifies the laptop branch.
+func compareWithServer(t *testing.T, laptop, server, branch string) *bundle.Divergence {
+	t.Helper()
+	repo := bundle.NewRepo(laptop)
+	local := repo.Tip(t.Context(), branch)
+	output, err := exec.Command("sh", "-c", TipScript(server, branch, local)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Tip script failed: %v: %s", err, output)
+	}
+	tip, err := ParseTip(string(output), local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := tip.Compare(t.Context(), repo, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDivergence(t *testing.T) {
+	t.Run("up-to-date", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		d := compareWithServer(t, laptop, server, branch)
+		if d.State != bundle.SyncUpToDate || d.Base != d.Local {
+			t.Errorf("Expected up-to-date, got %+v", d)
+		}
+	})
+
+	t.Run("ahead", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		base := git(t, laptop, "rev-parse", "HEAD")
+		commitFile(t, laptop, "laptop.txt", "laptop")
+		commitFile(t, laptop, "laptop.txt", "laptop again")
+
+		// Only the laptop has both commits
+		d := compareWithServer(t, laptop, server, branch)
+		if d.State != bundle.SyncAhead || d.Ahead != 2 || d.Behind != 0 || d.Base != base {
+			t.Errorf("Expected 2 commits ahead, got %+v", d)
+		}
+	})
+
+	t.Run("behind", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		commitFile(t, server, "server.txt", "server")
+
+		// Only the server has both commits
+		d := compareWithServer(t, laptop, server, branch)
+		if d.State != bundle.SyncBehind || d.Ahead != 0 || d.Behind != 1 {
+			t.Errorf("Expected 1 commit behind, got %+v", d)
+		}
+	})
+
+	t.Run("diverged", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		commitFile(t, laptop, "laptop.txt", "laptop")
+		commitFile(t, server, "server.txt", "server")
+
+		d := compareWithServer(t, laptop, server, branch)
+		if d.State != bundle.SyncDiverged {
+			t.Errorf("Expected diverged, got %+v", d)
+		}
+	})
+
+	t.Run("no server repository", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		os.RemoveAll(server)
+
+		d := compareWithServer(t, laptop, server, branch)
+		if d.State != bundle.SyncAhead || d.Remote != "" || d.Ahead != 1 {
+			t.Errorf("Expected everything to be ahead, got %+v", d)
+		}
+	})
+}
+
+func TestParseTip(t *testing.T) {
+	tip, err := ParseTip("noise\n"+TipPrefix+"abc\n"+BasePrefix+"def\n"+AheadPrefix+"2\n"+BehindPrefix+"3\n", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip.Tip != "abc" || tip.Dirty != nil || tip.Divergence == nil || tip.Divergence.State != bundle.SyncDiverged || tip.Divergence.Base != "def" {
+		t.Errorf("Unexpected tip: %+v %+v", tip, tip.Divergence)
+	}
+
+	if tip, err := ParseTip(TipPrefix+"abc\n"+DirtyPrefix+"a.txt\n", "123"); err != nil || tip.Divergence != nil || len(tip.Dirty) != 1 || tip.Dirty[0] != "a.txt" {
+		t.Errorf("Expected the comparison to be left to the local side, got %+v (%v)", tip, err)
+	}
+	if _, err := ParseTip(TipPrefix+"abc\n"+AheadPrefix+"x\n"+BehindPrefix+"0\n", "123"); err == nil {
+		t.Error("Expected an error for an invalid count")
+	}
+}
@@ -0,0 +1,70 @@
+package remote
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Line prefixes the estimate script uses to report a bundle it would create.
+const (
+	SizePrefix   = "GITSYNC_SIZE:"
+	CountPrefix  = "GITSYNC_COUNT:"
+	CommitPrefix = "GITSYNC_COMMIT:"
+)
+
+// Estimate describes the bundle a pull would download, as reported by EstimateScript.
+type Estimate struct {
+	// Size is estimated from the size of the objects in the server's packs.
+	Size int64
+	// Count is the number of commits; Commits lists the newest of them one per line.
+	Count   int
+	Commits []string
+}
+
+// EstimateScript returns a POSIX shell script that reports what a pull bundle of the
+// server's branches and tags would contain, leaving out the commits reachable from the
+// haves the server has, as the pull script does, without creating it. At most limit
+// commits are listed. A missing repository reports nothing.
+func EstimateScript(repoPath string, haves []string, limit int) string {
+	return fmt.Sprintf(`
+		REPO_PATH="%s"
+		HAVES="%s"
+
+		[ -d "$REPO_PATH/.git" ] || exit 0
+		cd "$REPO_PATH"
+		NOT=""
+		for OID in $HAVES; do
+			if git cat-file -e "$OID^{commit}" 2>/dev/null; then
+				NOT="$NOT ^$OID"
+			fi
+		done
+		echo "%s$(git rev-list --count --branches --tags $NOT)"
+		git log --oneline --no-decorate --max-count=%d --branches --tags $NOT | sed 's/^/%s/'
+		echo "%s$(git rev-list --objects --branches --tags $NOT | cut -d' ' -f1 \
+			| git cat-file --batch-check='%%(objectsize:disk)' | awk '{ n += $1 } END { print n + 0 }')"
+	`, repoPath, strings.Join(haves, " "), CountPrefix, limit, CommitPrefix, SizePrefix)
+}
+
+// ParseEstimate extracts the estimate reported in the output of EstimateScript. It
+// returns nil if nothing was reported, e.g. because the server has no repository.
+func ParseEstimate(output string) (*Estimate, error) {
+	var e *Estimate
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		var err error
+		switch {
+		case strings.HasPrefix(line, CountPrefix):
+			e = &Estimate{}
+			e.Count, err = strconv.Atoi(strings.TrimPrefix(line, CountPrefix))
+		case strings.HasPrefix(line, CommitPrefix) && e != nil:
+			e.Commits = append(e.Commits, strings.TrimPrefix(line, CommitPrefix))
+		case strings.HasPrefix(line, SizePrefix) && e != nil:
+			e.Size, err = strconv.ParseInt(strings.TrimPrefix(line, SizePrefix), 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid estimate from server: %q", line)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,46 @@
+package remote
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func runEstimate(t *testing.T, server string, haves []string) *Estimate {
+	t.Helper()
+	output, err := exec.Command("sh", "-c", EstimateScript(server, haves, 1)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Estimate script failed: %v: %s", err, output)
+	}
+	e, err := ParseEstimate(string(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEstimateScript(t *testing.T) {
+	laptop, server, _ := setupRepos(t)
+	commitFile(t, server, "a.txt", "a")
+	commitFile(t, server, "b.txt", "b")
+	have := git(t, laptop, "rev-parse", "HEAD")
+
+	// Only the commits the laptop lacks are counted
+	e := runEstimate(t, server, []string{have, "0123456789012345678901234567890123456789"})
+	if e == nil || e.Count != 2 || e.Size <= 0 {
+		t.Fatalf("Expected 2 new commits, got %+v", e)
+	}
+	if want := git(t, server, "log", "--oneline", "--no-decorate", "-1"); len(e.Commits) != 1 || e.Commits[0] != want {
+		t.Errorf("Expected only the newest commit listed, got %v", e.Commits)
+	}
+
+	// Without a common base everything is counted
+	if full := runEstimate(t, server, nil); full.Count != 3 || full.Size <= e.Size {
+		t.Errorf("Expected the complete history, got %+v", full)
+	}
+
+	os.RemoveAll(server)
+	if e := runEstimate(t, server, []string{have}); e != nil {
+		t.Errorf("Expected no estimate without a server repository, got %+v", e)
+	}
+}
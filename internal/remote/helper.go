@@ -0,0 +1,234 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line prefixes the remote helper scripts use to report back.
+const (
+	RefPrefix    = "GITSYNC_REF:"
+	BundlePrefix = "GITSYNC_BUNDLE:"
+	PushPrefix   = "GITSYNC_PUSH:"
+)
+
+// RemoteRef is a ref of the server repository. Symbolic refs such as HEAD have a Target
+// instead of an Oid.
+type RemoteRef struct {
+	Name   string
+	Oid    string
+	Target string
+}
+
+// ListScript returns a POSIX shell script that lists the branches and tags of the server
+// repository and where its HEAD points. A missing repository has no refs.
+func ListScript(repoPath string) string {
+	return fmt.Sprintf(`
+		REPO_PATH="%s"
+
+		[ -d "$REPO_PATH/.git" ] || exit 0
+		cd "$REPO_PATH"
+		git for-each-ref --format='%s%%(objectname) %%(refname)' refs/heads refs/tags
+		HEAD_REF=$(git symbolic-ref -q HEAD || true)
+		if [ -n "$HEAD_REF" ] && git rev-parse -q --verify "$HEAD_REF" >/dev/null; then
+			echo "%s@$HEAD_REF HEAD"
+		fi
+	`, repoPath, RefPrefix, RefPrefix)
+}
+
+// ParseRefs extracts the refs reported by ListScript.
+func ParseRefs(output string) []RemoteRef {
+	var refs []RemoteRef
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, RefPrefix) {
+			continue
+		}
+		value, name, ok := strings.Cut(strings.TrimPrefix(line, RefPrefix), " ")
+		if !ok {
+			continue
+		}
+		if target, ok := strings.CutPrefix(value, "@"); ok {
+			refs = append(refs, RemoteRef{Name: name, Target: target})
+		} else {
+			refs = append(refs, RemoteRef{Name: name, Oid: value})
+		}
+	}
+	return refs
+}
+
+// FetchScript returns a POSIX shell script that bundles refs of the server repository
+// into bundlePath. Commits in haves that the server has are left out, since the
+// fetching side already has them.
+func FetchScript(repoPath, bundlePath string, refs, haves []string) string {
+	return fmt.Sprintf(`
+		set -e
+
+		REPO_PATH="%s"
+		BUNDLE_PATH="%s"
+		REFS="%s"
+		HAVES="%s"
+
+		cd "$REPO_PATH"
+		NOT=""
+		for OID in $HAVES; do
+			if git cat-file -e "$OID^{commit}" 2>/dev/null; then
+				NOT="$NOT ^$OID"
+			fi
+		done
+		mkdir -p "$(dirname "$BUNDLE_PATH")"
+		git bundle create -q "$BUNDLE_PATH" $REFS $NOT
+		echo "%s$BUNDLE_PATH"
+	`, repoPath, bundlePath, strings.Join(refs, " "), strings.Join(haves, " "), BundlePrefix)
+}
+
+// PushUpdate is a ref update requested by git push. An empty Oid deletes Ref.
+type PushUpdate struct {
+	Ref   string
+	Oid   string
+	Force bool
+}
+
+// PushResult is the server's answer to a PushUpdate. Error is empty on success.
+type PushResult struct {
+	Ref   string
+	Error string
+}
+
+// PushScript returns a POSIX shell script that applies ref updates to the server
+// repository, creating it if needed. The objects come from the bundle at bundlePath,
+// if set, which is removed afterwards. Like a git server, it refuses non-fast-forward
+// updates unless forced and never overwrites existing tags. The checked-out branch is
+// fast-forwarded together with the working tree, refusing uncommitted changes and
+// forced updates, and a new repository checks out the first branch pushed to it. In a
+// bare repository, see LayoutBare, branches checked out in worktrees are treated alike.
+// Server hooks, see HookDir, only run for gitsync push, so a repository that has them
+// refuses every update.
+func PushScript(repoPath, bundlePath string, updates []PushUpdate) string {
+	var lines []string
+	for _, u := range updates {
+		force := ""
+		if u.Force {
+			force = "+"
+		}
+		lines = append(lines, strings.Join([]string{force, u.Oid, u.Ref}, "|"))
+	}
+
+	return fmt.Sprintf(`
+		set -e
+
+		REPO_PATH="%s"
+		BUNDLE_PATH="%s"
+		UPDATES="%s"
+
+		report() {
+			echo "%s$*"
+		}
+		%s
+		if [ ! -d "$REPO_PATH/.git" ]; then
+			git init -q "$REPO_PATH"
+		fi
+		cd "$REPO_PATH"
+		BARE=$(git rev-parse --is-bare-repository)
+		HOOK_DIR="$(git rev-parse --git-common-dir)/%s"
+		if [ -e "$HOOK_DIR/%s" ] || [ -e "$HOOK_DIR/%s" ]; then
+			[ -z "$BUNDLE_PATH" ] || rm -f "$BUNDLE_PATH"
+			while IFS='|' read -r FORCE OID DST; do
+				[ -z "$DST" ] || report "error $DST the server repository has hooks, push with gitsync push"
+			done <<-UPDATES_EOF
+				$UPDATES
+			UPDATES_EOF
+			exit 0
+		fi
+		if [ -n "$BUNDLE_PATH" ]; then
+			git bundle unbundle "$BUNDLE_PATH" >/dev/null
+			rm -f "$BUNDLE_PATH"
+		fi
+
+		while IFS='|' read -r FORCE OID DST; do
+			[ -n "$DST" ] || continue
+			CURRENT=$(git symbolic-ref -q HEAD || true)
+			WORKTREE=.
+			if [ "$BARE" = true ]; then
+				WORKTREE=""
+				case "$DST" in
+				refs/heads/*) WORKTREE=$(worktree_of "${DST#refs/heads/}") ;;
+				esac
+				CURRENT=""
+				[ -z "$WORKTREE" ] || CURRENT="$DST"
+			fi
+			OLD=$(git rev-parse -q --verify "$DST" || true)
+
+			if [ -z "$OID" ]; then
+				if [ "$DST" = "$CURRENT" ]; then
+					report "error $DST refusing to delete the checked-out branch"
+				elif [ -z "$OLD" ]; then
+					report "error $DST no such ref"
+				else
+					git update-ref -d "$DST" "$OLD"
+					report "ok $DST"
+				fi
+				continue
+			fi
+
+			if [ -n "$OLD" ] && [ "$OLD" != "$OID" ] && [ "$FORCE" != "+" ]; then
+				case "$DST" in
+				refs/tags/*)
+					report "error $DST already exists"
+					continue
+					;;
+				esac
+				if ! git merge-base --is-ancestor "$OLD" "$OID" 2>/dev/null; then
+					report "error $DST non-fast-forward"
+					continue
+				fi
+			fi
+
+			# A new repository checks out the first branch pushed to it
+			if [ "$BARE" != true ] && ! git rev-parse -q --verify HEAD >/dev/null; then
+				case "$DST" in
+				refs/heads/*)
+					git symbolic-ref HEAD "$DST"
+					CURRENT="$DST"
+					;;
+				esac
+			fi
+
+			if [ "$DST" != "$CURRENT" ]; then
+				git update-ref "$DST" "$OID" $OLD
+			elif [ -n "$(git -C "$WORKTREE" status --porcelain --untracked-files=no)" ]; then
+				report "error $DST server working tree has uncommitted changes"
+				continue
+			elif [ -z "$OLD" ]; then
+				git update-ref "$DST" "$OID"
+				git reset -q --hard
+			elif ! git -C "$WORKTREE" merge -q --ff-only "$OID" >/dev/null 2>&1; then
+				report "error $DST refusing to force-update the checked-out branch"
+				continue
+			fi
+			report "ok $DST"
+		done <<-UPDATES_EOF
+			$UPDATES
+		UPDATES_EOF
+	`, repoPath, bundlePath, strings.Join(lines, "\n"), PushPrefix, worktreeOf, HookDir, HookPreApply, HookPostApply)
+}
+
+// ParsePushResults extracts the results reported by PushScript.
+func ParsePushResults(output string) []PushResult {
+	var results []PushResult
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, PushPrefix) {
+			continue
+		}
+		status, rest, _ := strings.Cut(strings.TrimPrefix(line, PushPrefix), " ")
+		ref, message, _ := strings.Cut(rest, " ")
+		switch status {
+		case "ok":
+			results = append(results, PushResult{Ref: ref})
+		case "error":
+			results = append(results, PushResult{Ref: ref, Error: message})
+		}
+	}
+	return results
+}
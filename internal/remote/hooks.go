@@ -0,0 +1,117 @@
+package remote
+
+import "fmt"
+
+// Server hooks are executables in HookDir of the server repository's git directory,
+// .git/gitsync-hooks in either layout, where no push can write.
+// The setup script runs them with the refs a push brings in as "old new ref" lines on
+// stdin, old being all zeros for a new branch, and GITSYNC_FORMAT set to bundle. For a
+// patch series, GITSYNC_FORMAT is patch and pre-apply gets a "commit subject" line per
+// patch instead. A hook that exits non-zero, or is not executable, rejects the push and
+// the server repository is rolled back.
+const (
+	HookDir = "gitsync-hooks"
+	// HookPreApply runs once a bundle has been fetched, or before patches are applied,
+	// before anything is integrated.
+	HookPreApply = "pre-apply"
+	// HookPostApply runs once the push has been integrated, with the outcome in
+	// GITSYNC_OUTCOME, but before submodules are updated.
+	HookPostApply = "post-apply"
+)
+
+// Line prefixes the setup script reports a rejecting hook with: its name, then what it
+// printed, one line at a time.
+const (
+	HookPrefix       = "GITSYNC_HOOK:"
+	HookOutputPrefix = "GITSYNC_HOOK_OUTPUT:"
+)
+
+// hookFunctions returns the shell functions the setup script runs server hooks with.
+// snapshot_refs has to be called in the repository before anything changes, and
+// INCOMING has to be set before run_hook. Rolling back resets the branches and the
+// tracking refs under TRACKING to the snapshot, checked-out branches with their
+// worktrees, restores the shallow boundary and removes the worktrees add_worktrees
+// created since. Submodule checkouts are not rolled back, so the setup script only
+// updates them once post-apply has accepted the push.
+func hookFunctions() string {
+	return fmt.Sprintf(`
+		snapshot_refs() {
+			REFS_BEFORE=$(git for-each-ref --format='%%(objectname) %%(refname)' refs/heads "$TRACKING")
+			SHALLOW_BEFORE=$(cat "$(git rev-parse --git-dir)/shallow" 2>/dev/null || true)
+			CREATED_WORKTREES=""
+			HOOK_DIR="$(cd "$(git rev-parse --git-common-dir)" && pwd)/%s"
+		}
+
+		# The branches of bundle $1 as "old new ref" lines
+		incoming_refs() {
+			git bundle list-heads "$1" | while read -r NEW REF; do
+				case "$REF" in
+				refs/heads/*)
+					OLD=$(git rev-parse -q --verify "$REF" || echo "$NEW" | tr 0-9a-f 0)
+					echo "$OLD $NEW $REF"
+					;;
+				esac
+			done
+		}
+
+		rollback() {
+			cd "$REPO_ROOT"
+			while IFS= read -r WT_PATH; do
+				[ -z "$WT_PATH" ] || git worktree remove --force "$WT_PATH"
+			done <<-HOOK_EOF
+				$CREATED_WORKTREES
+			HOOK_EOF
+			git for-each-ref --format='%%(refname)' refs/heads "$TRACKING" | while read -r REF; do
+				echo "$REFS_BEFORE" | awk -v ref="$REF" '$2 == ref { found = 1 } END { exit !found }' ||
+					git update-ref -d "$REF"
+			done
+			echo "$REFS_BEFORE" | while read -r OLD REF; do
+				[ -n "$REF" ] || continue
+				[ "$(git rev-parse -q --verify "$REF")" != "$OLD" ] || continue
+				WT=""
+				case "$REF" in
+				refs/heads/*) WT=$(worktree_of "${REF#refs/heads/}") ;;
+				esac
+				if [ -n "$WT" ]; then
+					git -C "$WT" reset -q --hard "$OLD"
+				else
+					git update-ref "$REF" "$OLD"
+				fi
+			done
+			if [ -n "$SHALLOW_BEFORE" ]; then
+				echo "$SHALLOW_BEFORE" > "$(git rev-parse --git-dir)/shallow"
+			else
+				rm -f "$(git rev-parse --git-dir)/shallow"
+			fi
+			echo "↩️  The server repository was rolled back"
+		}
+
+		# Run hook $1 from the repository directory, passing outcome $2 to post-apply. If
+		# it fails, roll back and report what it printed.
+		run_hook() {
+			HOOK="$HOOK_DIR/$1"
+			[ -e "$HOOK" ] || return 0
+			echo "⚓ Running server hook: $1..."
+			FORMAT=bundle
+			[ "$PATCH" != true ] || FORMAT=patch
+			if [ -d "$HOOK" ] || [ ! -x "$HOOK" ]; then
+				HOOK_OUTPUT="$HOOK is not executable, make it so with chmod +x or remove it"
+				HOOK_STATUS=126
+			else
+				HOOK_OUTPUT=$(cd "$REPO_ROOT" && echo "$INCOMING" | sed '/^$/d' |
+					GITSYNC_BRANCH="$BRANCH" GITSYNC_STRATEGY="$STRATEGY" GITSYNC_FORMAT="$FORMAT" GITSYNC_OUTCOME="$2" "$HOOK" 2>&1) &&
+					HOOK_STATUS=0 || HOOK_STATUS=$?
+			fi
+			if [ "$HOOK_STATUS" = 0 ]; then
+				[ -z "$HOOK_OUTPUT" ] || echo "$HOOK_OUTPUT"
+				return 0
+			fi
+			echo "%s$1"
+			[ -z "$HOOK_OUTPUT" ] || echo "$HOOK_OUTPUT" | sed 's/^/%s/'
+			echo "❌ Server hook $1 exited with status $HOOK_STATUS, the push was rejected" >&2
+			rollback
+			report rejected
+			exit 1
+		}
+	`, HookDir, HookPrefix, HookOutputPrefix)
+}
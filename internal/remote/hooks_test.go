@@ -0,0 +1,198 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+// writeHook installs a server hook in the git directory gitDir.
+func writeHook(t *testing.T, gitDir, name, script string) {
+	t.Helper()
+	dir := filepath.Join(gitDir, HookDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetupScriptHooks(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	hooks := filepath.Join(server, ".git")
+	commitFile(t, laptop, "new.txt", "new")
+	before := git(t, server, "rev-parse", "HEAD")
+	pushed := git(t, laptop, "rev-parse", "HEAD")
+	stdin := filepath.Join(t.TempDir(), "stdin")
+
+	// pre-apply sees the incoming refs and can reject the push before anything moves
+	writeHook(t, hooks, HookPreApply, "cat > '"+stdin+"'\necho 'no pushes today'\nexit 1\n")
+	outcome, output, err := runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+	if err == nil || outcome.State != StateRejected || !outcome.Failed() {
+		t.Fatalf("Expected rejected, got %s: %s", outcome.State, output)
+	}
+	if outcome.Hook != HookPreApply || len(outcome.HookOutput) != 1 || outcome.HookOutput[0] != "no pushes today" {
+		t.Errorf("Unexpected hook report %q %q", outcome.Hook, outcome.HookOutput)
+	}
+	data, _ := os.ReadFile(stdin)
+	if want := before + " " + pushed + " refs/heads/" + branch + "\n"; string(data) != want {
+		t.Errorf("pre-apply got %q on stdin, expected %q", data, want)
+	}
+	if exec.Command("git", "-C", server, "rev-parse", "-q", "--verify", bundle.RemotePrefix(bundle.DefaultRemote)+branch).Run() == nil {
+		t.Error("Expected the fetched tracking ref to be rolled back")
+	}
+
+	// A failing post-apply undoes the integration
+	writeHook(t, hooks, HookPreApply, "exit 0\n")
+	writeHook(t, hooks, HookPostApply, "echo \"$GITSYNC_OUTCOME\" > '"+stdin+"'\nexit 1\n")
+	outcome, output, _ = runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+	if outcome.State != StateRejected || outcome.Hook != HookPostApply {
+		t.Fatalf("Expected rejected by post-apply, got %s: %s", outcome.State, output)
+	}
+	if data, _ := os.ReadFile(stdin); strings.TrimSpace(string(data)) != string(StateFastForwarded) {
+		t.Errorf("post-apply got outcome %q", data)
+	}
+	if git(t, server, "rev-parse", "HEAD") != before {
+		t.Error("Expected the server branch to be rolled back")
+	}
+	if _, err := os.Stat(filepath.Join(server, "new.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the working tree to be rolled back")
+	}
+
+	writeHook(t, hooks, HookPostApply, "exit 0\n")
+	if outcome, output, _ = runSetup(t, laptop, server, branch, bundle.StrategyMerge); outcome.State != StateFastForwarded {
+		t.Fatalf("Expected fast-forwarded, got %s: %s", outcome.State, output)
+	}
+	if git(t, server, "rev-parse", "HEAD") != pushed {
+		t.Error("Expected the accepted push to be integrated")
+	}
+}
+
+func TestSetupScriptHooksBareRollback(t *testing.T) {
+	laptop, _, branch := setupRepos(t)
+	server := filepath.Join(t.TempDir(), "server")
+	hooks := filepath.Join(server, ".git")
+	git(t, t.TempDir(), "init", "-q", "--bare", hooks)
+	writeHook(t, hooks, HookPostApply, "exit 1\n")
+
+	bundlePath := filepath.Join(t.TempDir(), "push.bundle")
+	git(t, laptop, "bundle", "create", "-q", bundlePath, "--all")
+	script := SetupScript(SetupOptions{
+		BundlePath: bundlePath,
+		RepoPath:   server,
+		Branch:     branch,
+		Strategy:   bundle.StrategyMerge,
+		Bare:       true,
+		Worktrees:  []Worktree{{Branch: branch}},
+	})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	outcome, parseErr := ParseOutcome(string(output))
+	if err == nil || parseErr != nil || outcome.State != StateRejected {
+		t.Fatalf("Expected rejected, got %v, %v: %s", err, parseErr, output)
+	}
+	if refs := git(t, server, "for-each-ref"); refs != "" {
+		t.Errorf("Expected every ref to be rolled back, got %s", refs)
+	}
+	if _, err := os.Stat(filepath.Join(server, branch)); !os.IsNotExist(err) {
+		t.Error("Expected the new worktree to be removed")
+	}
+}
+
+func TestSetupScriptHooksRollBackShallowBoundary(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	git(t, laptop, "checkout", "-q", "-b", "topic")
+	for i := 0; i < 3; i++ {
+		commitFile(t, laptop, "file.txt", fmt.Sprintf("version %d", i))
+	}
+	bundlePath := filepath.Join(t.TempDir(), "shallow.bundle")
+	shallow, err := bundle.NewRepo(laptop).CreateShallow(t.Context(), bundlePath, bundle.ShallowOptions{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeHook(t, filepath.Join(server, ".git"), HookPostApply, "exit 1\n")
+
+	script := SetupScript(SetupOptions{BundlePath: bundlePath, RepoPath: server, Branch: branch, Strategy: bundle.StrategyMerge, Shallow: shallow})
+	output, _ := exec.Command("sh", "-c", script).CombinedOutput()
+	if outcome, err := ParseOutcome(string(output)); err != nil || outcome.State != StateRejected {
+		t.Fatalf("Expected rejected by post-apply, got %v: %s", err, output)
+	}
+	// The boundary recorded for the topic commit goes with the rolled back refs
+	if git(t, server, "rev-parse", "--is-shallow-repository") != "false" {
+		t.Error("Expected the shallow boundary to be rolled back")
+	}
+}
+
+func TestSetupScriptHookNotExecutable(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	commitFile(t, laptop, "new.txt", "new")
+	before := git(t, server, "rev-parse", "HEAD")
+	writeHook(t, filepath.Join(server, ".git"), HookPreApply, "exit 0\n")
+	os.Chmod(filepath.Join(server, ".git", HookDir, HookPreApply), 0644)
+
+	outcome, output, err := runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+	if err == nil || outcome.State != StateRejected || outcome.Hook != HookPreApply {
+		t.Fatalf("Expected rejected by pre-apply, got %s: %s", outcome.State, output)
+	}
+	if len(outcome.HookOutput) != 1 || !strings.Contains(outcome.HookOutput[0], "not executable") {
+		t.Errorf("Expected a clear error, got %q", outcome.HookOutput)
+	}
+	if git(t, server, "rev-parse", "HEAD") != before {
+		t.Error("Expected nothing to be applied")
+	}
+}
+
+func TestSetupScriptIgnoresPushedHooks(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	marker := filepath.Join(t.TempDir(), "ran")
+
+	// A hook committed to the project is just a file in the working tree
+	for _, dir := range []string{HookDir, "." + HookDir} {
+		os.MkdirAll(filepath.Join(laptop, dir), 0755)
+		os.WriteFile(filepath.Join(laptop, dir, HookPostApply), []byte("#!/bin/sh\ntouch '"+marker+"'\n"), 0755)
+		git(t, laptop, "add", dir)
+	}
+	git(t, laptop, "commit", "-q", "-m", "add hooks")
+	for i := 0; i < 2; i++ {
+		if outcome, output, _ := runSetup(t, laptop, server, branch, bundle.StrategyMerge); outcome.State != StateFastForwarded && outcome.State != StateUpToDate {
+			t.Fatalf("Expected the push to apply, got %s: %s", outcome.State, output)
+		}
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected a pushed hook never to run")
+	}
+}
+
+func TestSetupScriptPatchPreApply(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	git(t, laptop, "update-ref", "refs/remotes/origin/"+branch, "HEAD")
+	commitFile(t, laptop, "a.txt", "a")
+	commitFile(t, laptop, "b.txt", "b")
+	want := git(t, laptop, "log", "--reverse", "--format=%H %s", "-2")
+	before := git(t, server, "rev-parse", "HEAD")
+
+	patchPath := filepath.Join(t.TempDir(), "push"+bundle.PatchExt)
+	if _, err := bundle.NewRepo(laptop).CreatePatches(t.Context(), patchPath, branch, bundle.DefaultRemote); err != nil {
+		t.Fatal(err)
+	}
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	writeHook(t, filepath.Join(server, ".git"), HookPreApply, "echo \"$GITSYNC_FORMAT\" > '"+stdin+"'\ncat >> '"+stdin+"'\nexit 1\n")
+
+	script := SetupScript(SetupOptions{BundlePath: patchPath, RepoPath: server, Branch: branch, Patch: true})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	outcome, parseErr := ParseOutcome(string(output))
+	if err == nil || parseErr != nil || outcome.State != StateRejected {
+		t.Fatalf("Expected rejected, got %v, %v: %s", err, parseErr, output)
+	}
+	if data, _ := os.ReadFile(stdin); string(data) != "patch\n"+want+"\n" {
+		t.Errorf("pre-apply got %q, expected the patches %q", data, want)
+	}
+	if git(t, server, "rev-parse", "HEAD") != before {
+		t.Error("Expected no patch to be applied before pre-apply accepted them")
+	}
+}
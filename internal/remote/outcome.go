@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Line prefixes the setup script uses to report its result.
+const (
+	OutcomePrefix  = "GITSYNC_OUTCOME:"
+	ConflictPrefix = "GITSYNC_CONFLICT:"
+	DirtyPrefix    = "GITSYNC_DIRTY:"
+	WIPPrefix      = "GITSYNC_WIP:"
+	PatchesPrefix  = "GITSYNC_PATCHES:"
+)
+
+// State is what the setup script did to the server repository.
+type State string
+
+// States reported by the setup script.
+const (
+	StateCloned           State = "cloned"
+	StateUpToDate         State = "up-to-date"
+	StateFastForwarded    State = "fast-forwarded"
+	StateMerged           State = "merged"
+	StateRebased          State = "rebased"
+	StateFetched          State = "fetched"
+	StateConflicted       State = "conflicted"
+	StateDirtyTreeBlocked State = "dirty-tree-blocked"
+	StateDiverged         State = "diverged"
+	StatePatched          State = "patched"
+	StatePatchFailed      State = "patch-failed"
+	// StateReceived means a bare repository received the bundle but the worktree of the
+	// branch was left alone because it has uncommitted changes, listed in Dirty.
+	StateReceived State = "received"
+	// StateWrongBranch means a patch series was not applied because the server
+	// repository has another branch checked out.
+	StateWrongBranch State = "wrong-branch"
+	// StateRejected means a server hook rejected the push, see HookDir. The server
+	// repository was rolled back.
+	StateRejected State = "rejected"
+)
+
+// ErrNoOutcome is returned by ParseOutcome when the script stopped before reporting a result.
+var ErrNoOutcome = errors.New("remote script did not report an outcome")
+
+// Outcome is the parsed result of a setup script run.
+type Outcome struct {
+	State     State
+	Conflicts []string
+	Dirty     []string
+	// WIP is WIPApplied or WIPStored when the bundle carried work in progress.
+	WIP string
+	// Patches is how many patches of a patch series applied. When the series failed,
+	// these are the ones before the failing patch, which were rolled back.
+	Patches int
+	// Worktrees lists the other worktrees of a bare repository that were created,
+	// updated, or left alone because they are dirty or diverged.
+	Worktrees []Worktree
+	// Hook is the server hook that rejected the push and HookOutput what it printed.
+	Hook       string
+	HookOutput []string
+}
+
+// Failed reports whether the bundle was left unapplied on the server.
+func (o *Outcome) Failed() bool {
+	switch o.State {
+	case StateConflicted, StateDirtyTreeBlocked, StateDiverged, StatePatchFailed, StateWrongBranch, StateRejected:
+		return true
+	}
+	return false
+}
+
+// ParseOutcome extracts the outcome reported in the output of a setup script.
+func ParseOutcome(output string) (*Outcome, error) {
+	outcome := &Outcome{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, OutcomePrefix):
+			outcome.State = State(strings.TrimPrefix(line, OutcomePrefix))
+		case strings.HasPrefix(line, ConflictPrefix):
+			outcome.Conflicts = append(outcome.Conflicts, strings.TrimPrefix(line, ConflictPrefix))
+		case strings.HasPrefix(line, DirtyPrefix):
+			outcome.Dirty = append(outcome.Dirty, strings.TrimPrefix(line, DirtyPrefix))
+		case strings.HasPrefix(line, WIPPrefix):
+			outcome.WIP = strings.TrimPrefix(line, WIPPrefix)
+		case strings.HasPrefix(line, PatchesPrefix):
+			outcome.Patches, _ = strconv.Atoi(strings.TrimPrefix(line, PatchesPrefix))
+		case strings.HasPrefix(line, HookPrefix):
+			outcome.Hook = strings.TrimPrefix(line, HookPrefix)
+		case strings.HasPrefix(line, HookOutputPrefix):
+			outcome.HookOutput = append(outcome.HookOutput, strings.TrimPrefix(line, HookOutputPrefix))
+		case strings.HasPrefix(line, WorktreePrefix):
+			if wt, ok := parseWorktree(line); ok {
+				outcome.Worktrees = append(outcome.Worktrees, wt)
+			}
+		}
+	}
+
+	if outcome.State == "" {
+		return nil, ErrNoOutcome
+	}
+	return outcome, nil
+}
@@ -0,0 +1,296 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+// PullOptions describes the bundle the server should create for a pull.
+type PullOptions struct {
+	RepoPath   string
+	Branch     string
+	BundlePath string
+	// Haves are the commits at the tips of the local refs. Everything reachable from
+	// those the server has is left out of the bundle.
+	Haves []string
+	// WIP carries the server's uncommitted changes as bundle.WIPRef, with untracked
+	// files if WIPUntracked is set.
+	WIP          bool
+	WIPUntracked bool
+	SigningKey   string
+	VolumeSize   int64
+	// Recipients are the age recipients the bundle and its submodule bundles are
+	// encrypted to on the server, as lines of a recipients file. Without any they are
+	// left in plaintext.
+	Recipients []string
+}
+
+// PullScript returns a POSIX shell script that bundles the server's branches and tags at
+// BundlePath for a pull, along with its signature, volumes, submodule bundles and LFS
+// archive. It reports what it created as "KEY:value" lines, BUNDLE_CREATED once the
+// main bundle exists, or BUNDLE_ERROR with the reason when it could not be created. With recipients the bundle is sent as BundlePath+bundle.EncryptedExt,
+// reported by BUNDLE_ENCRYPTED, as are its submodule bundles and LFS archive, and
+// BUNDLE_SHA256 is the hash of the encrypted file. The
+// size and hash of the transferred bundle are also written to its manifest sidecar.
+func PullScript(opts PullOptions) string {
+	wipScript := ""
+	if opts.WIP {
+		wipScript = WIPScript(opts.WIPUntracked)
+	}
+	return fmt.Sprintf(`
+		cd "%s" || exit 1
+		%s
+
+		# Check for uncommitted changes
+		if [ "$(git rev-parse --is-inside-work-tree)" = true ] && ! git diff --quiet HEAD 2>/dev/null; then
+			echo "UNCOMMITTED_CHANGES"
+		fi
+
+		# Carry uncommitted changes as work in progress when asked to, never a stale one
+		WIP_REF="%s"
+		git update-ref -d "$WIP_REF" 2>/dev/null
+		%s
+
+		# Leave out the commits the laptop already has; without a common base the bundle
+		# carries the complete history
+		HAVES="%s"
+		NOT=""
+		BASE_OIDS=""
+		BASES=0
+		for OID in $HAVES; do
+			if git cat-file -e "$OID^{commit}" 2>/dev/null; then
+				NOT="$NOT ^$OID"
+				BASE_OIDS="$BASE_OIDS $OID"
+				BASES=$((BASES + 1))
+			fi
+		done
+		TIPS=$(git for-each-ref --format='%%(objectname)' refs/heads refs/tags "$WIP_REF")
+
+		# Create bundle with all refs. A failed step never leaves a truncated bundle behind.
+		BUNDLE="%s"
+		bundle_failed() {
+			rm -f "$BUNDLE"
+			git update-ref -d "$WIP_REF" 2>/dev/null
+			echo "BUNDLE_ERROR:$1"
+			exit 1
+		}
+		if [ -n "$NOT" ] || [ -n "$(git config --get extensions.partialClone)" ]; then
+			# git bundle create would leave out refs the laptop already has, refuse to
+			# create a bundle without new commits and try to fetch the objects a partial
+			# clone lacks, so write the bundle header and pack only what is needed
+			if [ "$(git rev-parse --show-object-format)" = sha1 ]; then
+				echo "# v2 git bundle" > "$BUNDLE"
+			else
+				printf '# v3 git bundle\n@object-format=%%s\n' "$(git rev-parse --show-object-format)" > "$BUNDLE"
+			fi
+			BOUNDARY=$(git rev-list --boundary $TIPS $NOT) || bundle_failed "git rev-list failed to list the commits to bundle"
+			echo "$BOUNDARY" | grep '^-' >> "$BUNDLE" || true
+			REFS=$(git for-each-ref --format='%%(objectname) %%(refname)' refs/heads refs/tags "$WIP_REF") ||
+				bundle_failed "git for-each-ref failed to list the refs to bundle"
+			echo "$REFS" >> "$BUNDLE"
+			echo >> "$BUNDLE"
+			printf '%%s\n' $TIPS $NOT | git pack-objects -q --stdout --revs --missing=allow-promisor >> "$BUNDLE" ||
+				bundle_failed "git pack-objects failed to pack the commits to bundle"
+			COMMITS=$(git rev-list --count $TIPS $NOT) || bundle_failed "git rev-list failed to count the bundled commits"
+		else
+			git bundle create "$BUNDLE" --all || bundle_failed "git bundle create failed"
+			COMMITS=$(git rev-list --count --all) || bundle_failed "git rev-list failed to count the bundled commits"
+		fi
+		git update-ref -d "$WIP_REF" 2>/dev/null
+
+		echo "BUNDLE_CREATED"
+		echo "BUNDLE_BASES:$BASES"
+		echo "COMMIT_COUNT:$COMMITS"
+
+		# Never leave a readable bundle in the bundle directory: encrypt file $1 to the
+		# recipients as $1%s and remove the plaintext. Sets PROTECTED to the file to send.
+		RECIPIENTS="%s"
+		protect_file() {
+			PROTECTED="$1"
+			[ -n "$RECIPIENTS" ] || return 0
+			if ! command -v age >/dev/null 2>&1; then
+				rm -f "$1"
+				echo "❌ age is not installed on the server, cannot encrypt $(basename "$1")" >&2
+				exit 1
+			fi
+			RECIPIENTS_FILE=$(mktemp)
+			echo "$RECIPIENTS" > "$RECIPIENTS_FILE"
+			if ! age -e -R "$RECIPIENTS_FILE" -o "$1%s" "$1"; then
+				rm -f "$RECIPIENTS_FILE" "$1" "$1%s"
+				echo "❌ Failed to encrypt $(basename "$1")" >&2
+				exit 1
+			fi
+			rm -f "$RECIPIENTS_FILE" "$1"
+			PROTECTED="$1%s"
+		}
+		protect_file "$BUNDLE"
+		OUT="$PROTECTED"
+		ENCRYPTED=false
+		if [ "$OUT" != "$BUNDLE" ]; then
+			ENCRYPTED=true
+			echo "BUNDLE_ENCRYPTED"
+		fi
+		SUM=$(sha256sum "$OUT" | cut -d' ' -f1)
+		SIZE=$(wc -c < "$OUT" | tr -d ' ')
+		echo "BUNDLE_SHA256:$SUM"
+
+		# Sign the bundle so the laptop can verify where it came from
+		SIGNING_KEY="%s"
+		case "$SIGNING_KEY" in
+		"~/"*) SIGNING_KEY="$HOME/${SIGNING_KEY#\~/}" ;;
+		esac
+		# A bundle that should be signed is never sent without its signature
+		sign_file() {
+			[ -n "$SIGNING_KEY" ] || return 0
+			if ! ssh-keygen -Y sign -f "$SIGNING_KEY" -n gitsynq "$1" >/dev/null; then
+				echo "❌ Failed to sign $(basename "$1") with $SIGNING_KEY" >&2
+				exit 1
+			fi
+		}
+		SIGNED=false
+		if [ -n "$SIGNING_KEY" ]; then
+			sign_file "$OUT"
+			SIGNED=true
+			echo "BUNDLE_SIGNED"
+		fi
+
+		# Split into fixed-size volumes for size-limited transfers. dd works on BSD and
+		# busybox servers too, which lack the numeric suffixes of GNU split.
+		VOLUME_SIZE="%d"
+		VOLUME_BLOCK="%d"
+		VOLUMES=0
+		if [ "$VOLUME_SIZE" -gt 0 ]; then
+			BLOCKS=$((VOLUME_SIZE / VOLUME_BLOCK))
+			N=1
+			while :; do
+				PART="$OUT.$(printf '%%03d' "$N")"
+				dd if="$OUT" of="$PART" bs="$VOLUME_BLOCK" skip=$(( (N - 1) * BLOCKS )) count="$BLOCKS" 2>/dev/null
+				if [ ! -s "$PART" ]; then
+					rm -f "$PART"
+					break
+				fi
+				echo "VOLUME:$(basename "$PART"):$(wc -c < "$PART"):$(sha256sum "$PART" | cut -d' ' -f1)"
+				N=$((N + 1))
+			done
+			VOLUMES=$((N - 1))
+			rm -f "$OUT"
+		fi
+
+		# Describe the bundle as it is transferred, for the laptop to check its download
+		printf '{\n  "direction": "%s",\n  "commit_count": %%s,\n  "created_at": "%%s",\n  "size": %%s,\n  "sha256": "%%s",\n  "encrypted": %%s,\n  "signed": %%s,\n  "volumes": %%s\n}\n' \
+			"$COMMITS" "$(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ)" "$SIZE" "$SUM" "$ENCRYPTED" "$SIGNED" "$VOLUMES" > "$BUNDLE%s"
+
+		# Write a bundle at $1 of the current repository with the gitlinks $2, newest
+		# first, under refs/gitlinks/* and the newest as HEAD, requiring the commits $3
+		gitlink_bundle() {
+			if [ "$(git rev-parse --show-object-format)" = sha1 ]; then
+				echo "# v2 git bundle" > "$1"
+			else
+				printf '# v3 git bundle\n@object-format=%%s\n' "$(git rev-parse --show-object-format)" > "$1"
+			fi
+			for OID in $3; do echo "-$OID" >> "$1"; done
+			echo "$(echo "$2" | head -n 1) HEAD" >> "$1"
+			echo "$2" | awk '{ print $1 " refs/gitlinks/" NR }' >> "$1"
+			echo >> "$1"
+			{ echo "$2"; for OID in $3; do echo "^$OID"; done; } | git pack-objects -q --stdout --revs --thin >> "$1"
+		}
+
+		# Bundle checked-out submodules next to the main bundle, parents first. Only the
+		# commits the gitlinks of the bundled range need are sent, without the history of
+		# the gitlinks at the laptop's commits; submodules whose gitlink did not change are
+		# skipped. Without a base, or for a new submodule, the whole history is sent.
+		# RANGES holds "path|tips|bases" of every bundled repository, bases "-" for full.
+		RANGES="$BUNDLE.ranges"
+		if [ -n "$BASE_OIDS" ]; then
+			echo ".|$(echo $TIPS)|$(echo $BASE_OIDS)" > "$RANGES"
+		else
+			echo ".|-|-" > "$RANGES"
+		fi
+		N=0
+		git submodule foreach --quiet --recursive 'echo "$displaypath|$name|$sm_path"' | while IFS='|' read -r SUB_FULL SUB_NAME SUB_PATH; do
+			SUB_PARENT=""
+			[ "$SUB_FULL" = "$SUB_PATH" ] || SUB_PARENT="${SUB_FULL%%%%/$SUB_PATH}"
+			RANGE=$(awk -F'|' -v dir="${SUB_PARENT:-.}" '$1 == dir { print $2 "|" $3 }' "$RANGES")
+			[ -n "$RANGE" ] || continue
+			P_TIPS="${RANGE%%%%|*}"
+			P_BASES="${RANGE#*|}"
+
+			SUB_TIPS=""
+			SUB_BASES=""
+			if [ "$P_BASES" != "-" ]; then
+				SUB_TIPS=$(cd "${SUB_PARENT:-.}" && git rev-list $P_TIPS $(printf '^%%s ' $P_BASES) -- "$SUB_PATH" |
+					while read -r C; do git rev-parse -q --verify "$C:$SUB_PATH" || true; done | awk '!seen[$0]++' |
+					while read -r OID; do (cd "$SUB_PATH" && git cat-file -e "$OID^{commit}" 2>/dev/null) && echo "$OID"; done)
+				[ -n "$SUB_TIPS" ] || continue
+				SUB_BASES=$(cd "${SUB_PARENT:-.}" && for B in $P_BASES; do git rev-parse -q --verify "$B:$SUB_PATH" || true; done | sort -u |
+					while read -r OID; do (cd "$SUB_PATH" && git cat-file -e "$OID^{commit}" 2>/dev/null) && echo "$OID"; done)
+			fi
+
+			N=$((N + 1))
+			SUB_FILE="$(basename "$BUNDLE").sub$(printf '%%03d' "$N")"
+			SUB_OUT="$(cd "$(dirname "$BUNDLE")" && pwd)/$SUB_FILE"
+			if [ -z "$SUB_BASES" ]; then
+				(cd "$SUB_FULL" && git bundle create -q "$SUB_OUT" --all) || exit 1
+				echo "$SUB_FULL|-|-" >> "$RANGES"
+			else
+				(cd "$SUB_FULL" && gitlink_bundle "$SUB_OUT" "$SUB_TIPS" "$SUB_BASES") || exit 1
+				echo "$SUB_FULL|$(echo $SUB_TIPS)|$(echo $SUB_BASES)" >> "$RANGES"
+			fi
+			protect_file "$SUB_OUT"
+			SUB_FILE=$(basename "$PROTECTED")
+			sign_file "$PROTECTED"
+			echo "SUBMODULE:$SUB_PARENT|$SUB_NAME|$SUB_PATH|$SUB_FILE"
+		done || { rm -f "$RANGES"; exit 1; }
+		rm -f "$RANGES"
+
+		# Archive the LFS objects referenced by the bundled commits
+		LFS_DIR="$(git rev-parse --git-common-dir)/lfs/objects"
+		if [ -d "$LFS_DIR" ]; then
+			git rev-list --objects --all $NOT | cut -d' ' -f1 \
+				| git cat-file --batch-check='%%(objecttype) %%(objectname) %%(objectsize)' \
+				| awk '$1 == "blob" && $3 <= 1024 { print $2 }' \
+				| git cat-file --batch \
+				| sed -n 's/^oid sha256:\([0-9a-f]\{64\}\)$/\1/p' | sort -u \
+				| while read -r OID; do
+					OBJ="$(echo "$OID" | cut -c1-2)/$(echo "$OID" | cut -c3-4)/$OID"
+					if [ -f "$LFS_DIR/$OBJ" ]; then echo "$OBJ"; fi
+				done > "$BUNDLE.lfs.list"
+			if [ -s "$BUNDLE.lfs.list" ]; then
+				# Only the options every tar has: gather the objects in a staging directory
+				# and archive it from the inside
+				ARCHIVE="$(cd "$(dirname "$BUNDLE")" && pwd)/$(basename "$BUNDLE")%s"
+				STAGE="$LFS_DIR/.gitsync-outgoing.$$"
+				rm -rf "$STAGE"
+				while read -r OBJ; do
+					mkdir -p "$STAGE/$(dirname "$OBJ")"
+					ln "$LFS_DIR/$OBJ" "$STAGE/$OBJ" 2>/dev/null || cp "$LFS_DIR/$OBJ" "$STAGE/$OBJ"
+				done < "$BUNDLE.lfs.list"
+				if ! (cd "$STAGE" && tar -cf "$ARCHIVE" *); then
+					rm -rf "$STAGE" "$ARCHIVE" "$BUNDLE.lfs.list"
+					echo "❌ Failed to archive LFS objects" >&2
+					exit 1
+				fi
+				rm -rf "$STAGE"
+				protect_file "$ARCHIVE"
+				sign_file "$PROTECTED"
+				echo "LFS_OBJECTS:$(wc -l < "$BUNDLE.lfs.list")"
+			fi
+			rm -f "$BUNDLE.lfs.list"
+		fi
+		`, opts.RepoPath, EnterWorktreeScript(opts.Branch), bundle.WIPRef, wipScript, strings.Join(opts.Haves, " "), opts.BundlePath,
+		bundle.EncryptedExt, strings.Join(opts.Recipients, "\n"), bundle.EncryptedExt, bundle.EncryptedExt, bundle.EncryptedExt,
+		opts.SigningKey, opts.VolumeSize, volumeBlock(opts.VolumeSize), bundle.DirectionPull, bundle.ManifestExt, bundle.LFSExt)
+}
+
+// volumeBlock returns the largest block size up to 1 MiB that size is a multiple of, so
+// dd copies volumes of exactly size bytes without reading them a byte at a time.
+func volumeBlock(size int64) int64 {
+	for block := int64(1 << 20); block > 1; block /= 2 {
+		if size%block == 0 {
+			return block
+		}
+	}
+	return 1
+}
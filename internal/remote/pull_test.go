@@ -0,0 +1,298 @@
+package remote
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+// runPull creates a pull bundle of server for a laptop with haves and returns its path
+// and the script output.
+func runPull(t *testing.T, server string, haves []string) (string, string) {
+	t.Helper()
+	bundlePath := filepath.Join(t.TempDir(), "pull.bundle")
+	script := PullScript(PullOptions{RepoPath: server, BundlePath: bundlePath, Haves: haves})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil || !strings.Contains(string(output), "BUNDLE_CREATED") {
+		t.Fatalf("Pull script failed: %v: %s", err, output)
+	}
+	return bundlePath, string(output)
+}
+
+// prerequisites returns the commits a bundle requires, from its header.
+func prerequisites(t *testing.T, bundlePath string) []string {
+	t.Helper()
+	header, err := exec.Command("sed", "/^$/q", bundlePath).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var oids []string
+	for _, line := range strings.Split(string(header), "\n") {
+		if oid, ok := strings.CutPrefix(line, "-"); ok {
+			oids = append(oids, strings.Fields(oid)[0])
+		}
+	}
+	return oids
+}
+
+func TestPullScriptIncremental(t *testing.T) {
+	laptop, server, _ := setupRepos(t)
+	have := git(t, laptop, "rev-parse", "HEAD")
+	commitFile(t, server, "a.txt", "a")
+	commitFile(t, server, "b.txt", "b")
+
+	// Local commits the server does not have are ignored
+	bundlePath, output := runPull(t, server, []string{have, "0123456789012345678901234567890123456789"})
+	if !strings.Contains(output, "BUNDLE_BASES:1") || !strings.Contains(output, "COMMIT_COUNT:2") {
+		t.Errorf("Expected 2 new commits on 1 base: %s", output)
+	}
+	if got := prerequisites(t, bundlePath); len(got) != 1 || got[0] != have {
+		t.Errorf("Expected the bundle to require only %s, got %v", have, got)
+	}
+	git(t, laptop, "bundle", "verify", "-q", bundlePath)
+	git(t, laptop, "fetch", "-q", bundlePath, "refs/heads/*:refs/remotes/pulled/*")
+}
+
+func TestPullScriptUnknownHave(t *testing.T) {
+	_, server, _ := setupRepos(t)
+	commitFile(t, server, "a.txt", "a")
+
+	bundlePath, output := runPull(t, server, []string{"0123456789012345678901234567890123456789"})
+	if !strings.Contains(output, "BUNDLE_BASES:0") || !strings.Contains(output, "COMMIT_COUNT:2") {
+		t.Errorf("Expected the complete history without a base: %s", output)
+	}
+	if got := prerequisites(t, bundlePath); len(got) != 0 {
+		t.Errorf("Expected a complete bundle, got prerequisites %v", got)
+	}
+
+	empty := t.TempDir()
+	git(t, empty, "init", "-q")
+	git(t, empty, "bundle", "verify", "-q", bundlePath)
+}
+
+func TestPullScriptVolumes(t *testing.T) {
+	_, server, _ := setupRepos(t)
+	noise := make([]byte, 4096)
+	rand.Read(noise)
+	commitFile(t, server, "noise.bin", string(noise))
+
+	bundlePath := filepath.Join(t.TempDir(), "pull.bundle")
+	script := PullScript(PullOptions{RepoPath: server, BundlePath: bundlePath, VolumeSize: 1536})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Pull script failed: %v: %s", err, output)
+	}
+
+	var joined []byte
+	volumes := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(strings.TrimPrefix(line, "VOLUME:"), ":")
+		if !strings.HasPrefix(line, "VOLUME:") || len(fields) != 3 {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(bundlePath), fields[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := strings.TrimSpace(fields[1]); size != strconv.Itoa(len(data)) || len(data) > 1536 {
+			t.Errorf("Volume %s has %d bytes, reported %s", fields[0], len(data), size)
+		}
+		volumes++
+		joined = append(joined, data...)
+	}
+	if volumes < 2 {
+		t.Fatalf("Expected several volumes: %s", output)
+	}
+	if sum := fmt.Sprintf("%x", sha256.Sum256(joined)); !strings.Contains(string(output), "BUNDLE_SHA256:"+sum) {
+		t.Error("The volumes do not add up to the bundle")
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Error("Expected the unsplit bundle to be removed")
+	}
+	if manifest, err := bundle.LoadManifest(bundlePath); err != nil || manifest.Volumes != volumes || manifest.Size != int64(len(joined)) {
+		t.Errorf("Expected the manifest to describe %d volumes of %d bytes, got %+v (%v)", volumes, len(joined), manifest, err)
+	}
+}
+
+func TestPullScriptCountsBundledCommits(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	have := git(t, laptop, "rev-parse", "HEAD")
+	commitFile(t, server, "a.txt", "a")
+
+	// Commits only remote-tracking refs and the stash reach are not bundled
+	git(t, server, "checkout", "-q", "-b", "elsewhere")
+	commitFile(t, server, "b.txt", "b")
+	git(t, server, "update-ref", "refs/remotes/origin/elsewhere", "HEAD")
+	git(t, server, "checkout", "-q", branch)
+	git(t, server, "branch", "-D", "elsewhere")
+	os.WriteFile(filepath.Join(server, "a.txt"), []byte("stashed"), 0644)
+	git(t, server, "stash", "-q")
+
+	if _, output := runPull(t, server, []string{have}); !strings.Contains(output, "COMMIT_COUNT:1\n") {
+		t.Errorf("Expected the 1 bundled commit to be counted: %s", output)
+	}
+}
+
+func TestPullScriptBundleFailure(t *testing.T) {
+	laptop, server, _ := setupRepos(t)
+	have := git(t, laptop, "rev-parse", "HEAD")
+	commitFile(t, server, "a.txt", "a")
+
+	// A missing object makes git pack-objects fail
+	blob := git(t, server, "rev-parse", "HEAD:a.txt")
+	if err := os.Remove(filepath.Join(server, ".git", "objects", blob[:2], blob[2:])); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "pull.bundle")
+	script := PullScript(PullOptions{RepoPath: server, BundlePath: bundlePath, Haves: []string{have}})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err == nil || strings.Contains(string(output), "BUNDLE_CREATED") || !strings.Contains(string(output), "BUNDLE_ERROR:git pack-objects failed") {
+		t.Errorf("Expected the failed bundle to be reported: %v: %s", err, output)
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Error("Expected the truncated bundle to be removed")
+	}
+}
+
+func TestPullScriptSignFailureIsFatal(t *testing.T) {
+	_, server, _ := setupRepos(t)
+	bundlePath := filepath.Join(t.TempDir(), "pull.bundle")
+	script := PullScript(PullOptions{RepoPath: server, BundlePath: bundlePath, SigningKey: filepath.Join(t.TempDir(), "missing")})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err == nil || strings.Contains(string(output), "BUNDLE_SIGNED") {
+		t.Errorf("Expected a failed signature to fail the pull: %s", output)
+	}
+}
+
+func TestPullScriptEncrypts(t *testing.T) {
+	fakeAge(t)
+	_, server, _ := setupRepos(t)
+	commitFile(t, server, "a.txt", "a")
+
+	bundlePath := filepath.Join(t.TempDir(), "pull.bundle")
+	script := PullScript(PullOptions{RepoPath: server, BundlePath: bundlePath, Recipients: []string{"age1example", "ssh-ed25519 AAAA"}})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil || !strings.Contains(string(output), "BUNDLE_ENCRYPTED") {
+		t.Fatalf("Expected an encrypted bundle: %v: %s", err, output)
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Error("Expected no plaintext bundle to be left on the server")
+	}
+
+	// The checksum and the manifest are of what is transferred
+	data, err := os.ReadFile(bundlePath + bundle.EncryptedExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("BUNDLE_SHA256:%x", sha256.Sum256(data)); !strings.Contains(string(output), want) {
+		t.Errorf("Expected %s: %s", want, output)
+	}
+	manifest, err := bundle.LoadManifest(bundlePath)
+	if err != nil {
+		t.Fatalf("Expected a manifest next to the bundle: %v", err)
+	}
+	if err := manifest.Verify(bundlePath + bundle.EncryptedExt); err != nil {
+		t.Error(err)
+	}
+	if manifest.Direction != bundle.DirectionPull || !manifest.Encrypted || manifest.Signed || manifest.CommitCount != 2 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+}
+
+func TestPullScriptEncryptsLFSArchive(t *testing.T) {
+	fakeAge(t)
+	_, server, _ := setupRepos(t)
+	content := "large binary content"
+	oid := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	lfsDir := filepath.Join(server, ".git", "lfs", "objects")
+	objPath := filepath.Join(oid[0:2], oid[2:4], oid)
+	os.MkdirAll(filepath.Dir(filepath.Join(lfsDir, objPath)), 0755)
+	os.WriteFile(filepath.Join(lfsDir, objPath), []byte(content), 0644)
+	commitFile(t, server, "model.bin", fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content)))
+
+	bundlePath := filepath.Join(t.TempDir(), "pull.bundle")
+	script := PullScript(PullOptions{RepoPath: server, BundlePath: bundlePath, Recipients: []string{"age1example"}})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil || !strings.Contains(string(output), "LFS_OBJECTS:1") {
+		t.Fatalf("Expected one LFS object: %v: %s", err, output)
+	}
+	if _, err := os.Stat(bundlePath + bundle.LFSExt); !os.IsNotExist(err) {
+		t.Error("Expected no plaintext LFS archive to be left on the server")
+	}
+	if staged, _ := filepath.Glob(filepath.Join(lfsDir, ".gitsync-outgoing*")); len(staged) > 0 {
+		t.Errorf("Staging directory was left behind: %v", staged)
+	}
+
+	// The decrypted archive installs into another repository
+	data, err := os.ReadFile(bundlePath + bundle.LFSExt + bundle.EncryptedExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, archive, _ := strings.Cut(string(data), "\n")
+	plain := filepath.Join(t.TempDir(), "objects.tar")
+	os.WriteFile(plain, []byte(archive), 0644)
+	laptop := t.TempDir()
+	git(t, laptop, "init", "-q")
+	if n, err := bundle.NewRepo(laptop).InstallLFS(t.Context(), plain); err != nil || n != 1 {
+		t.Fatalf("Expected the object to install, got %d: %v", n, err)
+	}
+}
+
+func TestPullScriptIncrementalSubmodules(t *testing.T) {
+	laptop, server, _ := setupRepos(t)
+	lib := t.TempDir()
+	git(t, lib, "init", "-q")
+	git(t, lib, "config", "user.email", "test@example.com")
+	git(t, lib, "config", "user.name", "Test User")
+	commitFile(t, lib, "lib.txt", "lib")
+	git(t, server, "-c", "protocol.file.allow=always", "submodule", "add", "-q", lib, "lib")
+	git(t, server, "commit", "-q", "-m", "add lib")
+	have := git(t, server, "rev-parse", "HEAD")
+	synced := git(t, server, "rev-parse", "HEAD:lib")
+
+	// Unchanged submodules are not bundled again
+	commitFile(t, server, "a.txt", "a")
+	_, output := runPull(t, server, []string{have})
+	if strings.Contains(output, "SUBMODULE:") {
+		t.Errorf("Expected no submodule bundle for an unchanged gitlink: %s", output)
+	}
+
+	commitFile(t, filepath.Join(server, "lib"), "new.txt", "new")
+	git(t, server, "commit", "-q", "-am", "bump lib")
+	bumped := git(t, server, "rev-parse", "HEAD:lib")
+
+	bundlePath, output := runPull(t, server, []string{have})
+	var subFile string
+	for _, line := range strings.Split(output, "\n") {
+		if rest, ok := strings.CutPrefix(line, "SUBMODULE:"); ok {
+			fields := strings.Split(rest, "|")
+			subFile = filepath.Join(filepath.Dir(bundlePath), fields[len(fields)-1])
+		}
+	}
+	if subFile == "" {
+		t.Fatalf("Expected a submodule bundle: %s", output)
+	}
+	if got := prerequisites(t, subFile); len(got) != 1 || got[0] != synced {
+		t.Errorf("Expected the submodule bundle to require only %s, got %v", synced, got)
+	}
+	heads := git(t, lib, "bundle", "list-heads", subFile)
+	if !strings.Contains(heads, bumped+" HEAD") {
+		t.Errorf("Expected HEAD at %s, got %s", bumped, heads)
+	}
+
+	// A checkout of the synced commit takes the bundle
+	clone := filepath.Join(t.TempDir(), "lib")
+	git(t, laptop, "clone", "-q", lib, clone)
+	git(t, clone, "fetch", "-q", subFile, "+refs/*:refs/gitsync/*", "+HEAD:refs/gitsync/HEAD")
+	if got := git(t, clone, "rev-parse", "refs/gitsync/HEAD"); got != bumped {
+		t.Errorf("Expected to fetch %s, got %s", bumped, got)
+	}
+}
@@ -0,0 +1,742 @@
+// Package remote generates the shell scripts GitSynq runs on the server and parses
+// what they report back.
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+// SetupOptions describes how the server should apply an uploaded bundle.
+type SetupOptions struct {
+	BundlePath     string
+	RepoPath       string
+	Branch         string
+	Identity       string
+	AllowedSigners string
+	Strict         bool
+	Volumes        *bundle.VolumeManifest
+	Strategy       bundle.Strategy
+	// Submodules lists submodule bundles uploaded next to the bundle, see
+	// bundle.CreateSubmoduleBundles.
+	Submodules []bundle.Submodule
+	// LFSArchive is the uploaded Git LFS object archive, see bundle.PackLFS.
+	LFSArchive string
+	// Shallow is the shallow boundary of a bundle made by bundle.CreateShallow. A new
+	// server repository records it in .git/shallow before fetching from the bundle.
+	Shallow []string
+	// Filter is the object filter of a bundle made by bundle.CreateFiltered. The server
+	// stores its pack as a promisor pack, making the repository a partial clone.
+	Filter string
+	// WIP is the work in progress carried by a bundle made by bundle.CreateWIP. The
+	// server keeps it under bundle.ReceivedWIPRef and applies it like bundle.ApplyWIP.
+	WIP string
+	// Patch means BundlePath is a patch series made by bundle.CreatePatches rather than a
+	// bundle. The server applies it to its branch with git am, all patches or none.
+	Patch bool
+	// Bare means the server repository uses LayoutBare. Branch is integrated in its
+	// worktree, and Worktrees are created for branches that have none yet.
+	Bare      bool
+	Worktrees []Worktree
+	// Remote is server.name: pushed branches are fetched into bundle.RemotePrefix(Remote)
+	// before they are integrated, bundle.DefaultRemote when empty.
+	Remote string
+}
+
+// volumeList renders the volumes of a split bundle as "name:sha256" words for the setup script.
+func volumeList(manifest *bundle.VolumeManifest) (string, string) {
+	if manifest == nil {
+		return "", ""
+	}
+	var words []string
+	for _, vol := range manifest.Volumes {
+		words = append(words, vol.Name+":"+vol.SHA256)
+	}
+	return strings.Join(words, " "), manifest.SHA256
+}
+
+// submoduleList renders submodule bundles as "parent|name|path|file" lines for the setup script.
+func submoduleList(subs []bundle.Submodule) string {
+	var lines []string
+	for _, sub := range subs {
+		lines = append(lines, strings.Join([]string{sub.Parent, sub.Name, sub.Path, sub.Bundle}, "|"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SetupScript returns a POSIX shell script that clones or updates the server repository
+// from an uploaded bundle. The script prints its result as OutcomePrefix lines, see
+// ParseOutcome, and exits non-zero if the bundle could not be applied.
+func SetupScript(opts SetupOptions) string {
+	volumes, bundleSum := volumeList(opts.Volumes)
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = bundle.StrategyMerge
+	}
+	remote := opts.Remote
+	if remote == "" {
+		remote = bundle.DefaultRemote
+	}
+	return fmt.Sprintf(`
+		set -e
+
+		BUNDLE_PATH="%s"
+		REPO_PATH="%s"
+		BRANCH="%s"
+		IDENTITY="%s"
+		ALLOWED_SIGNERS="%s"
+		STRICT="%t"
+		VOLUMES="%s"
+		BUNDLE_SHA256="%s"
+		STRATEGY="%s"
+		SUBMODULES="%s"
+		LFS_ARCHIVE="%s"
+		SHALLOW="%s"
+		FILTER="%s"
+		WIP="%s"
+		PATCH="%t"
+		BARE="%t"
+		WORKTREES="%s"
+		TRACKING="%s"
+		NEW_REPO=false
+
+		# The server cannot reach an LFS endpoint; objects come from LFS_ARCHIVE instead
+		export GIT_LFS_SKIP_SMUDGE=1
+
+		expand_home() {
+			case "$1" in
+			"~/"*) echo "$HOME/${1#\~/}" ;;
+			*) echo "$1" ;;
+			esac
+		}
+
+		report() {
+			echo "%s$1"
+		}
+
+		report_wip() {
+			echo "%s$1"
+		}
+
+		# Report the conflicted paths of a failed merge or rebase, then abort it
+		report_conflict() {
+			CONFLICTS=$(git diff --name-only --diff-filter=U)
+			if [ -z "$CONFLICTS" ]; then
+				echo "❌ git $1 of $BRANCH failed" >&2
+				exit 1
+			fi
+			echo "$CONFLICTS" | sed 's/^/%s/'
+			git "$1" --abort || echo "⚠️  git $1 --abort failed, clean up the server repository by hand" >&2
+			report conflicted
+			exit 1
+		}
+
+		# Reassemble split bundles, refusing missing or corrupt volumes
+		if [ -n "$VOLUMES" ]; then
+			echo "🧩 Reassembling bundle from volumes..."
+			VOLUME_DIR=$(dirname "$BUNDLE_PATH")
+			MISSING=""
+			CORRUPT=""
+			for VOLUME in $VOLUMES; do
+				NAME="${VOLUME%%%%:*}"
+				if [ ! -f "$VOLUME_DIR/$NAME" ]; then
+					MISSING="$MISSING $NAME"
+				elif [ "$(sha256sum "$VOLUME_DIR/$NAME" | cut -d' ' -f1)" != "${VOLUME##*:}" ]; then
+					CORRUPT="$CORRUPT $NAME"
+				fi
+			done
+			if [ -n "$MISSING" ]; then
+				echo "❌ Missing bundle volumes:$MISSING" >&2
+				exit 1
+			fi
+			if [ -n "$CORRUPT" ]; then
+				echo "❌ Corrupt bundle volumes:$CORRUPT" >&2
+				exit 1
+			fi
+			: > "$BUNDLE_PATH"
+			for VOLUME in $VOLUMES; do
+				cat "$VOLUME_DIR/${VOLUME%%%%:*}" >> "$BUNDLE_PATH"
+			done
+			if [ "$(sha256sum "$BUNDLE_PATH" | cut -d' ' -f1)" != "$BUNDLE_SHA256" ]; then
+				echo "❌ Reassembled bundle does not match its manifest" >&2
+				exit 1
+			fi
+			for VOLUME in $VOLUMES; do
+				rm -f "$VOLUME_DIR/${VOLUME%%%%:*}"
+			done
+			rm -f "$BUNDLE_PATH.volumes.json"
+		fi
+
+		# Verify the signature of bundle $1 before anything touches the repository
+		ALLOWED_SIGNERS=$(expand_home "$ALLOWED_SIGNERS")
+		verify_bundle() {
+			if [ -f "$1.sig" ] && [ -n "$ALLOWED_SIGNERS" ]; then
+				PRINCIPALS=$(ssh-keygen -Y find-principals -f "$ALLOWED_SIGNERS" -s "$1.sig" 2>/dev/null | head -n 1)
+				if [ -z "$PRINCIPALS" ]; then
+					echo "❌ Bundle signer is not in $ALLOWED_SIGNERS" >&2
+					exit 1
+				fi
+				# An entry may list several principals; verify as each until one matches
+				PRINCIPAL=""
+				while IFS= read -r CANDIDATE; do
+					case "$CANDIDATE" in
+					"" | "!"*) continue ;;
+					esac
+					if ssh-keygen -Y verify -f "$ALLOWED_SIGNERS" -I "$CANDIDATE" -n gitsynq -s "$1.sig" < "$1" >/dev/null 2>&1; then
+						PRINCIPAL="$CANDIDATE"
+						break
+					fi
+				done <<-PRINCIPALS_EOF
+					$(echo "$PRINCIPALS" | tr ',' '\n')
+				PRINCIPALS_EOF
+				if [ -z "$PRINCIPAL" ]; then
+					echo "❌ Bundle signature verification failed: $(basename "$1")" >&2
+					exit 1
+				fi
+				echo "🔏 Signature verified: $PRINCIPAL"
+			elif [ "$STRICT" = "true" ]; then
+				echo "❌ Refusing unsigned or unverifiable bundle (strict mode): $(basename "$1")" >&2
+				exit 1
+			fi
+		}
+
+		# Decrypt age-encrypted bundle $1 into a temporary plaintext copy, setting PLAIN_PATH.
+		# Copies are only readable by the server user and removed on exit by their absolute
+		# path, as the script changes directories.
+		PLAIN_FILES=""
+		trap 'rm -f $PLAIN_FILES' EXIT
+		decrypt_bundle() {
+			PLAIN_PATH="$1"
+			case "$1" in
+			*.age)
+				if ! command -v age >/dev/null 2>&1; then
+					echo "❌ age is not installed on the server, cannot decrypt bundle" >&2
+					exit 1
+				fi
+				IDENTITY=$(expand_home "$IDENTITY")
+				if [ -z "$IDENTITY" ] || [ ! -f "$IDENTITY" ]; then
+					echo "❌ Decryption key not found on server: $IDENTITY" >&2
+					exit 1
+				fi
+				PLAIN_PATH="$(cd "$(dirname "$1")" && pwd)/$(basename "${1%%.age}")"
+				PLAIN_FILES="$PLAIN_FILES $PLAIN_PATH"
+				(umask 077 && age -d -i "$IDENTITY" -o "$PLAIN_PATH" "$1")
+				;;
+			esac
+		}
+
+		verify_bundle "$BUNDLE_PATH"
+		decrypt_bundle "$BUNDLE_PATH"
+		BUNDLE_PATH="$PLAIN_PATH"
+
+		if [ -n "$LFS_ARCHIVE" ]; then
+			verify_bundle "$LFS_ARCHIVE"
+			decrypt_bundle "$LFS_ARCHIVE"
+			LFS_ARCHIVE="$(cd "$(dirname "$PLAIN_PATH")" && pwd)/$(basename "$PLAIN_PATH")"
+		fi
+
+		# Install LFS objects into the repository's store, refusing the whole archive if
+		# any object does not match its oid. Called from the top of the repository.
+		install_lfs() {
+			[ -n "$LFS_ARCHIVE" ] || return 0
+			LFS_DIR="$(git rev-parse --git-common-dir)/lfs/objects"
+			LFS_TMP="$LFS_DIR/.gitsync-incoming"
+			rm -rf "$LFS_TMP"
+			mkdir -p "$LFS_TMP"
+			(cd "$LFS_TMP" && tar -xf "$LFS_ARCHIVE")
+			LFS_OBJECTS=$(cd "$LFS_TMP" && find . -type f)
+			for OBJ in $LFS_OBJECTS; do
+				if [ "$(sha256sum "$LFS_TMP/$OBJ" | cut -d' ' -f1)" != "$(basename "$OBJ")" ]; then
+					rm -rf "$LFS_TMP"
+					echo "❌ Corrupt LFS object: $(basename "$OBJ")" >&2
+					exit 1
+				fi
+			done
+			for OBJ in $LFS_OBJECTS; do
+				mkdir -p "$LFS_DIR/$(dirname "$OBJ")"
+				mv "$LFS_TMP/$OBJ" "$LFS_DIR/$OBJ"
+			done
+			rm -rf "$LFS_TMP"
+			echo "🗃️  Installed $(echo "$LFS_OBJECTS" | wc -l) LFS object(s)"
+		}
+
+		# Replace LFS pointer files with their content when git-lfs is available
+		lfs_checkout() {
+			if command -v git-lfs >/dev/null 2>&1; then
+				git lfs checkout >/dev/null 2>&1 || echo "⚠️  git lfs checkout failed, LFS files may still be pointers" >&2
+			fi
+		}
+
+		# Submodule bundles are listed as "parent|name|path|file" lines
+		BUNDLE_DIR=$(dirname "$BUNDLE_PATH")
+		SUBMODULE_BUNDLES=""
+		while IFS='|' read -r SUB_PARENT SUB_NAME SUB_PATH SUB_FILE; do
+			[ -n "$SUB_FILE" ] || continue
+			verify_bundle "$BUNDLE_DIR/$SUB_FILE"
+			decrypt_bundle "$BUNDLE_DIR/$SUB_FILE"
+			SUBMODULE_BUNDLES="$SUBMODULE_BUNDLES
+$SUB_PARENT|$SUB_NAME|$SUB_PATH|$PLAIN_PATH"
+		done <<-SUBMODULES_EOF
+			$SUBMODULES
+		SUBMODULES_EOF
+
+		# Check out submodules from their bundles; existing checkouts fetch the new commits.
+		# Called from the top of the repository.
+		update_submodules() {
+			while IFS='|' read -r SUB_PARENT SUB_NAME SUB_PATH SUB_BUNDLE; do
+				[ -n "$SUB_BUNDLE" ] || continue
+				(
+					cd "${SUB_PARENT:-.}"
+					git submodule init -- "$SUB_PATH"
+					if [ -e "$SUB_PATH/.git" ]; then
+						git -C "$SUB_PATH" fetch -q "$SUB_BUNDLE" "+refs/*:%s*" "+HEAD:%sHEAD"
+						git submodule update -- "$SUB_PATH"
+					else
+						git config "submodule.$SUB_NAME.url" "$SUB_BUNDLE"
+						git -c protocol.file.allow=always submodule update -- "$SUB_PATH"
+						git submodule sync -- "$SUB_PATH"
+					fi
+				)
+				echo "📦 Submodule updated: ${SUB_PARENT:+$SUB_PARENT/}$SUB_PATH"
+			done <<-SUBMODULES_EOF
+				$SUBMODULE_BUNDLES
+			SUBMODULES_EOF
+		}
+
+		# A filtered bundle lacks objects that git fetch would insist on. Store its pack as
+		# a promisor pack first, turning the repository into a partial clone. Its promisor
+		# remote gitsync-promisor has no URL: the bundle is removed after the push, so the
+		# missing objects cannot be fetched lazily and only arrive with complete bundles.
+		index_filtered() {
+			git config core.repositoryformatversion 1
+			git config extensions.partialClone gitsync-promisor
+			git config remote.gitsync-promisor.promisor true
+			HEADER_SIZE=$(sed '/^$/q' "$BUNDLE_PATH" | wc -c)
+			tail -c +$((HEADER_SIZE + 1)) "$BUNDLE_PATH" | git index-pack --stdin --promisor=gitsync >/dev/null
+			echo "🧩 Partial clone, objects left out by the filter: $FILTER"
+		}
+
+		# A shallow bundle pushed to an existing repository may start at commits whose
+		# parents the repository lacks; record its boundary before fetching from it, then
+		# drop_shallow takes back the commits whose parents turned out to be there.
+		extend_shallow() {
+			[ -n "$SHALLOW" ] || return 0
+			SHALLOW_FILE="$(git rev-parse --git-dir)/shallow"
+			SHALLOW_ADDED=""
+			for OID in $SHALLOW; do
+				if git cat-file -e "$OID^{commit}" 2>/dev/null || grep -qx "$OID" "$SHALLOW_FILE" 2>/dev/null; then
+					continue
+				fi
+				echo "$OID" >> "$SHALLOW_FILE"
+				SHALLOW_ADDED="$SHALLOW_ADDED $OID"
+			done
+		}
+
+		drop_shallow() {
+			[ -n "$SHALLOW_ADDED" ] || return 0
+			SHALLOW_KEPT=""
+			for OID in $SHALLOW_ADDED; do
+				COMPLETE=true
+				for PARENT in $(git cat-file commit "$OID" | sed -n '/^$/q;s/^parent //p'); do
+					git cat-file -e "$PARENT^{commit}" 2>/dev/null || COMPLETE=false
+				done
+				if [ "$COMPLETE" = true ]; then
+					grep -vx "$OID" "$SHALLOW_FILE" > "$SHALLOW_FILE.tmp" || true
+					mv "$SHALLOW_FILE.tmp" "$SHALLOW_FILE"
+				else
+					SHALLOW_KEPT="$SHALLOW_KEPT $OID"
+				fi
+			done
+			[ -s "$SHALLOW_FILE" ] || rm -f "$SHALLOW_FILE"
+			[ -z "$SHALLOW_KEPT" ] || echo "✂️  Shallow boundary extended with the pushed history"
+		}
+
+		# A shallow push whose history does not reach back to the server branch cannot be
+		# integrated with it; take the boundary and the fetched refs back
+		refuse_shallow_gap() {
+			[ -n "$SHALLOW_KEPT" ] || return 0
+			CURRENT=$(git rev-parse -q --verify "refs/heads/$BRANCH" || true)
+			if [ -z "$CURRENT" ] || git merge-base "$CURRENT" "$TARGET" >/dev/null; then
+				return 0
+			fi
+			echo "❌ The shallow history pushed does not reach back to the server's $BRANCH, push with a larger --depth, an earlier --since, or neither" >&2
+			rollback
+			exit 1
+		}
+
+		# Objects of complete bundles fill in what earlier filtered bundles left out, even
+		# when no branch moves. Once nothing is missing the repository is complete again.
+		backfill() {
+			[ -n "$(git config --get extensions.partialClone)" ] || return 0
+			git bundle unbundle "$BUNDLE_PATH" >/dev/null
+			MISSING_OBJECTS=$(git rev-list --objects --all --missing=print | grep -c '^?' || true)
+			if [ "$MISSING_OBJECTS" = 0 ]; then
+				git config --unset extensions.partialClone
+				git config --remove-section remote.gitsync-promisor 2>/dev/null || true
+				echo "🧩 All missing objects backfilled, the repository is complete"
+			else
+				echo "🧩 Partial clone, $MISSING_OBJECTS object(s) still missing"
+			fi
+		}
+
+		# Store pushed work in progress without touching the working tree
+		receive_wip() {
+			git fetch -q --no-recurse-submodules --no-tags "$BUNDLE_PATH" "+%s:%s"
+			echo "🚧 Work in progress stored in %s"
+			echo "   Apply it with: git stash apply --index %s"
+			report_wip stored
+		}
+
+		# Restore pushed work in progress, but only on top of the commit it was captured on
+		# and into a working tree without changes, where it cannot conflict
+		apply_wip() {
+			[ -n "$WIP" ] || return 0
+			git fetch -q --no-recurse-submodules --no-tags "$BUNDLE_PATH" "+%s:%s"
+			if [ "$(git rev-parse -q --verify HEAD)" = "$(git rev-parse "$WIP^1")" ] &&
+				[ -z "$(git status --porcelain --untracked-files=no --ignore-submodules=all)" ] &&
+				git stash apply --index "$WIP" >/dev/null 2>&1; then
+				echo "🚧 Work in progress applied to the working tree"
+				report_wip applied
+			else
+				receive_wip
+			fi
+		}
+
+		# Undo the work in progress applied by an earlier push if it is untouched, so the
+		# branch can move; the laptop still has it. Untracked files it restored are only
+		# removed if their content is unchanged.
+		drop_wip() {
+			OLD_WIP=$(git rev-parse -q --verify "%s" || true)
+			[ -n "$OLD_WIP" ] || return 0
+			[ "$(git rev-parse -q --verify HEAD)" = "$(git rev-parse "$OLD_WIP^1")" ] || return 0
+			git diff --quiet "$OLD_WIP" -- && git diff --quiet --cached "$OLD_WIP^2" -- || return 0
+			WIP_UNTRACKED=""
+			if git rev-parse -q --verify "$OLD_WIP^3" >/dev/null; then
+				WIP_UNTRACKED=$(git ls-tree -r --name-only "$OLD_WIP^3")
+			fi
+			while IFS= read -r FILE; do
+				[ -n "$FILE" ] || continue
+				[ "$(git hash-object -- "$FILE" 2>/dev/null)" = "$(git rev-parse "$OLD_WIP^3:$FILE")" ] || return 0
+			done <<-WIP_EOF
+				$WIP_UNTRACKED
+			WIP_EOF
+			if git diff --quiet HEAD -- && git diff --quiet --cached HEAD -- && [ -z "$WIP_UNTRACKED" ]; then
+				return 0
+			fi
+			git reset -q --hard HEAD
+			while IFS= read -r FILE; do
+				[ -z "$FILE" ] || rm -f "$FILE"
+			done <<-WIP_EOF
+				$WIP_UNTRACKED
+			WIP_EOF
+			echo "🧹 Dropped the unchanged work in progress of the previous push"
+		}
+
+		# Never merge into uncommitted work on the server. A bare repository has received
+		# the bundle already, so its worktree is just left alone.
+		block_dirty() {
+			DIRTY=$(git status --porcelain --untracked-files=no --ignore-submodules=all)
+			if [ -n "$DIRTY" ]; then
+				echo "$DIRTY" | cut -c4- | sed 's/^/%s/'
+				if [ "$BARE" = true ] && [ "$PATCH" != true ]; then
+					echo "📥 Received into $TARGET, the worktree has uncommitted changes and was left alone"
+					run_hook post-apply received
+					if [ -n "$WIP" ]; then
+						receive_wip
+					fi
+					report received
+					exit 0
+				fi
+				echo "❌ Server working tree has uncommitted changes" >&2
+				report dirty-tree-blocked
+				exit 1
+			fi
+		}
+
+		# Apply a patch series with git am. If a patch does not apply, the patches before
+		# it are rolled back too, so the branch gets the whole series or nothing; how many
+		# applied is reported either way.
+		apply_patches() {
+			# git am applies to whatever is checked out, which has to be the pushed branch
+			HEAD_REF=$(git symbolic-ref -q HEAD || true)
+			if [ "$HEAD_REF" != "refs/heads/$BRANCH" ]; then
+				echo "❌ The server repository has ${HEAD_REF:-a detached HEAD} checked out instead of refs/heads/$BRANCH, check out $BRANCH to apply patches" >&2
+				report wrong-branch
+				exit 1
+			fi
+			drop_wip
+			block_dirty
+			# git am commits as the server's user, who may have no identity configured
+			if ! git var GIT_COMMITTER_IDENT >/dev/null 2>&1; then
+				export GIT_COMMITTER_NAME=gitsync GIT_COMMITTER_EMAIL=gitsync@localhost
+			fi
+			# pre-apply sees the original commit and subject of every patch before any is applied
+			INCOMING=$(awk '
+				/^From [0-9a-f]+ / { oid = $2 }
+				/^Subject: / && oid != "" {
+					sub(/^Subject: (\[PATCH[^]]*\] )?/, "")
+					print oid " " $0
+					oid = ""
+				}' "$BUNDLE_PATH")
+			run_hook pre-apply
+			BEFORE=$(git rev-parse HEAD)
+			if git am -q --3way "$BUNDLE_PATH"; then
+				echo "%s$(git rev-list --count "$BEFORE..HEAD")"
+				INCOMING="$BEFORE $(git rev-parse HEAD) refs/heads/$BRANCH"
+				run_hook post-apply patched
+				report patched
+				exit 0
+			fi
+			echo "%s$(git rev-list --count "$BEFORE..HEAD")"
+			git diff --name-only --diff-filter=U | sed 's/^/%s/'
+			git am --abort || echo "⚠️  git am --abort failed, clean up the server repository by hand" >&2
+			report patch-failed
+			exit 1
+		}
+
+		%s
+		%s
+		report_worktree() {
+			echo "%s$1 $2 $3"
+		}
+
+		# Create or fast-forward the branches no worktree has checked out to the bundle's,
+		# so the bare repository has every pushed branch. Diverged ones are left alone.
+		update_branches() {
+			git for-each-ref --format='%%(refname)' "$TRACKING" | while read -r REF; do
+				B="${REF#"$TRACKING"}"
+				[ -z "$(worktree_of "$B")" ] || continue
+				NEW=$(git rev-parse "$REF")
+				OLD=$(git rev-parse -q --verify "refs/heads/$B" || true)
+				if [ -z "$OLD" ]; then
+					git update-ref "refs/heads/$B" "$NEW"
+					echo "🌿 Branch $B created"
+				elif [ "$OLD" != "$NEW" ] && git merge-base --is-ancestor "$OLD" "$NEW"; then
+					git update-ref "refs/heads/$B" "$NEW" "$OLD"
+					echo "🌿 Branch $B fast-forwarded"
+				elif ! git merge-base --is-ancestor "$NEW" "$OLD"; then
+					echo "⚠️  Branch $B has diverged from the bundle and was left alone"
+				fi
+			done
+		}
+
+		# Create the configured worktrees that are missing, for branches that exist and are
+		# not checked out elsewhere. Relative paths are inside the repository directory.
+		add_worktrees() {
+			while IFS='|' read -r WT_BRANCH WT_PATH; do
+				[ -n "$WT_BRANCH" ] || continue
+				WT_PATH=$(expand_home "${WT_PATH:-$WT_BRANCH}")
+				case "$WT_PATH" in
+				/*) ;;
+				*) WT_PATH="$REPO_ROOT/$WT_PATH" ;;
+				esac
+				[ ! -e "$WT_PATH" ] && [ -z "$(worktree_of "$WT_BRANCH")" ] || continue
+				if ! git rev-parse -q --verify "refs/heads/$WT_BRANCH" >/dev/null; then
+					echo "⚠️  No branch $WT_BRANCH to create the worktree $WT_PATH for"
+					continue
+				fi
+				git worktree add -q "$WT_PATH" "$WT_BRANCH"
+				CREATED_WORKTREES="$CREATED_WORKTREES
+$WT_PATH"
+				(cd "$WT_PATH" && lfs_checkout)
+				report_worktree created "$WT_BRANCH" "$WT_PATH"
+			done <<-WORKTREES_EOF
+				$WORKTREES
+			WORKTREES_EOF
+		}
+
+		# Fast-forward the worktrees of other branches the bundle moved, but only those
+		# without uncommitted changes
+		update_worktrees() {
+			git worktree list --porcelain | awk '
+				/^worktree / { path = substr($0, 10) }
+				/^branch refs\/heads\// { print substr($0, 19) "|" path }' |
+			while IFS='|' read -r WT_BRANCH WT_PATH; do
+				[ "$WT_BRANCH" != "$BRANCH" ] || continue
+				NEW=$(git rev-parse -q --verify "$TRACKING$WT_BRANCH") || continue
+				OLD=$(git rev-parse "refs/heads/$WT_BRANCH")
+				if git merge-base --is-ancestor "$NEW" "$OLD"; then
+					continue
+				elif ! git merge-base --is-ancestor "$OLD" "$NEW"; then
+					report_worktree diverged "$WT_BRANCH" "$WT_PATH"
+				elif [ -n "$(git -C "$WT_PATH" status --porcelain --untracked-files=no --ignore-submodules=all)" ]; then
+					report_worktree dirty "$WT_BRANCH" "$WT_PATH"
+				else
+					git -C "$WT_PATH" merge -q --ff-only "$NEW"
+					(cd "$WT_PATH" && lfs_checkout)
+					report_worktree updated "$WT_BRANCH" "$WT_PATH"
+				fi
+			done
+		}
+
+		# Bring the bare repository's branches and worktrees up to date with the bundle,
+		# then change to the worktree of BRANCH to integrate it there like in a checkout.
+		# Without such a worktree the branch can only be fast-forwarded.
+		enter_worktree() {
+			OLD_TIP=$(git rev-parse -q --verify "refs/heads/$BRANCH" || true)
+			update_branches
+			add_worktrees
+			update_worktrees
+			WORKTREE=$(worktree_of "$BRANCH")
+			if [ -n "$WORKTREE" ]; then
+				cd "$WORKTREE"
+				return 0
+			fi
+			TIP=$(git rev-parse "refs/heads/$BRANCH")
+			if [ "$NEW_REPO" = true ]; then
+				OUTCOME=cloned
+			elif ! git merge-base --is-ancestor "$TARGET" "$TIP"; then
+				echo "❌ $BRANCH has diverged and no worktree has it checked out to merge in" >&2
+				report diverged
+				exit 1
+			elif [ "$OLD_TIP" = "$TIP" ]; then
+				OUTCOME=up-to-date
+			else
+				OUTCOME=fast-forwarded
+			fi
+			run_hook post-apply "$OUTCOME"
+			report "$OUTCOME"
+			exit 0
+		}
+
+		if [ "$BARE" = true ] && [ "$PATCH" != true ] && [ ! -d "$REPO_PATH/.git" ]; then
+			echo "📂 Creating bare repository from bundle..."
+			git init -q --bare "$REPO_PATH/.git"
+			cd "$REPO_PATH"
+			if [ -n "$SHALLOW" ]; then
+				printf '%%s\n' $SHALLOW > "$(git rev-parse --git-dir)/shallow"
+			fi
+			NEW_REPO=true
+		fi
+
+		if [ ! -d "$REPO_PATH/.git" ]; then
+			if [ "$PATCH" = true ]; then
+				echo "❌ Patches need an existing repository on the server, push a bundle first" >&2
+				exit 1
+			fi
+			# Fetch into the tracking namespace rather than git clone, which would leave an
+			# origin remote pointing at the bundle removed after the push
+			if [ -n "$SHALLOW" ] || [ -n "$FILTER" ]; then
+				echo "📂 Cloning partial history from bundle..."
+			else
+				echo "📂 Cloning from bundle..."
+			fi
+			git init -q "$REPO_PATH"
+			cd "$REPO_PATH"
+			# The bundle lacks the parents of its oldest commits; record them as the
+			# shallow boundary first, as git clone --depth would
+			if [ -n "$SHALLOW" ]; then
+				printf '%%s\n' $SHALLOW > "$(git rev-parse --git-dir)/shallow"
+			fi
+			if [ -n "$FILTER" ]; then
+				index_filtered
+			fi
+			git fetch -q --no-recurse-submodules "$BUNDLE_PATH" "+refs/heads/*:$TRACKING*"
+			git checkout -q --no-track -b "$BRANCH" "$TRACKING$BRANCH" 2>/dev/null || git checkout -b "$BRANCH"
+			install_lfs
+			lfs_checkout
+			update_submodules
+			apply_wip
+			report cloned
+			exit 0
+		fi
+
+		echo "🔄 Updating existing repository..."
+		cd "$REPO_PATH"
+		REPO_ROOT=$(pwd)
+		if [ "$(git rev-parse --is-bare-repository)" != "$BARE" ]; then
+			echo "❌ The server repository does not match server.layout (bare: $BARE), move it away to recreate it" >&2
+			exit 1
+		fi
+		snapshot_refs
+
+		if [ "$PATCH" = true ]; then
+			if [ "$BARE" = true ]; then
+				WORKTREE=$(worktree_of "$BRANCH")
+				if [ -z "$WORKTREE" ]; then
+					echo "❌ No worktree has $BRANCH checked out to apply the patches in" >&2
+					exit 1
+				fi
+				cd "$WORKTREE"
+			fi
+			apply_patches
+		fi
+
+		extend_shallow
+		if [ -n "$FILTER" ]; then
+			index_filtered
+		else
+			backfill
+		fi
+
+		# Fetch bundle branches into the tracking namespace
+		git fetch --no-recurse-submodules "$BUNDLE_PATH" "+refs/heads/*:$TRACKING*"
+		drop_shallow
+		TARGET="$TRACKING$BRANCH"
+		if ! git rev-parse --verify -q "$TARGET" >/dev/null; then
+			echo "❌ Bundle does not contain branch $BRANCH" >&2
+			exit 1
+		fi
+		refuse_shallow_gap
+		INCOMING=$(incoming_refs "$BUNDLE_PATH")
+		run_hook pre-apply
+		install_lfs
+
+		if [ "$STRATEGY" = "fetch-only" ]; then
+			echo "📥 Fetched into $TARGET"
+			run_hook post-apply fetched
+			if [ -n "$WIP" ]; then
+				receive_wip
+			fi
+			report fetched
+			exit 0
+		fi
+
+		if [ "$BARE" = true ]; then
+			enter_worktree
+		fi
+
+		drop_wip
+		block_dirty
+
+		OURS=$(git rev-parse -q --verify HEAD || true)
+		THEIRS=$(git rev-parse "$TARGET")
+		if [ "$OURS" = "$THEIRS" ] || { [ -n "$OURS" ] && git merge-base --is-ancestor "$THEIRS" "$OURS"; }; then
+			OUTCOME=up-to-date
+		elif [ -z "$OURS" ] || git merge-base --is-ancestor "$OURS" "$THEIRS"; then
+			git merge --ff-only "$TARGET"
+			OUTCOME=fast-forwarded
+		else
+			case "$STRATEGY" in
+			merge)
+				git merge --no-edit "$TARGET" || report_conflict merge
+				OUTCOME=merged
+				;;
+			rebase)
+				git rebase "$TARGET" || report_conflict rebase
+				OUTCOME=rebased
+				;;
+			ff-only)
+				echo "❌ Not a fast-forward: server branch has diverged from $BRANCH" >&2
+				report diverged
+				exit 1
+				;;
+			esac
+		fi
+
+		if [ "$NEW_REPO" = true ]; then
+			OUTCOME=cloned
+		fi
+		lfs_checkout
+		run_hook post-apply "$OUTCOME"
+		update_submodules
+		apply_wip
+		report "$OUTCOME"
+	`, opts.BundlePath, opts.RepoPath, opts.Branch, opts.Identity, opts.AllowedSigners, opts.Strict, volumes, bundleSum, strategy,
+		submoduleList(opts.Submodules), opts.LFSArchive, strings.Join(opts.Shallow, " "), opts.Filter, opts.WIP, opts.Patch, opts.Bare, worktreeList(opts.Worktrees), bundle.RemotePrefix(remote), OutcomePrefix, WIPPrefix, ConflictPrefix, bundle.SubmoduleRefPrefix, bundle.SubmoduleRefPrefix,
+		bundle.WIPRef, bundle.ReceivedWIPRef, bundle.ReceivedWIPRef, bundle.ReceivedWIPRef, bundle.WIPRef, bundle.ReceivedWIPRef, bundle.ReceivedWIPRef,
+		DirtyPrefix, PatchesPrefix, PatchesPrefix, ConflictPrefix,
+		hookFunctions(), worktreeOf, WorktreePrefix)
+}
@@ -0,0 +1,861 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func commitFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "-q", "-m", "update "+name)
+}
+
+// setupRepos returns a laptop repository and a server clone of it, both at the same commit.
+func setupRepos(t *testing.T) (laptop, server, branch string) {
+	laptop = t.TempDir()
+	git(t, laptop, "init", "-q")
+	git(t, laptop, "config", "user.email", "test@example.com")
+	git(t, laptop, "config", "user.name", "Test User")
+	commitFile(t, laptop, "file.txt", "hello")
+	branch = git(t, laptop, "symbolic-ref", "--short", "HEAD")
+
+	server = filepath.Join(t.TempDir(), "server")
+	git(t, laptop, "clone", "-q", laptop, server)
+	git(t, server, "config", "user.email", "server@example.com")
+	git(t, server, "config", "user.name", "Server User")
+	return laptop, server, branch
+}
+
+// fakeAge puts an age on PATH that "encrypts" by prepending the age header line and
+// "decrypts" by dropping it, for servers the real age is not installed on.
+func fakeAge(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+while [ $# -gt 1 ]; do
+	case "$1" in
+	-e | -d) MODE="$1" ;;
+	-o) OUT="$2"; shift ;;
+	-R | -i) shift ;;
+	esac
+	shift
+done
+if [ "$MODE" = -e ]; then
+	{ echo "age-encryption.org/v1"; cat "$1"; } > "$OUT"
+else
+	tail -n +2 "$1" > "$OUT"
+fi
+`
+	if err := os.WriteFile(filepath.Join(dir, "age"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// runSetup bundles the laptop repository and applies it to repoPath with the setup script.
+func runSetup(t *testing.T, laptop, repoPath, branch string, strategy bundle.Strategy) (*Outcome, string, error) {
+	t.Helper()
+	bundlePath := filepath.Join(t.TempDir(), "push.bundle")
+	git(t, laptop, "bundle", "create", "-q", bundlePath, "--all")
+
+	script := SetupScript(SetupOptions{
+		BundlePath: bundlePath,
+		RepoPath:   repoPath,
+		Branch:     branch,
+		Strategy:   strategy,
+	})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	outcome, parseErr := ParseOutcome(string(output))
+	if parseErr != nil {
+		t.Fatalf("%v: %s", parseErr, output)
+	}
+	return outcome, string(output), err
+}
+
+func TestSetupScriptOutcomes(t *testing.T) {
+	t.Run("cloned", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		os.RemoveAll(server)
+
+		outcome, output, err := runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+		if err != nil || outcome.State != StateCloned {
+			t.Fatalf("Expected cloned, got %s (%v): %s", outcome.State, err, output)
+		}
+		// The bundle is removed after the push, no remote may point at it
+		if remotes := git(t, server, "remote"); remotes != "" {
+			t.Errorf("Expected no remotes on the server, got %q", remotes)
+		}
+		if git(t, server, "rev-parse", "HEAD") != git(t, laptop, "rev-parse", "HEAD") {
+			t.Error("Server did not check out the laptop's commit")
+		}
+	})
+
+	t.Run("up-to-date", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+
+		outcome, output, err := runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+		if err != nil || outcome.State != StateUpToDate {
+			t.Fatalf("Expected up-to-date, got %s (%v): %s", outcome.State, err, output)
+		}
+	})
+
+	t.Run("fast-forwarded", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		commitFile(t, laptop, "new.txt", "new")
+
+		outcome, output, err := runSetup(t, laptop, server, branch, bundle.StrategyFFOnly)
+		if err != nil || outcome.State != StateFastForwarded {
+			t.Fatalf("Expected fast-forwarded, got %s (%v): %s", outcome.State, err, output)
+		}
+		if git(t, server, "rev-parse", "HEAD") != git(t, laptop, "rev-parse", "HEAD") {
+			t.Error("Server was not fast-forwarded to the laptop tip")
+		}
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		commitFile(t, laptop, "laptop.txt", "laptop")
+		commitFile(t, server, "server.txt", "server")
+
+		outcome, output, err := runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+		if err != nil || outcome.State != StateMerged {
+			t.Fatalf("Expected merged, got %s (%v): %s", outcome.State, err, output)
+		}
+	})
+
+	t.Run("diverged", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		commitFile(t, laptop, "laptop.txt", "laptop")
+		commitFile(t, server, "server.txt", "server")
+
+		outcome, _, err := runSetup(t, laptop, server, branch, bundle.StrategyFFOnly)
+		if err == nil || outcome.State != StateDiverged || !outcome.Failed() {
+			t.Fatalf("Expected a failed diverged outcome, got %s (%v)", outcome.State, err)
+		}
+	})
+
+	t.Run("fetched", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		before := git(t, server, "rev-parse", "HEAD")
+		commitFile(t, laptop, "new.txt", "new")
+
+		outcome, _, err := runSetup(t, laptop, server, branch, bundle.StrategyFetchOnly)
+		if err != nil || outcome.State != StateFetched {
+			t.Fatalf("Expected fetched, got %s (%v)", outcome.State, err)
+		}
+		if git(t, server, "rev-parse", "HEAD") != before {
+			t.Error("fetch-only moved the server branch")
+		}
+	})
+}
+
+func TestSetupScriptRemoteName(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	commitFile(t, laptop, "a.txt", "a")
+	bundlePath := filepath.Join(t.TempDir(), "push.bundle")
+	git(t, laptop, "bundle", "create", "-q", bundlePath, "--all")
+
+	script := SetupScript(SetupOptions{
+		BundlePath: bundlePath,
+		RepoPath:   server,
+		Branch:     branch,
+		Strategy:   bundle.StrategyFetchOnly,
+		Remote:     "lab",
+	})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Setup script failed: %v: %s", err, output)
+	}
+	if git(t, server, "rev-parse", bundle.RemotePrefix("lab")+branch) != git(t, laptop, "rev-parse", "HEAD") {
+		t.Errorf("Expected the branch fetched under server.name: %s", output)
+	}
+	if refs := git(t, server, "for-each-ref", bundle.RemotePrefix(bundle.DefaultRemote)); refs != "" {
+		t.Errorf("Expected nothing under the default namespace, got %s", refs)
+	}
+}
+
+func TestSetupScriptAbortsConflicts(t *testing.T) {
+	for _, strategy := range []bundle.Strategy{bundle.StrategyMerge, bundle.StrategyRebase} {
+		t.Run(string(strategy), func(t *testing.T) {
+			laptop, server, branch := setupRepos(t)
+			commitFile(t, laptop, "file.txt", "laptop version")
+			commitFile(t, server, "file.txt", "server version")
+			before := git(t, server, "rev-parse", "HEAD")
+
+			outcome, _, err := runSetup(t, laptop, server, branch, strategy)
+			if err == nil {
+				t.Error("Expected the script to exit non-zero")
+			}
+			if outcome.State != StateConflicted {
+				t.Fatalf("Expected conflicted, got %s", outcome.State)
+			}
+			if len(outcome.Conflicts) != 1 || outcome.Conflicts[0] != "file.txt" {
+				t.Errorf("Expected file.txt to be conflicted, got %v", outcome.Conflicts)
+			}
+
+			if git(t, server, "rev-parse", "HEAD") != before {
+				t.Error("Server HEAD was not restored after abort")
+			}
+			if status := git(t, server, "status", "--porcelain"); status != "" {
+				t.Errorf("Server working tree not clean after abort: %s", status)
+			}
+		})
+	}
+}
+
+func TestSetupScriptReportsConflictsWhenAbortFails(t *testing.T) {
+	realGit, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not available")
+	}
+	laptop, server, branch := setupRepos(t)
+	commitFile(t, laptop, "file.txt", "laptop version")
+	commitFile(t, server, "file.txt", "server version")
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$2\" != --abort ] || exit 1\nexec '" + realGit + "' \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "git"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	outcome, output, err := runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+	if err == nil || outcome == nil || outcome.State != StateConflicted {
+		t.Fatalf("Expected conflicted although the abort failed, got %v: %s", err, output)
+	}
+	if !strings.Contains(output, "--abort failed") {
+		t.Errorf("Expected the failed abort to be reported: %s", output)
+	}
+}
+
+func TestSetupScriptBlocksDirtyTree(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	commitFile(t, laptop, "new.txt", "new")
+	os.WriteFile(filepath.Join(server, "file.txt"), []byte("uncommitted"), 0644)
+
+	outcome, _, err := runSetup(t, laptop, server, branch, bundle.StrategyMerge)
+	if err == nil || outcome.State != StateDirtyTreeBlocked {
+		t.Fatalf("Expected dirty-tree-blocked, got %s (%v)", outcome.State, err)
+	}
+	if len(outcome.Dirty) != 1 || outcome.Dirty[0] != "file.txt" {
+		t.Errorf("Expected file.txt to be reported dirty, got %v", outcome.Dirty)
+	}
+	data, _ := os.ReadFile(filepath.Join(server, "file.txt"))
+	if string(data) != "uncommitted" {
+		t.Error("Uncommitted server change was overwritten")
+	}
+}
+
+func TestParseOutcome(t *testing.T) {
+	output := "🔄 Updating existing repository...\n" +
+		"CONFLICT (content): Merge conflict in a.txt\n" +
+		ConflictPrefix + "a.txt\n" +
+		ConflictPrefix + "dir/b.txt\r\n" +
+		OutcomePrefix + "conflicted\n"
+
+	outcome, err := ParseOutcome(output)
+	if err != nil {
+		t.Fatalf("ParseOutcome failed: %v", err)
+	}
+	if outcome.State != StateConflicted || !outcome.Failed() {
+		t.Errorf("Expected a failed conflicted outcome, got %+v", outcome)
+	}
+	if len(outcome.Conflicts) != 2 || outcome.Conflicts[1] != "dir/b.txt" {
+		t.Errorf("Unexpected conflicts: %v", outcome.Conflicts)
+	}
+
+	if _, err := ParseOutcome("❌ Bundle signature verification failed\n"); err != ErrNoOutcome {
+		t.Errorf("Expected ErrNoOutcome, got %v", err)
+	}
+}
+
+func TestSetupScriptSubmodules(t *testing.T) {
+	lib, _, _ := setupRepos(t)
+	laptop, server, branch := setupRepos(t)
+	os.RemoveAll(server)
+	git(t, laptop, "-c", "protocol.file.allow=always", "submodule", "add", "-q", lib, "lib")
+	git(t, laptop, "commit", "-q", "-m", "add lib")
+
+	push := func() (*Outcome, string, error) {
+		bundleDir := t.TempDir()
+		bundlePath := filepath.Join(bundleDir, "push.bundle")
+		repo := bundle.NewRepo(laptop)
+		if err := repo.CreateFull(t.Context(), bundlePath); err != nil {
+			t.Fatal(err)
+		}
+		subs, err := repo.CreateSubmoduleBundles(t.Context(), bundlePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		script := SetupScript(SetupOptions{
+			BundlePath: bundlePath,
+			RepoPath:   server,
+			Branch:     branch,
+			Submodules: subs,
+		})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		outcome, parseErr := ParseOutcome(string(output))
+		if parseErr != nil {
+			t.Fatalf("%v: %s", parseErr, output)
+		}
+		return outcome, string(output), err
+	}
+
+	outcome, output, err := push()
+	if err != nil || outcome.State != StateCloned {
+		t.Fatalf("Expected cloned, got %s (%v): %s", outcome.State, err, output)
+	}
+	if _, err := os.Stat(filepath.Join(server, "lib", "file.txt")); err != nil {
+		t.Fatalf("Submodule was not checked out on the server: %s", output)
+	}
+
+	commitFile(t, filepath.Join(laptop, "lib"), "new.txt", "new")
+	git(t, laptop, "commit", "-q", "-am", "bump lib")
+
+	outcome, output, err = push()
+	if err != nil || outcome.State != StateFastForwarded {
+		t.Fatalf("Expected fast-forwarded, got %s (%v): %s", outcome.State, err, output)
+	}
+	if _, err := os.Stat(filepath.Join(server, "lib", "new.txt")); err != nil {
+		t.Errorf("Submodule was not updated on the server: %s", output)
+	}
+}
+
+func TestSetupScriptInstallsLFSObjects(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	content := "large binary content"
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	objPath := filepath.Join(".git", "lfs", "objects", oid[0:2], oid[2:4], oid)
+
+	os.MkdirAll(filepath.Dir(filepath.Join(laptop, objPath)), 0755)
+	os.WriteFile(filepath.Join(laptop, objPath), []byte(content), 0644)
+	commitFile(t, laptop, "model.bin", fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content)))
+
+	bundlePath := filepath.Join(t.TempDir(), "push.bundle")
+	repo := bundle.NewRepo(laptop)
+	if err := repo.CreateFull(t.Context(), bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := repo.PackLFS(t.Context(), bundlePath)
+	if err != nil || archive == nil {
+		t.Fatalf("PackLFS failed: %v", err)
+	}
+
+	script := SetupScript(SetupOptions{
+		BundlePath: bundlePath,
+		RepoPath:   server,
+		Branch:     branch,
+		LFSArchive: archive.Path,
+	})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Setup script failed: %v: %s", err, output)
+	}
+
+	data, err := os.ReadFile(filepath.Join(server, objPath))
+	if err != nil || string(data) != content {
+		t.Errorf("LFS object was not installed on the server: %s", output)
+	}
+	if _, err := os.Stat(filepath.Join(server, ".git", "lfs", "objects", ".gitsync-incoming")); err == nil {
+		t.Error("Temporary LFS directory was left behind")
+	}
+}
+
+func TestSetupScriptShallowClone(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	os.RemoveAll(server)
+	for i := 0; i < 4; i++ {
+		commitFile(t, laptop, "file.txt", fmt.Sprintf("version %d", i))
+	}
+
+	repo := bundle.NewRepo(laptop)
+	apply := func(bundlePath string, shallow []string) (*Outcome, string) {
+		t.Helper()
+		script := SetupScript(SetupOptions{
+			BundlePath: bundlePath,
+			RepoPath:   server,
+			Branch:     branch,
+			Shallow:    shallow,
+		})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		if err != nil {
+			t.Fatalf("Setup script failed: %v: %s", err, output)
+		}
+		outcome, err := ParseOutcome(string(output))
+		if err != nil {
+			t.Fatalf("%v: %s", err, output)
+		}
+		return outcome, string(output)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "shallow.bundle")
+	shallow, err := repo.CreateShallow(t.Context(), bundlePath, bundle.ShallowOptions{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcome, output := apply(bundlePath, shallow); outcome.State != StateCloned {
+		t.Fatalf("Expected cloned, got %s: %s", outcome.State, output)
+	}
+	if git(t, server, "rev-parse", "--is-shallow-repository") != "true" {
+		t.Error("Expected a shallow repository on the server")
+	}
+	if count := git(t, server, "rev-list", "--count", "HEAD"); count != "2" {
+		t.Errorf("Expected 2 commits on the server, got %s", count)
+	}
+	if remotes := git(t, server, "remote"); remotes != "" {
+		t.Errorf("Expected no remotes on the server, got %q", remotes)
+	}
+
+	// Later pushes only require the boundary the server has
+	git(t, laptop, "update-ref", "refs/remotes/origin/"+branch, "HEAD~3")
+	if err := repo.SaveShallow(t.Context(), shallow); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, laptop, "file.txt", "after shallow push")
+	incremental := filepath.Join(t.TempDir(), "incremental.bundle")
+	if err := repo.CreateIncremental(t.Context(), incremental, branch); err != nil {
+		t.Fatal(err)
+	}
+	if outcome, output := apply(incremental, nil); outcome.State != StateFastForwarded {
+		t.Fatalf("Expected fast-forwarded, got %s: %s", outcome.State, output)
+	}
+	if git(t, server, "rev-parse", "HEAD") != git(t, laptop, "rev-parse", "HEAD") {
+		t.Error("Server did not reach the laptop's commit")
+	}
+}
+
+func TestSetupScriptShallowExisting(t *testing.T) {
+	// The server has the first commit; the laptop pushes the three after it shallowly
+	// The new commits go to topic when given, a branch the server does not have
+	push := func(t *testing.T, depth int, topic ...string) string {
+		t.Helper()
+		laptop, server, branch := setupRepos(t)
+		if len(topic) > 0 {
+			git(t, laptop, "checkout", "-q", "-b", topic[0])
+		}
+		for i := 0; i < 3; i++ {
+			commitFile(t, laptop, "file.txt", fmt.Sprintf("version %d", i))
+		}
+		bundlePath := filepath.Join(t.TempDir(), "shallow.bundle")
+		shallow, err := bundle.NewRepo(laptop).CreateShallow(t.Context(), bundlePath, bundle.ShallowOptions{Depth: depth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := SetupScript(SetupOptions{
+			BundlePath: bundlePath,
+			RepoPath:   server,
+			Branch:     branch,
+			Strategy:   bundle.StrategyMerge,
+			Shallow:    shallow,
+		})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		outcome, parseErr := ParseOutcome(string(output))
+		if err != nil || parseErr != nil || (outcome.State != StateFastForwarded && outcome.State != StateUpToDate) {
+			t.Fatalf("Expected the push to apply, got %v, %v: %s", err, parseErr, output)
+		}
+		if git(t, server, "rev-parse", "refs/remotes/gitsync/"+git(t, laptop, "symbolic-ref", "--short", "HEAD")) != git(t, laptop, "rev-parse", "HEAD") {
+			t.Error("Server did not receive the laptop's commit")
+		}
+		if output := git(t, server, "fsck", "--connectivity-only"); strings.Contains(output, "missing") {
+			t.Errorf("Server repository is not connected: %s", output)
+		}
+		return server
+	}
+
+	t.Run("boundary on another branch", func(t *testing.T) {
+		server := push(t, 1, "topic")
+		if git(t, server, "rev-parse", "--is-shallow-repository") != "true" {
+			t.Fatal("Expected the server repository to become shallow")
+		}
+		// Only the boundary commit the server did not have, the tip of topic
+		data, _ := os.ReadFile(filepath.Join(server, ".git", "shallow"))
+		want := []string{git(t, server, "rev-parse", bundle.RemotePrefix(bundle.DefaultRemote)+"topic")}
+		if got := strings.Fields(string(data)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected the shallow boundary %v, got %v", want, got)
+		}
+	})
+
+	t.Run("gap below the pushed branch", func(t *testing.T) {
+		laptop, server, branch := setupRepos(t)
+		before := git(t, server, "rev-parse", "HEAD")
+		for i := 0; i < 3; i++ {
+			commitFile(t, laptop, "file.txt", fmt.Sprintf("version %d", i))
+		}
+		bundlePath := filepath.Join(t.TempDir(), "shallow.bundle")
+		shallow, err := bundle.NewRepo(laptop).CreateShallow(t.Context(), bundlePath, bundle.ShallowOptions{Depth: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := SetupScript(SetupOptions{BundlePath: bundlePath, RepoPath: server, Branch: branch, Strategy: bundle.StrategyMerge, Shallow: shallow})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		if err == nil || !strings.Contains(string(output), "does not reach back") {
+			t.Fatalf("Expected the gap to be refused, got %v: %s", err, output)
+		}
+		if git(t, server, "rev-parse", "HEAD") != before || git(t, server, "rev-parse", "--is-shallow-repository") != "false" {
+			t.Error("Expected the server repository to be left as it was")
+		}
+		if refs := git(t, server, "for-each-ref", bundle.RemotePrefix(bundle.DefaultRemote)); refs != "" {
+			t.Errorf("Expected the fetched refs to be rolled back, got %s", refs)
+		}
+	})
+
+	t.Run("boundary on the server's history", func(t *testing.T) {
+		server := push(t, 3)
+		if git(t, server, "rev-parse", "--is-shallow-repository") != "false" {
+			t.Error("Expected the server repository to stay complete")
+		}
+		if count := git(t, server, "rev-list", "--count", "HEAD"); count != "4" {
+			t.Errorf("Expected 4 commits on the server, got %s", count)
+		}
+	})
+}
+
+func TestSetupScriptPartialClone(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	os.RemoveAll(server)
+	commitFile(t, laptop, "asset.bin", "old asset")
+	commitFile(t, laptop, "asset.bin", "new asset")
+
+	apply := func(bundlePath, filter string) string {
+		t.Helper()
+		script := SetupScript(SetupOptions{
+			BundlePath: bundlePath,
+			RepoPath:   server,
+			Branch:     branch,
+			Filter:     filter,
+		})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		if err != nil {
+			t.Fatalf("Setup script failed: %v: %s", err, output)
+		}
+		return string(output)
+	}
+	missing := func() string {
+		t.Helper()
+		var ids []string
+		for _, line := range strings.Split(git(t, server, "rev-list", "--objects", "--all", "--missing=print"), "\n") {
+			if strings.HasPrefix(line, "?") {
+				ids = append(ids, line)
+			}
+		}
+		return strings.Join(ids, " ")
+	}
+
+	repo := bundle.NewRepo(laptop)
+	filtered := filepath.Join(t.TempDir(), "filtered.bundle")
+	if err := repo.CreateFiltered(t.Context(), filtered, bundle.FilterOptions{Spec: "blob:none", Checkout: []string{branch}}); err != nil {
+		t.Fatal(err)
+	}
+	output := apply(filtered, "blob:none")
+	if outcome, err := ParseOutcome(output); err != nil || outcome.State != StateCloned {
+		t.Fatalf("Expected cloned: %s", output)
+	}
+	if git(t, server, "config", "extensions.partialClone") != "gitsync-promisor" {
+		t.Error("Expected a partial clone on the server")
+	}
+	if out, _ := exec.Command("git", "-C", server, "config", "remote.gitsync-promisor.url").Output(); len(out) != 0 {
+		t.Errorf("Expected the promisor remote to have no URL to fetch from, got %s", out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(server, "asset.bin")); string(data) != "new asset" {
+		t.Errorf("Expected the latest files to be checked out, got %q", data)
+	}
+	ids := missing()
+	if ids == "" {
+		t.Fatal("Expected older blobs to be missing on the server")
+	}
+	// Once the bundle is gone, reading a missing object fails without fetching from it
+	os.Remove(filtered)
+	if out, err := exec.Command("git", "-C", server, "cat-file", "-p", strings.Fields(ids)[0][1:]).CombinedOutput(); err == nil || strings.Contains(string(out), filtered) {
+		t.Errorf("Expected no lazy fetch from the removed bundle: %v: %s", err, out)
+	}
+
+	// A complete bundle backfills the missing objects even though no branch moves
+	complete := filepath.Join(t.TempDir(), "complete.bundle")
+	if err := repo.CreateFull(t.Context(), complete); err != nil {
+		t.Fatal(err)
+	}
+	output = apply(complete, "")
+	if outcome, err := ParseOutcome(output); err != nil || outcome.State != StateUpToDate {
+		t.Fatalf("Expected up-to-date: %s", output)
+	}
+	if ids := missing(); ids != "" {
+		t.Errorf("Expected all objects to be backfilled, still missing %s", ids)
+	}
+	if out, _ := exec.Command("git", "-C", server, "config", "extensions.partialClone").Output(); len(out) != 0 {
+		t.Errorf("Expected the complete repository to stop being a partial clone: %s", output)
+	}
+	if out, _ := exec.Command("git", "-C", server, "config", "--get-regexp", "^remote\\.gitsync-promisor\\.").Output(); len(out) != 0 {
+		t.Errorf("Expected the promisor remote to be removed: %s", out)
+	}
+}
+
+func TestSetupScriptWIP(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	repo := bundle.NewRepo(laptop)
+
+	apply := func(bundlePath, wip string) *Outcome {
+		t.Helper()
+		script := SetupScript(SetupOptions{
+			BundlePath: bundlePath,
+			RepoPath:   server,
+			Branch:     branch,
+			WIP:        wip,
+		})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		if err != nil {
+			t.Fatalf("Setup script failed: %v: %s", err, output)
+		}
+		outcome, err := ParseOutcome(string(output))
+		if err != nil {
+			t.Fatalf("%v: %s", err, output)
+		}
+		return outcome
+	}
+
+	// Uncommitted work on the laptop, with no new commits
+	if err := os.WriteFile(filepath.Join(laptop, "file.txt"), []byte("work in progress"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(laptop, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wip, err := repo.CaptureWIP(t.Context(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wipBundle := filepath.Join(t.TempDir(), "wip.bundle")
+	if err := repo.CreateWIP(t.Context(), wipBundle, branch, wip, false); err != nil {
+		t.Fatal(err)
+	}
+
+	outcome := apply(wipBundle, wip)
+	if outcome.State != StateUpToDate || outcome.WIP != WIPApplied {
+		t.Fatalf("Expected the work in progress to be applied, got %+v", outcome)
+	}
+	if data, _ := os.ReadFile(filepath.Join(server, "file.txt")); string(data) != "work in progress" {
+		t.Errorf("Expected the laptop's changes on the server, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(server, "notes.txt")); string(data) != "notes" {
+		t.Errorf("Expected the untracked file on the server, got %q", data)
+	}
+
+	// Once committed on the laptop, the untouched work in progress makes way for the commit
+	git(t, laptop, "add", "file.txt", "notes.txt")
+	git(t, laptop, "commit", "-q", "-m", "finish work")
+	full := filepath.Join(t.TempDir(), "full.bundle")
+	git(t, laptop, "bundle", "create", "-q", full, "--all")
+	outcome = apply(full, "")
+	if outcome.State != StateFastForwarded || outcome.WIP != "" {
+		t.Fatalf("Expected a fast-forward, got %+v", outcome)
+	}
+	if status := git(t, server, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean server tree, got:\n%s", status)
+	}
+
+	// Work in progress on a different commit is only stored
+	if err := os.WriteFile(filepath.Join(laptop, "file.txt"), []byte("more work"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, server, "server.txt", "server work")
+	wip, err = repo.CaptureWIP(t.Context(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateWIP(t.Context(), wipBundle, branch, wip, false); err != nil {
+		t.Fatal(err)
+	}
+	outcome = apply(wipBundle, wip)
+	if outcome.WIP != WIPStored {
+		t.Fatalf("Expected the work in progress to be stored, got %+v", outcome)
+	}
+	if git(t, server, "rev-parse", bundle.ReceivedWIPRef) != wip {
+		t.Errorf("Expected the work in progress under %s", bundle.ReceivedWIPRef)
+	}
+	if status := git(t, server, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected the server tree to be left alone, got:\n%s", status)
+	}
+}
+
+func TestSetupScriptPatches(t *testing.T) {
+	// The laptop sends three patches on top of the commit the server has, which got a
+	// commit of its own in the meantime
+	setup := func(t *testing.T, serverFile, serverContent string) (server string, outcome *Outcome, err error) {
+		laptop, server, branch := setupRepos(t)
+		git(t, laptop, "update-ref", "refs/remotes/origin/"+branch, "HEAD")
+		commitFile(t, laptop, "a.txt", "a")
+		commitFile(t, laptop, "file.txt", "laptop version")
+		commitFile(t, laptop, "b.txt", "b")
+		commitFile(t, server, serverFile, serverContent)
+
+		patchPath := filepath.Join(t.TempDir(), "push"+bundle.PatchExt)
+		patches, err := bundle.NewRepo(laptop).CreatePatches(t.Context(), patchPath, branch, bundle.DefaultRemote)
+		if err != nil || len(patches) != 3 {
+			t.Fatalf("CreatePatches returned %d patches, %v", len(patches), err)
+		}
+
+		script := SetupScript(SetupOptions{BundlePath: patchPath, RepoPath: server, Branch: branch, Patch: true})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		outcome, parseErr := ParseOutcome(string(output))
+		if parseErr != nil {
+			t.Fatalf("%v: %s", parseErr, output)
+		}
+		return server, outcome, err
+	}
+
+	t.Run("applied", func(t *testing.T) {
+		server, outcome, err := setup(t, "server.txt", "server")
+		if err != nil || outcome.State != StatePatched || outcome.Patches != 3 {
+			t.Fatalf("Expected 3 patches applied, got %s with %d (%v)", outcome.State, outcome.Patches, err)
+		}
+		if got := git(t, server, "log", "--format=%s", "-3"); got != "update b.txt\nupdate file.txt\nupdate a.txt" {
+			t.Errorf("Unexpected server history:\n%s", got)
+		}
+		if data, _ := os.ReadFile(filepath.Join(server, "file.txt")); string(data) != "laptop version" {
+			t.Errorf("Unexpected file.txt on the server: %q", data)
+		}
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		server, outcome, err := setup(t, "file.txt", "server version")
+		if err == nil || outcome.State != StatePatchFailed {
+			t.Fatalf("Expected patch-failed, got %s (%v)", outcome.State, err)
+		}
+		if outcome.Patches != 1 {
+			t.Errorf("Expected the first patch to apply, got %d", outcome.Patches)
+		}
+		if len(outcome.Conflicts) != 1 || outcome.Conflicts[0] != "file.txt" {
+			t.Errorf("Expected file.txt to be conflicted, got %v", outcome.Conflicts)
+		}
+		if got := git(t, server, "log", "-1", "--format=%an %s"); got != "Server User update file.txt" {
+			t.Errorf("Server HEAD was not restored after the failed series: %s", got)
+		}
+		if status := git(t, server, "status", "--porcelain"); status != "" {
+			t.Errorf("Server working tree not clean after abort: %s", status)
+		}
+	})
+}
+
+func TestSetupScriptPatchesWrongBranch(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	git(t, laptop, "update-ref", "refs/remotes/origin/"+branch, "HEAD")
+	commitFile(t, laptop, "a.txt", "a")
+	git(t, server, "checkout", "-q", "-b", "other")
+	before := git(t, server, "rev-parse", "HEAD")
+
+	patchPath := filepath.Join(t.TempDir(), "push"+bundle.PatchExt)
+	if _, err := bundle.NewRepo(laptop).CreatePatches(t.Context(), patchPath, branch, bundle.DefaultRemote); err != nil {
+		t.Fatal(err)
+	}
+	script := SetupScript(SetupOptions{BundlePath: patchPath, RepoPath: server, Branch: branch, Patch: true})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	outcome, parseErr := ParseOutcome(string(output))
+	if err == nil || parseErr != nil || outcome.State != StateWrongBranch {
+		t.Fatalf("Expected wrong-branch, got %v, %v: %s", err, parseErr, output)
+	}
+	if !strings.Contains(string(output), "refs/heads/other checked out") {
+		t.Errorf("Expected the checked-out branch to be named: %s", output)
+	}
+	if git(t, server, "rev-parse", "HEAD") != before || git(t, server, "rev-parse", branch) != before {
+		t.Error("Expected no patch to be applied")
+	}
+}
+
+func TestSetupScriptVerifiesSignature(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	laptop, server, branch := setupRepos(t)
+	commitFile(t, laptop, "new.txt", "new")
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen failed: %v: %s", err, output)
+	}
+	pub, _ := os.ReadFile(key + ".pub")
+	allowed := filepath.Join(dir, "allowed_signers")
+	os.WriteFile(allowed, []byte(`ops,*@example.com namespaces="gitsynq" `+string(pub)), 0644)
+
+	bundlePath := filepath.Join(t.TempDir(), "push.bundle")
+	git(t, laptop, "bundle", "create", "-q", bundlePath, "--all")
+	if output, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", key, "-n", bundle.SignatureNamespace, bundlePath).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen sign failed: %v: %s", err, output)
+	}
+
+	script := SetupScript(SetupOptions{BundlePath: bundlePath, RepoPath: server, Branch: branch, AllowedSigners: allowed, Strict: true})
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil || !strings.Contains(string(output), "Signature verified: ops") {
+		t.Fatalf("Expected the signature to verify as ops: %v: %s", err, output)
+	}
+
+	// A tampered bundle is refused by every principal
+	os.WriteFile(bundlePath, append([]byte("x"), pub...), 0644)
+	if output, err := exec.Command("sh", "-c", script).CombinedOutput(); err == nil {
+		t.Errorf("Expected a tampered bundle to be refused: %s", output)
+	}
+}
+
+func TestSetupScriptRemovesDecryptedBundle(t *testing.T) {
+	fakeAge(t)
+	laptop, server, branch := setupRepos(t)
+	commitFile(t, laptop, "new.txt", "new")
+
+	// The bundle path is relative to where the script starts, not to the repository
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "push.bundle")
+	git(t, laptop, "bundle", "create", "-q", plain, "--all")
+	data, err := os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plain+bundle.EncryptedExt, append([]byte("age-encryption.org/v1\n"), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(plain)
+	identity := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identity, []byte("AGE-SECRET-KEY-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("sh", "-c", SetupScript(SetupOptions{
+		BundlePath: "push.bundle" + bundle.EncryptedExt,
+		RepoPath:   server,
+		Branch:     branch,
+		Strategy:   bundle.StrategyMerge,
+		Identity:   identity,
+	}))
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	outcome, parseErr := ParseOutcome(string(output))
+	if err != nil || parseErr != nil || outcome.State != StateFastForwarded {
+		t.Fatalf("Expected fast-forwarded, got %v, %v: %s", err, parseErr, output)
+	}
+	if _, err := os.Stat(plain); !os.IsNotExist(err) {
+		t.Error("Expected the decrypted bundle to be removed from the server")
+	}
+}
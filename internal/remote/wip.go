@@ -0,0 +1,52 @@
+package remote
+
+import (
+	"fmt"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+// Work in progress results reported by the setup script, see Outcome.WIP.
+const (
+	WIPApplied = "applied"
+	WIPStored  = "stored"
+)
+
+// WIPScript returns POSIX shell commands that capture the uncommitted changes of the
+// repository in the current directory like bundle.CaptureWIP and point bundle.WIPRef at
+// them, so that a bundle of all refs carries them. They print "WIP:<commit>" when there
+// was anything to capture.
+func WIPScript(untracked bool) string {
+	untrackedFiles := ""
+	if untracked {
+		untrackedFiles = "true"
+	}
+	return fmt.Sprintf(`
+		WIP_UNTRACKED="%s"
+		if git rev-parse -q --verify HEAD >/dev/null; then
+			if [ -n "$WIP_UNTRACKED" ]; then
+				WIP_STATUS=$(git status --porcelain --ignore-submodules=all)
+			else
+				WIP_STATUS=$(git status --porcelain --untracked-files=no --ignore-submodules=all)
+			fi
+		fi
+		if [ -n "$WIP_STATUS" ]; then
+			git var GIT_COMMITTER_IDENT >/dev/null 2>&1 || export GIT_AUTHOR_NAME=gitsync GIT_AUTHOR_EMAIL=gitsync@localhost GIT_COMMITTER_NAME=gitsync GIT_COMMITTER_EMAIL=gitsync@localhost
+			WIP_TMP=$(mktemp -d)
+			WIP_SUBJECT="$(git symbolic-ref -q --short HEAD || echo '(no branch)'): $(git log -1 --format='%%h %%s')"
+			WIP_PARENTS="-p $(git rev-parse HEAD) -p $(git commit-tree -p HEAD -m "index on $WIP_SUBJECT" "$(git write-tree)")"
+			if [ -n "$WIP_UNTRACKED" ] && [ -n "$(git ls-files --others --exclude-standard)" ]; then
+				git ls-files -z --others --exclude-standard | GIT_INDEX_FILE="$WIP_TMP/untracked" git update-index -z --add --stdin
+				WIP_PARENTS="$WIP_PARENTS -p $(git commit-tree -m "untracked files on $WIP_SUBJECT" "$(GIT_INDEX_FILE="$WIP_TMP/untracked" git write-tree)")"
+			fi
+			# A copy of the index collects the working tree without touching the real one
+			cp "$(git rev-parse --git-path index)" "$WIP_TMP/index"
+			GIT_INDEX_FILE="$WIP_TMP/index" git add --update
+			WIP=$(git commit-tree $WIP_PARENTS -m "WIP on $WIP_SUBJECT" "$(GIT_INDEX_FILE="$WIP_TMP/index" git write-tree)")
+			rm -rf "$WIP_TMP"
+			if [ -n "$WIP" ] && git update-ref "%s" "$WIP"; then
+				echo "WIP:$WIP"
+			fi
+		fi
+	`, untrackedFiles, bundle.WIPRef)
+}
@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+func TestWIPScript(t *testing.T) {
+	laptop, server, _ := setupRepos(t)
+
+	capture := func(untracked bool) string {
+		t.Helper()
+		cmd := exec.Command("sh", "-c", WIPScript(untracked))
+		cmd.Dir = server
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("WIP script failed: %v: %s", err, output)
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if wip, ok := strings.CutPrefix(strings.TrimSpace(line), "WIP:"); ok {
+				return wip
+			}
+		}
+		return ""
+	}
+
+	if wip := capture(true); wip != "" {
+		t.Fatalf("Expected nothing to capture in a clean tree, got %s", wip)
+	}
+
+	if err := os.WriteFile(filepath.Join(server, "file.txt"), []byte("server work"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(server, "staged.txt"), []byte("staged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, server, "add", "staged.txt")
+	if err := os.WriteFile(filepath.Join(server, "untracked.txt"), []byte("untracked"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status := git(t, server, "status", "--porcelain")
+
+	wip := capture(true)
+	if wip == "" {
+		t.Fatal("Expected the server changes to be captured")
+	}
+	if git(t, server, "rev-parse", bundle.WIPRef) != wip {
+		t.Errorf("Expected %s to point at the work in progress", bundle.WIPRef)
+	}
+	if got := git(t, server, "status", "--porcelain"); got != status {
+		t.Errorf("WIP script changed the working tree:\n%s", got)
+	}
+
+	// The script records the same trees as bundle.CaptureWIP
+	expected, err := bundle.NewRepo(server).CaptureWIP(t.Context(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range []string{"^{tree}", "^2^{tree}", "^3^{tree}"} {
+		if git(t, server, "rev-parse", wip+rev) != git(t, server, "rev-parse", expected+rev) {
+			t.Errorf("Tree %s differs from bundle.CaptureWIP", rev)
+		}
+	}
+
+	// A bundle of all refs carries it to the laptop, where it applies on the same commit
+	bundlePath := filepath.Join(t.TempDir(), "server.bundle")
+	git(t, server, "bundle", "create", "-q", bundlePath, "--all")
+	repo := bundle.NewRepo(laptop)
+	received, err := repo.ReceiveWIP(t.Context(), bundlePath)
+	if err != nil || received != wip {
+		t.Fatalf("ReceiveWIP returned %q, %v", received, err)
+	}
+	if applied, err := repo.ApplyWIP(t.Context(), received); err != nil || !applied {
+		t.Fatalf("ApplyWIP failed: %v, %v", applied, err)
+	}
+	if got := git(t, laptop, "status", "--porcelain"); got != status {
+		t.Errorf("Expected the server changes on the laptop, got:\n%s", got)
+	}
+}
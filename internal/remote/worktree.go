@@ -0,0 +1,87 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Server repository layouts.
+const (
+	// LayoutCheckout is a clone whose working tree bundles are merged into.
+	LayoutCheckout = "checkout"
+	// LayoutBare is a bare repository at <repo>/.git that receives every bundle, with
+	// worktrees for the people working on the server. A worktree is only updated when it
+	// has no uncommitted changes.
+	LayoutBare = "bare"
+)
+
+// ValidateLayout reports whether layout names a server repository layout. Empty means
+// LayoutCheckout.
+func ValidateLayout(layout string) error {
+	switch layout {
+	case "", LayoutCheckout, LayoutBare:
+		return nil
+	}
+	return fmt.Errorf("invalid server layout %q (want %s or %s)", layout, LayoutCheckout, LayoutBare)
+}
+
+// WorktreePrefix is the line prefix the setup script reports worktrees of a bare
+// repository with, other than the one the pushed branch is integrated in.
+const WorktreePrefix = "GITSYNC_WORKTREE:"
+
+// What the setup script did to a worktree.
+const (
+	WorktreeCreated  = "created"
+	WorktreeUpdated  = "updated"
+	WorktreeDirty    = "dirty"
+	WorktreeDiverged = "diverged"
+)
+
+// Worktree is a worktree of a bare server repository. Path is relative to the
+// repository directory unless absolute and defaults to the branch name. Status is only
+// set in reports, see Outcome.
+type Worktree struct {
+	Branch string
+	Path   string
+	Status string
+}
+
+// worktreeList renders worktrees as "branch|path" lines for the setup script.
+func worktreeList(worktrees []Worktree) string {
+	var lines []string
+	for _, wt := range worktrees {
+		lines = append(lines, wt.Branch+"|"+wt.Path)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseWorktree parses a WorktreePrefix line, "status branch path".
+func parseWorktree(line string) (Worktree, bool) {
+	fields := strings.SplitN(strings.TrimPrefix(line, WorktreePrefix), " ", 3)
+	if len(fields) != 3 {
+		return Worktree{}, false
+	}
+	return Worktree{Status: fields[0], Branch: fields[1], Path: fields[2]}, true
+}
+
+// worktreeOf is a shell function that prints the worktree that has branch $1 checked
+// out, if any. Run in a checkout, it prints the checkout itself for its current branch.
+const worktreeOf = `
+		worktree_of() {
+			git worktree list --porcelain | awk -v ref="refs/heads/$1" '
+				/^worktree / { path = substr($0, 10) }
+				$0 == "branch " ref { print path; exit }'
+		}
+`
+
+// EnterWorktreeScript returns shell code that, run in a bare repository, changes to the
+// worktree that has branch checked out, so commands that need a working tree see the
+// one people work in. Elsewhere, or without such a worktree, it does nothing.
+func EnterWorktreeScript(branch string) string {
+	return worktreeOf + fmt.Sprintf(`
+		if [ "$(git rev-parse --is-bare-repository)" = true ]; then
+			WORKTREE=$(worktree_of "%s")
+			[ -z "$WORKTREE" ] || cd "$WORKTREE"
+		fi
+	`, branch)
+}
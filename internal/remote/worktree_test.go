@@ -0,0 +1,113 @@
+package remote
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/gitsynq/internal/bundle"
+)
+
+func TestSetupScriptBareLayout(t *testing.T) {
+	laptop, _, branch := setupRepos(t)
+	git(t, laptop, "branch", "feature")
+	git(t, laptop, "branch", "other")
+	server := filepath.Join(t.TempDir(), "server")
+	main := filepath.Join(server, branch)
+	feature := filepath.Join(server, "feature")
+
+	push := func(t *testing.T) (*Outcome, string) {
+		t.Helper()
+		bundlePath := filepath.Join(t.TempDir(), "push.bundle")
+		git(t, laptop, "bundle", "create", "-q", bundlePath, "--all")
+		script := SetupScript(SetupOptions{
+			BundlePath: bundlePath,
+			RepoPath:   server,
+			Branch:     branch,
+			Strategy:   bundle.StrategyMerge,
+			Bare:       true,
+			Worktrees:  []Worktree{{Branch: branch}, {Branch: "feature"}},
+		})
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		outcome, parseErr := ParseOutcome(string(output))
+		if err != nil || parseErr != nil {
+			t.Fatalf("Setup failed: %v, %v: %s", err, parseErr, output)
+		}
+		return outcome, string(output)
+	}
+
+	outcome, output := push(t)
+	if outcome.State != StateCloned || len(outcome.Worktrees) != 2 {
+		t.Fatalf("Expected cloned with 2 new worktrees, got %+v: %s", outcome, output)
+	}
+	if git(t, server, "rev-parse", "--is-bare-repository") != "true" {
+		t.Error("Expected a bare repository")
+	}
+	if _, err := os.Stat(filepath.Join(main, "file.txt")); err != nil {
+		t.Errorf("Expected a checked-out worktree for %s: %v", branch, err)
+	}
+	if git(t, server, "rev-parse", "refs/heads/other") != git(t, laptop, "rev-parse", "other") {
+		t.Error("Expected the branch without a worktree to be created")
+	}
+
+	// A dirty worktree is left alone while the repository still receives the bundle
+	commitFile(t, laptop, "new.txt", "new")
+	git(t, laptop, "checkout", "-q", "feature")
+	commitFile(t, laptop, "feature.txt", "feature")
+	git(t, laptop, "checkout", "-q", branch)
+	before := git(t, main, "rev-parse", "HEAD")
+	os.WriteFile(filepath.Join(main, "file.txt"), []byte("uncommitted"), 0644)
+
+	outcome, output = push(t)
+	if outcome.State != StateReceived || outcome.Failed() {
+		t.Fatalf("Expected received, got %s: %s", outcome.State, output)
+	}
+	if len(outcome.Dirty) != 1 || outcome.Dirty[0] != "file.txt" {
+		t.Errorf("Expected file.txt to be reported dirty, got %v", outcome.Dirty)
+	}
+	if git(t, main, "rev-parse", "HEAD") != before {
+		t.Error("The dirty worktree was moved")
+	}
+	if git(t, server, "rev-parse", bundle.RemotePrefix(bundle.DefaultRemote)+branch) != git(t, laptop, "rev-parse", branch) {
+		t.Error("The bundle was not received into the tracking branch")
+	}
+	want := Worktree{Branch: "feature", Path: feature, Status: WorktreeUpdated}
+	if len(outcome.Worktrees) != 1 || outcome.Worktrees[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, outcome.Worktrees)
+	}
+	if _, err := os.Stat(filepath.Join(feature, "feature.txt")); err != nil {
+		t.Errorf("The clean feature worktree was not updated: %v", err)
+	}
+
+	// Once clean, the worktree catches up
+	git(t, main, "checkout", "--", "file.txt")
+	if outcome, output = push(t); outcome.State != StateFastForwarded {
+		t.Fatalf("Expected fast-forwarded, got %s: %s", outcome.State, output)
+	}
+	if git(t, main, "rev-parse", "HEAD") != git(t, laptop, "rev-parse", branch) {
+		t.Error("The worktree was not fast-forwarded")
+	}
+}
+
+func TestSetupScriptLayoutMismatch(t *testing.T) {
+	laptop, server, branch := setupRepos(t)
+	bundlePath := filepath.Join(t.TempDir(), "push.bundle")
+	git(t, laptop, "bundle", "create", "-q", bundlePath, "--all")
+
+	script := SetupScript(SetupOptions{BundlePath: bundlePath, RepoPath: server, Branch: branch, Bare: true})
+	if output, err := exec.Command("sh", "-c", script).CombinedOutput(); err == nil {
+		t.Errorf("Expected a checkout to be refused in the bare layout: %s", output)
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	for _, layout := range []string{"", LayoutCheckout, LayoutBare} {
+		if err := ValidateLayout(layout); err != nil {
+			t.Errorf("ValidateLayout(%q) failed: %v", layout, err)
+		}
+	}
+	if err := ValidateLayout("mirror"); err == nil {
+		t.Error("Expected an unknown layout to fail")
+	}
+}
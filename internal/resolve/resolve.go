@@ -0,0 +1,209 @@
+// Package resolve parses Git conflict markers and rewrites conflicted files from
+// per-hunk choices.
+package resolve
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflict marker prefixes, followed by a space and a label.
+const (
+	markerOurs   = "<<<<<<<"
+	markerBase   = "|||||||"
+	markerSep    = "======="
+	markerTheirs = ">>>>>>>"
+)
+
+// Choice selects how a hunk is resolved.
+type Choice int
+
+// Resolutions offered for a hunk.
+const (
+	ChooseOurs Choice = iota
+	ChooseTheirs
+	ChooseBoth
+	ChooseBase
+)
+
+// Hunk is one conflicted region of a file. Lines keep their line endings. Base is only
+// present when the file was merged with the diff3 conflict style.
+type Hunk struct {
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
+	Ours        []string
+	Base        []string
+	Theirs      []string
+	HasBase     bool
+
+	resolution []string
+	resolved   bool
+}
+
+// Segment is either a run of unconflicted lines or a single Hunk.
+type Segment struct {
+	Lines []string
+	Hunk  *Hunk
+}
+
+// File is a conflicted file split into segments.
+type File struct {
+	Segments []Segment
+}
+
+// Parse splits data into unconflicted text and conflict hunks.
+func Parse(data []byte) (*File, error) {
+	f := &File{}
+	var text []string
+	var hunk *Hunk
+	section := 0 // 0 outside a hunk, 1 ours, 2 base, 3 theirs
+
+	flush := func() {
+		if len(text) > 0 {
+			f.Segments = append(f.Segments, Segment{Lines: text})
+			text = nil
+		}
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		switch {
+		case section == 0 && isMarker(line, markerOurs):
+			flush()
+			hunk = &Hunk{OursLabel: markerLabel(line)}
+			section = 1
+		case section == 1 && isMarker(line, markerBase):
+			hunk.BaseLabel = markerLabel(line)
+			hunk.HasBase = true
+			section = 2
+		case (section == 1 || section == 2) && isMarker(line, markerSep):
+			section = 3
+		case section == 3 && isMarker(line, markerTheirs):
+			hunk.TheirsLabel = markerLabel(line)
+			f.Segments = append(f.Segments, Segment{Hunk: hunk})
+			hunk = nil
+			section = 0
+		case section == 1:
+			hunk.Ours = append(hunk.Ours, line)
+		case section == 2:
+			hunk.Base = append(hunk.Base, line)
+		case section == 3:
+			hunk.Theirs = append(hunk.Theirs, line)
+		default:
+			text = append(text, line)
+		}
+	}
+	if section != 0 {
+		return nil, fmt.Errorf("unterminated conflict marker")
+	}
+	flush()
+
+	return f, nil
+}
+
+func isMarker(line, marker string) bool {
+	rest, ok := strings.CutPrefix(line, marker)
+	if !ok {
+		return false
+	}
+	return rest == "" || rest[0] == ' ' || rest[0] == '\n' || rest[0] == '\r'
+}
+
+func markerLabel(line string) string {
+	return strings.TrimSpace(line[len(markerOurs):])
+}
+
+// Hunks returns the conflict hunks of the file in order.
+func (f *File) Hunks() []*Hunk {
+	var hunks []*Hunk
+	for _, seg := range f.Segments {
+		if seg.Hunk != nil {
+			hunks = append(hunks, seg.Hunk)
+		}
+	}
+	return hunks
+}
+
+// Unresolved returns the number of hunks that have not been resolved yet.
+func (f *File) Unresolved() int {
+	n := 0
+	for _, h := range f.Hunks() {
+		if !h.resolved {
+			n++
+		}
+	}
+	return n
+}
+
+// Bytes renders the file with resolved hunks replaced by their resolution and
+// unresolved hunks kept as conflict markers.
+func (f *File) Bytes() []byte {
+	var b strings.Builder
+	for _, seg := range f.Segments {
+		if seg.Hunk == nil {
+			b.WriteString(strings.Join(seg.Lines, ""))
+			continue
+		}
+		if seg.Hunk.resolved {
+			b.WriteString(strings.Join(seg.Hunk.resolution, ""))
+		} else {
+			b.WriteString(seg.Hunk.Markers())
+		}
+	}
+	return []byte(b.String())
+}
+
+// Choose resolves the hunk by keeping one or both sides.
+func (h *Hunk) Choose(c Choice) {
+	var lines []string
+	switch c {
+	case ChooseOurs:
+		lines = h.Ours
+	case ChooseTheirs:
+		lines = h.Theirs
+	case ChooseBoth:
+		lines = append(append(lines, h.Ours...), h.Theirs...)
+	case ChooseBase:
+		lines = h.Base
+	}
+	h.resolution = append([]string(nil), lines...)
+	h.resolved = true
+}
+
+// SetResolution resolves the hunk with arbitrary text, e.g. the result of an editor session.
+func (h *Hunk) SetResolution(text string) {
+	h.resolution = strings.SplitAfter(text, "\n")
+	h.resolved = true
+}
+
+// Resolved reports whether a resolution was chosen for the hunk.
+func (h *Hunk) Resolved() bool {
+	return h.resolved
+}
+
+// Markers renders the hunk with its original conflict markers.
+func (h *Hunk) Markers() string {
+	var b strings.Builder
+	writeMarker := func(marker, label string) {
+		b.WriteString(marker)
+		if label != "" {
+			b.WriteString(" " + label)
+		}
+		b.WriteString("\n")
+	}
+
+	writeMarker(markerOurs, h.OursLabel)
+	b.WriteString(strings.Join(h.Ours, ""))
+	if h.HasBase {
+		writeMarker(markerBase, h.BaseLabel)
+		b.WriteString(strings.Join(h.Base, ""))
+	}
+	writeMarker(markerSep, "")
+	b.WriteString(strings.Join(h.Theirs, ""))
+	writeMarker(markerTheirs, h.TheirsLabel)
+	return b.String()
+}
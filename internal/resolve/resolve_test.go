@@ -0,0 +1,100 @@
+package resolve
+
+import (
+	"strings"
+	"testing"
+)
+
+const conflicted = `package main
+
+<<<<<<< HEAD
+func greet() string { return "hello laptop" }
+||||||| merged common ancestors
+func greet() string { return "hello" }
+=======
+func greet() string { return "hello server" }
+>>>>>>> refs/remotes/gitsync/main
+
+func main() {}
+<<<<<<< HEAD
+// laptop
+=======
+// server
+>>>>>>> refs/remotes/gitsync/main
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(conflicted))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	hunks := f.Hunks()
+	if len(hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, got %d", len(hunks))
+	}
+
+	first := hunks[0]
+	if !first.HasBase || first.BaseLabel != "merged common ancestors" {
+		t.Errorf("Expected a diff3 base, got %+v", first)
+	}
+	if first.OursLabel != "HEAD" || first.TheirsLabel != "refs/remotes/gitsync/main" {
+		t.Errorf("Unexpected labels: %q, %q", first.OursLabel, first.TheirsLabel)
+	}
+	if len(first.Ours) != 1 || !strings.Contains(first.Ours[0], "hello laptop") {
+		t.Errorf("Unexpected ours: %q", first.Ours)
+	}
+	if hunks[1].HasBase {
+		t.Error("Expected the second hunk to have no base")
+	}
+
+	// Unresolved files render back to their original content
+	if string(f.Bytes()) != conflicted {
+		t.Errorf("Round trip changed the file:\n%s", f.Bytes())
+	}
+}
+
+func TestResolve(t *testing.T) {
+	f, _ := Parse([]byte(conflicted))
+	hunks := f.Hunks()
+
+	hunks[0].Choose(ChooseTheirs)
+	if f.Unresolved() != 1 {
+		t.Errorf("Expected 1 unresolved hunk, got %d", f.Unresolved())
+	}
+
+	hunks[1].Choose(ChooseBoth)
+	want := `package main
+
+func greet() string { return "hello server" }
+
+func main() {}
+// laptop
+// server
+`
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Unexpected resolution:\n%s", got)
+	}
+
+	hunks[0].SetResolution("func greet() string { return \"hi\" }\n")
+	if !strings.Contains(string(f.Bytes()), `return "hi"`) {
+		t.Error("Edited resolution was not applied")
+	}
+
+	hunks[0].Choose(ChooseBase)
+	if !strings.Contains(string(f.Bytes()), `return "hello" }`) {
+		t.Error("Base resolution was not applied")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse([]byte("<<<<<<< HEAD\nours\n=======\ntheirs\n")); err == nil {
+		t.Error("Expected an error for an unterminated hunk")
+	}
+
+	// Marker-like lines outside a hunk are plain text
+	f, err := Parse([]byte("=======\n>>>>>>> not a hunk\n"))
+	if err != nil || len(f.Hunks()) != 0 {
+		t.Errorf("Expected plain text, got %v hunks (%v)", len(f.Hunks()), err)
+	}
+}
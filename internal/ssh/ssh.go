@@ -10,6 +10,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -237,6 +238,36 @@ func (c *Client) Download(remotePath, localPath string, onProgress ProgressFunc)
 	return nil
 }
 
+// List returns the entries of a remote directory. A leading ~ is resolved against the
+// login directory, as the remote shell would.
+func (c *Client) List(dir string) ([]os.FileInfo, error) {
+	entries, err := c.sftpClient.ReadDir(c.expandHome(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote directory %s: %w", dir, err)
+	}
+	return entries, nil
+}
+
+// Remove deletes a remote file. A leading ~ is resolved as in List.
+func (c *Client) Remove(remotePath string) error {
+	if err := c.sftpClient.Remove(c.expandHome(remotePath)); err != nil {
+		return fmt.Errorf("failed to remove remote file %s: %w", remotePath, err)
+	}
+	return nil
+}
+
+// expandHome resolves a leading ~ in a remote path, which SFTP does not understand.
+func (c *Client) expandHome(remotePath string) string {
+	if remotePath != "~" && !strings.HasPrefix(remotePath, "~/") {
+		return remotePath
+	}
+	home, err := c.sftpClient.Getwd()
+	if err != nil {
+		return remotePath
+	}
+	return home + strings.TrimPrefix(remotePath, "~")
+}
+
 type progressWriter struct {
 	writer     io.Writer
 	current    int64
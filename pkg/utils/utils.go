@@ -5,7 +5,9 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ExpandHome expands the tilde (~) in a path to the user's home directory.
@@ -36,6 +38,58 @@ func FormatBytes(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
+// ParseBytes parses a human-readable size such as "500M", "1.5G" or "2048" into bytes.
+// Units are powers of 1024, matching FormatBytes.
+func ParseBytes(input string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(input))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if s != "" {
+		if idx := strings.IndexByte("KMGTPE", s[len(s)-1]); idx >= 0 {
+			for i := 0; i <= idx; i++ {
+				multiplier *= 1024
+			}
+			s = s[:len(s)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q", input)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+// ParseDuration parses a duration such as "30d", "2w" or "12h". Days and weeks are
+// accepted in addition to the units understood by time.ParseDuration.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	if unit == 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return d, nil
+	}
+
+	value, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(value * float64(unit)), nil
+}
+
 // FileExists checks if a file exists.
 func FileExists(path string) bool {
 	_, err := os.Stat(path)